@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// runAccounts implements `sidekick accounts`. Credentials are sealed at rest
+// when ENCRYPTION_KEYS is set.
+//
+//	accounts set <name> [-provider p]   store an account's credentials, read from stdin as
+//	                                    {"api_key", "refresh_token", "access_token", "expires_at"}
+//	accounts get <name>                 print an account with its credentials as JSON
+//	accounts list                       print accounts without credentials as JSON lines
+func runAccounts(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: sidekick accounts set|get|list")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	open := func() (storage.Store, func()) {
+		js, closeJS := commandJetStream(cfg)
+		store, err := openStore(ctx, cfg, js)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open storage")
+		}
+		return store, func() {
+			store.Close()
+			closeJS()
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+
+	switch args[0] {
+	case "set":
+		fs := flag.NewFlagSet("accounts set", flag.ExitOnError)
+		provider := fs.String("provider", "anthropic", "account provider")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "usage: sidekick accounts set <name> [-provider p] < credentials.json")
+			os.Exit(2)
+		}
+		var a storage.Account
+		if err := json.NewDecoder(os.Stdin).Decode(&a); err != nil {
+			log.Fatal().Err(err).Msg("failed to read credentials from stdin")
+		}
+		a.Name, a.Provider = fs.Arg(0), *provider
+
+		store, closeStore := open()
+		defer closeStore()
+		if err := store.UpsertAccount(ctx, &a); err != nil {
+			log.Fatal().Err(err).Msg("failed to store account")
+		}
+		log.Info().Str("account", a.Name).Str("id", a.ID.String()).Msg("account stored")
+
+	case "get":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: sidekick accounts get <name>")
+			os.Exit(2)
+		}
+		store, closeStore := open()
+		defer closeStore()
+		a, err := store.GetAccount(ctx, args[1])
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Fatal().Str("account", args[1]).Msg("no such account")
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to get account")
+		}
+		enc.Encode(a)
+
+	case "list":
+		store, closeStore := open()
+		defer closeStore()
+		accounts, err := store.ListAccounts(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to list accounts")
+		}
+		for _, a := range accounts {
+			a.APIKey, a.RefreshToken, a.AccessToken = "", "", ""
+			enc.Encode(a)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown accounts command %q\n", args[0])
+		os.Exit(2)
+	}
+}
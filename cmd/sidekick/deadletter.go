@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// runDeadLetter implements `sidekick deadletter`:
+//
+//	deadletter list [-all] [-limit n]   print dead letters as JSON lines
+//	deadletter replay [-all] [id ...]   re-apply pending dead letters
+//	deadletter load                     move the local spool file into the database
+func runDeadLetter(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: sidekick deadletter list|replay|load")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	js, closeJS := commandJetStream(cfg)
+	defer closeJS()
+	store, err := openStore(ctx, cfg, js)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open storage")
+	}
+	defer store.Close()
+	cipher, err := loadCipher(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load encryption keys")
+	}
+	deadLetters := storage.NewDeadLetterStore(store, cfg.WriterDeadLetterSpool, cipher)
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("deadletter list", flag.ExitOnError)
+		all := fs.Bool("all", false, "include already replayed entries")
+		limit := fs.Int("limit", 100, "maximum number of entries")
+		fs.Parse(args[1:])
+
+		entries, err := deadLetters.List(ctx, *all, *limit)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to list dead letters")
+		}
+		enc := json.NewEncoder(os.Stdout)
+		for _, dl := range entries {
+			enc.Encode(dl)
+		}
+
+	case "replay":
+		fs := flag.NewFlagSet("deadletter replay", flag.ExitOnError)
+		all := fs.Bool("all", false, "replay every pending entry")
+		fs.Parse(args[1:])
+
+		var ids []int64
+		if *all {
+			entries, err := deadLetters.List(ctx, false, 1<<31-1)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to list dead letters")
+			}
+			for _, dl := range entries {
+				ids = append(ids, dl.ID)
+			}
+		}
+		for _, arg := range fs.Args() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				log.Fatal().Str("id", arg).Msg("invalid dead letter id")
+			}
+			ids = append(ids, id)
+		}
+
+		failed := 0
+		for _, id := range ids {
+			if err := deadLetters.Replay(ctx, id); err != nil {
+				log.Error().Err(err).Int64("id", id).Msg("replay failed")
+				failed++
+				continue
+			}
+			log.Info().Int64("id", id).Msg("replayed")
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+
+	case "load":
+		n, err := deadLetters.ImportSpool(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load dead-letter spool")
+		}
+		log.Info().Int("entries", n).Str("file", cfg.WriterDeadLetterSpool).Msg("spool loaded")
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown deadletter command %q\n", args[0])
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/transcript"
+	"github.com/rs/zerolog/log"
+)
+
+// runExport implements `sidekick export`:
+//
+//	export conversation <id> [-format markdown|html|json] [-o file]   transcript of a conversation
+//	export request <id> [-format markdown|html|json] [-o file]        transcript of one request
+//	export requests [-dir dir] [-format jsonl|parquet] [filters]      requests in bulk (see exportRequests)
+func runExport(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: sidekick export conversation|request <id> [-format markdown|html|json] [-o file]")
+		fmt.Fprintln(os.Stderr, "       sidekick export requests [-dir dir] [-format jsonl|parquet] [-payloads] [-tools] [filters]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "conversation", "request":
+		fs := flag.NewFlagSet("export "+args[0], flag.ExitOnError)
+		format := fs.String("format", "markdown", "output format: "+strings.Join(transcript.Formats, ", "))
+		out := fs.String("o", "", "write to this file instead of stdout")
+		id := parseWithArg(fs, args[1:])
+		if id == "" {
+			fmt.Fprintf(os.Stderr, "usage: sidekick export %s <id> [-format markdown|html|json] [-o file]\n", args[0])
+			os.Exit(2)
+		}
+		if !slices.Contains(transcript.Formats, *format) {
+			log.Fatal().Str("format", *format).Msg("unknown format")
+		}
+
+		ctx := context.Background()
+		js, closeJS := commandJetStream(cfg)
+		defer closeJS()
+		store, err := openStore(ctx, cfg, js)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open storage")
+		}
+		defer store.Close()
+
+		var t *transcript.Transcript
+		if args[0] == "conversation" {
+			t, err = transcript.Conversation(ctx, store, id)
+		} else {
+			requestID, perr := uuid.Parse(id)
+			if perr != nil {
+				log.Fatal().Str("id", id).Msg("invalid request ID")
+			}
+			t, err = transcript.Request(ctx, store, requestID)
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Fatal().Str("id", id).Msgf("no such %s", args[0])
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to build transcript")
+		}
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to create output file")
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := transcript.Render(w, t, *format); err != nil {
+			log.Fatal().Err(err).Msg("failed to write transcript")
+		}
+
+	case "requests":
+		exportRequests(cfg, args[1:])
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown export command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// parseWithArg parses flags placed before or after a single positional
+// argument and returns the argument.
+func parseWithArg(fs *flag.FlagSet, args []string) string {
+	var arg string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		arg, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if arg == "" && fs.NArg() > 0 {
+		arg = fs.Arg(0)
+	}
+	return arg
+}
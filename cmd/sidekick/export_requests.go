@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/export"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	manifestFile   = "manifest.json"
+	exportPageSize = 500
+)
+
+// exportParams are the flags an export was started with. Resuming requires
+// the same ones.
+type exportParams struct {
+	Format       string `json:"format"`
+	From         string `json:"from,omitempty"`
+	To           string `json:"to,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Status       string `json:"status,omitempty"`
+	Key          string `json:"key,omitempty"`
+	Conversation string `json:"conversation,omitempty"`
+	Agent        string `json:"agent,omitempty"`
+	StopReason   string `json:"stop_reason,omitempty"`
+	Query        string `json:"q,omitempty"`
+	Payloads     bool   `json:"payloads"`
+	Tools        bool   `json:"tools"`
+	ChunkRows    int    `json:"chunk_rows"`
+}
+
+// exportManifest records an export's progress in its directory. Until is
+// the end of the exported range, fixed when the export starts so that a
+// resumed export does not pick up newer traffic.
+type exportManifest struct {
+	Params exportParams           `json:"params"`
+	Until  time.Time              `json:"until"`
+	Chunks []exportChunk          `json:"chunks"`
+	Cursor *storage.RequestCursor `json:"cursor,omitempty"`
+	Done   bool                   `json:"done"`
+}
+
+type exportChunk struct {
+	File  string    `json:"file"`
+	Rows  int       `json:"rows"`
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// exportRequests implements `sidekick export requests`: it writes requests
+// matching the filters, oldest first, into numbered chunk files of at most
+// -chunk-rows rows, plus a manifest.json recording progress. Run again with
+// the same flags and directory, it resumes after the last complete chunk.
+func exportRequests(cfg *config.Config, args []string) {
+	var p exportParams
+	fs := flag.NewFlagSet("export requests", flag.ExitOnError)
+	dir := fs.String("dir", "sidekick-export", "output directory")
+	fs.StringVar(&p.Format, "format", "jsonl", "output format: jsonl or parquet")
+	fs.StringVar(&p.From, "from", "", "start of the range (RFC 3339 or YYYY-MM-DD, inclusive)")
+	fs.StringVar(&p.To, "to", "", "end of the range (RFC 3339 or YYYY-MM-DD, exclusive; default: now)")
+	fs.StringVar(&p.Model, "model", "", "only this model")
+	fs.StringVar(&p.Status, "status", "", "only this status code, or success, error or incomplete")
+	fs.StringVar(&p.Key, "key", "", "only this key fingerprint")
+	fs.StringVar(&p.Conversation, "conversation", "", "only this conversation")
+	fs.StringVar(&p.Agent, "agent", "", "only this agent")
+	fs.StringVar(&p.StopReason, "stop-reason", "", "only this stop reason")
+	fs.StringVar(&p.Query, "q", "", "only requests matching this full-text query")
+	fs.BoolVar(&p.Payloads, "payloads", false, "include system prompts and request and response bodies")
+	fs.BoolVar(&p.Tools, "tools", false, "include the tool calls of each response")
+	fs.IntVar(&p.ChunkRows, "chunk-rows", 100000, "rows per chunk file")
+	fs.Parse(args)
+
+	if !slices.Contains(export.Formats, p.Format) {
+		log.Fatal().Str("format", p.Format).Msg("unknown format")
+	}
+	if p.ChunkRows < 1 {
+		log.Fatal().Int("chunk_rows", p.ChunkRows).Msg("invalid chunk size")
+	}
+	f, err := p.filter()
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid filter")
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		log.Fatal().Err(err).Msg("failed to create output directory")
+	}
+	m, err := readManifest(*dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		m = &exportManifest{Params: p, Until: f.To}
+		if m.Until.IsZero() {
+			m.Until = time.Now().UTC()
+		}
+	case err != nil:
+		log.Fatal().Err(err).Msg("failed to read manifest")
+	case m.Params != p:
+		log.Fatal().Str("dir", *dir).Msg("directory holds an export with different flags; use another directory")
+	case m.Done:
+		log.Info().Str("dir", *dir).Int("chunks", len(m.Chunks)).Msg("export already complete")
+		return
+	default:
+		log.Info().Str("dir", *dir).Int("chunks", len(m.Chunks)).Msg("resuming export")
+	}
+	f.To = m.Until
+
+	ctx := context.Background()
+	js, closeJS := commandJetStream(cfg)
+	defer closeJS()
+	store, err := openStore(ctx, cfg, js)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open storage")
+	}
+	defer store.Close()
+
+	opts := export.Options{Payloads: p.Payloads, ToolCalls: p.Tools}
+	if err := exportChunks(ctx, store, *dir, m, f, opts); err != nil {
+		log.Fatal().Err(err).Msg("export failed")
+	}
+
+	rows := 0
+	for _, c := range m.Chunks {
+		rows += c.Rows
+	}
+	log.Info().Str("dir", *dir).Int("chunks", len(m.Chunks)).Int("rows", rows).Msg("export complete")
+}
+
+// exportChunks writes chunks after the last one recorded in m, updating the
+// manifest in dir after each, until no requests are left.
+func exportChunks(ctx context.Context, store storage.Store, dir string, m *exportManifest, f storage.RequestFilter, opts export.Options) error {
+	for !m.Done {
+		chunk, cursor, more, err := writeChunk(ctx, store, dir, len(m.Chunks), f, m.Cursor, &m.Params, opts)
+		if err != nil {
+			return err
+		}
+		if chunk.Rows > 0 {
+			m.Chunks = append(m.Chunks, chunk)
+			log.Info().Str("file", chunk.File).Int("rows", chunk.Rows).Msg("wrote chunk")
+		}
+		m.Cursor, m.Done = cursor, !more
+		if err := writeManifest(dir, m); err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeChunk writes the next chunk file, through a temporary file so that
+// only complete chunks carry its name. An empty chunk leaves no file.
+func writeChunk(ctx context.Context, store storage.Store, dir string, n int, f storage.RequestFilter,
+	after *storage.RequestCursor, p *exportParams, opts export.Options) (exportChunk, *storage.RequestCursor, bool, error) {
+	chunk := exportChunk{File: fmt.Sprintf("requests-%05d.%s", n, p.Format)}
+	path := filepath.Join(dir, chunk.File)
+	out, err := os.Create(path + ".tmp")
+	if err != nil {
+		return chunk, nil, false, err
+	}
+	defer out.Close()
+	w, err := export.NewWriter(out, p.Format)
+	if err != nil {
+		return chunk, nil, false, err
+	}
+
+	cursor, more := after, true
+	for more && chunk.Rows < p.ChunkRows {
+		var reqs []storage.Request
+		reqs, more, err = export.Page(ctx, store, f, cursor, min(exportPageSize, p.ChunkRows-chunk.Rows))
+		if err != nil {
+			return chunk, nil, false, err
+		}
+		if len(reqs) == 0 {
+			break
+		}
+		if err := export.WriteRows(ctx, store, w, reqs, opts); err != nil {
+			return chunk, nil, false, err
+		}
+		if chunk.Rows == 0 {
+			chunk.First = reqs[0].Timestamp.UTC()
+		}
+		last := reqs[len(reqs)-1]
+		chunk.Rows += len(reqs)
+		chunk.Last = last.Timestamp.UTC()
+		cursor = &storage.RequestCursor{TS: last.Timestamp, ID: last.ID}
+	}
+
+	if err := w.Close(); err != nil {
+		return chunk, nil, false, err
+	}
+	if err := out.Close(); err != nil {
+		return chunk, nil, false, err
+	}
+	if chunk.Rows == 0 {
+		return chunk, cursor, more, os.Remove(path + ".tmp")
+	}
+	return chunk, cursor, more, os.Rename(path+".tmp", path)
+}
+
+func (p *exportParams) filter() (storage.RequestFilter, error) {
+	f := storage.RequestFilter{
+		Model:        p.Model,
+		Key:          p.Key,
+		Conversation: p.Conversation,
+		Agent:        p.Agent,
+		StopReason:   p.StopReason,
+		Text:         p.Query,
+	}
+	var err error
+	if f.From, err = parseTime(p.From); err != nil {
+		return f, fmt.Errorf("invalid -from: %w", err)
+	}
+	if f.To, err = parseTime(p.To); err != nil {
+		return f, fmt.Errorf("invalid -to: %w", err)
+	}
+	switch p.Status {
+	case "":
+	case storage.OutcomeSuccess, storage.OutcomeError, storage.OutcomeIncomplete:
+		f.Outcome = p.Status
+	default:
+		if f.StatusCode, err = strconv.Atoi(p.Status); err != nil {
+			return f, fmt.Errorf("invalid -status %q: want a status code, success, error or incomplete", p.Status)
+		}
+	}
+	return f, nil
+}
+
+// parseTime accepts RFC 3339 timestamps and dates (midnight UTC); empty is
+// the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func readManifest(dir string) (*exportManifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m exportManifest
+	return &m, json.Unmarshal(b, &m)
+}
+
+// writeManifest replaces the manifest atomically.
+func writeManifest(dir string, m *exportManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, manifestFile)
+	if err := os.WriteFile(path+".tmp", append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/export"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/storage/sqlite"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExportResumesFromManifest(t *testing.T) {
+	ctx := context.Background()
+	store, err := sqlite.Open(ctx, filepath.Join(t.TempDir(), "sidekick.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	var ids []uuid.UUID
+	for i := range 5 {
+		id := uuid.New()
+		ids = append(ids, id)
+		err := store.UpsertRequest(ctx, &storage.RequestRecord{
+			ID: id, Timestamp: base.Add(time.Duration(i) * time.Second),
+			Method: "POST", Path: "/v1/messages", StatusCode: 200, Success: true, Model: "claude-sonnet-4-5",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	m := &exportManifest{Params: exportParams{Format: "parquet", ChunkRows: 2}, Until: base.Add(time.Hour)}
+	f := storage.RequestFilter{To: m.Until}
+	var opts export.Options
+
+	// An export that died after its first chunk, halfway through the second.
+	chunk, cursor, more, err := writeChunk(ctx, store, dir, 0, f, nil, &m.Params, opts)
+	if err != nil || !more {
+		t.Fatalf("first chunk: more = %v, err = %v", more, err)
+	}
+	m.Chunks, m.Cursor = append(m.Chunks, chunk), cursor
+	if err := writeManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "requests-00001.parquet.tmp"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exportChunks(ctx, store, dir, m, f, opts); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = readManifest(dir); err != nil || !m.Done {
+		t.Fatalf("manifest after resuming: %+v, %v", m, err)
+	}
+
+	var got []uuid.UUID
+	for i, c := range m.Chunks {
+		if want := []int{2, 2, 1}[i]; c.Rows != want {
+			t.Errorf("chunk %d has %d rows; want %d", i, c.Rows, want)
+		}
+		rows, err := parquet.ReadFile[export.Row](filepath.Join(dir, c.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != c.Rows || !rows[0].Timestamp.Equal(c.First) || !rows[len(rows)-1].Timestamp.Equal(c.Last) {
+			t.Errorf("chunk %s holds %d rows from %v to %v; manifest says %+v", c.File, len(rows), rows[0].Timestamp, rows[len(rows)-1].Timestamp, c)
+		}
+		for _, r := range rows {
+			got = append(got, r.ID)
+		}
+	}
+	if len(m.Chunks) != 3 || len(got) != len(ids) {
+		t.Fatalf("%d chunks with %d rows; want 3 with %d", len(m.Chunks), len(got), len(ids))
+	}
+	for i := range ids {
+		if got[i] != ids[i] {
+			t.Errorf("row %d = %s; want %s", i, got[i], ids[i])
+		}
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmp) != 0 {
+		t.Errorf("temporary files left: %v", tmp)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/namikmesic/claude-sidekick/internal/claudecode"
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// runImport implements `sidekick import`:
+//
+//	import claude-code [dir]   load Claude Code transcripts (default ~/.claude/projects)
+func runImport(cfg *config.Config, args []string) {
+	if len(args) == 0 || args[0] != "claude-code" {
+		fmt.Fprintln(os.Stderr, "usage: sidekick import claude-code [dir]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("import claude-code", flag.ExitOnError)
+	dir := parseWithArg(fs, args[1:])
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatal().Err(err).Msg("no directory given and no home directory")
+		}
+		dir = filepath.Join(home, ".claude", "projects")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		log.Fatal().Err(err).Msg("cannot read transcript directory")
+	}
+
+	ctx := context.Background()
+	js, closeJS := commandJetStream(cfg)
+	defer closeJS()
+	store, err := openStore(ctx, cfg, js)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open storage")
+	}
+	defer store.Close()
+
+	st, err := claudecode.Import(ctx, store, dir)
+	ev := log.Info()
+	if err != nil {
+		ev = log.Error().Err(err)
+	}
+	ev.Str("dir", dir).Int("files", st.Files).Int("calls", st.Calls).
+		Int("imported", st.Imported).Int("already_stored", st.Existing).Int("skipped_lines", st.Skipped).
+		Msg("import finished")
+	if err != nil {
+		os.Exit(1)
+	}
+}
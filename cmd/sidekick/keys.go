@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/envelope"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// runKeys implements `sidekick keys`:
+//
+//	keys generate [id]   print a new master key entry for ENCRYPTION_KEYS
+//	keys rotate          re-wrap all data keys (rows and offloaded blobs) under
+//	                     ENCRYPTION_ACTIVE_KEY and encrypt anything still
+//	                     stored in plaintext
+//
+// To rotate, prepend a new key to ENCRYPTION_KEYS (keeping the old ones so
+// existing rows stay readable), restart, then run `keys rotate`. Once it
+// reports zero remaining rows the old keys can be removed.
+func runKeys(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: sidekick keys generate [id] | rotate")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "generate":
+		id := "k1"
+		if len(args) > 1 {
+			id = args[1]
+		}
+		key, err := envelope.GenerateKey()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to generate key")
+		}
+		fmt.Printf("%s:%s\n", id, key)
+
+	case "rotate":
+		ctx := context.Background()
+		js, closeJS := commandJetStream(cfg)
+		defer closeJS()
+		store, err := openStore(ctx, cfg, js)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open storage")
+		}
+		defer store.Close()
+
+		rotator, ok := store.(storage.Rotator)
+		if !ok || cfg.EncryptionKeys == "" {
+			log.Fatal().Msg("ENCRYPTION_KEYS is not set")
+		}
+		n, err := rotator.Rotate(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Int("rows", n).Msg("key rotation failed")
+		}
+		log.Info().Int("rows", n).Msg("key rotation complete")
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown keys command %q\n", args[0])
+		os.Exit(2)
+	}
+}
@@ -3,17 +3,30 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/namikmesic/claude-sidekick/internal/admin"
+	"github.com/namikmesic/claude-sidekick/internal/api"
+	"github.com/namikmesic/claude-sidekick/internal/budget"
+	"github.com/namikmesic/claude-sidekick/internal/cluster"
 	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/dashboard"
+	"github.com/namikmesic/claude-sidekick/internal/events"
 	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+	"github.com/namikmesic/claude-sidekick/internal/live"
+	"github.com/namikmesic/claude-sidekick/internal/metrics"
 	"github.com/namikmesic/claude-sidekick/internal/processor"
 	"github.com/namikmesic/claude-sidekick/internal/proxy"
+	"github.com/namikmesic/claude-sidekick/internal/replay"
 	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/vcr"
+	"github.com/namikmesic/claude-sidekick/internal/webhook"
+	nats "github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -32,44 +45,240 @@ func main() {
 	zerolog.SetGlobalLevel(level)
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "15:04:05"})
 
-	ctx := context.Background()
-	pool, err := storage.NewPool(ctx, cfg.DatabaseURL)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to connect to database")
+	args := os.Args[1:]
+	if len(args) == 0 {
+		serve(cfg)
+		return
 	}
-	defer pool.Close()
+	switch args[0] {
+	case "serve":
+		serve(cfg)
+	case "deadletter":
+		runDeadLetter(cfg, args[1:])
+	case "keys":
+		runKeys(cfg, args[1:])
+	case "accounts":
+		runAccounts(cfg, args[1:])
+	case "webhooks":
+		runWebhooks(cfg, args[1:])
+	case "export":
+		runExport(cfg, args[1:])
+	case "import":
+		runImport(cfg, args[1:])
+	case "replay":
+		runReplay(cfg, args[1:])
+	case "reindex":
+		runReindex(cfg, args[1:])
+	case "mock-upstream":
+		runMockUpstream(cfg, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+}
 
-	if err := storage.RunMigrations(ctx, pool); err != nil {
-		log.Fatal().Err(err).Msg("failed to run migrations")
+const usage = `usage: sidekick [command]
+
+commands:
+  serve                       run the proxy (default)
+  deadletter list|replay|load inspect and re-apply failed write jobs
+  keys generate|rotate        manage encryption-at-rest master keys
+  accounts set|get|list       store and read upstream account credentials
+  webhooks log|test           inspect webhook deliveries, send a test event
+  export conversation|request write a transcript as Markdown, HTML or JSON
+  export requests             export requests in bulk as JSON Lines or Parquet
+  import claude-code [dir]    backfill history from Claude Code transcripts
+  replay <request-id>         resend a stored request and diff the responses
+  reindex                     make requests recorded before search searchable
+  mock-upstream               serve a mock Anthropic API for local development
+`
+
+func writerOptions(cfg *config.Config, cipher storage.Cipher) storage.WriterOptions {
+	return storage.WriterOptions{
+		BufferSize:     cfg.WriterBufferSize,
+		BatchSize:      cfg.WriterBatchSize,
+		FlushMs:        cfg.WriterFlushMs,
+		MaxAttempts:    cfg.WriterMaxAttempts,
+		RetryBackoff:   time.Duration(cfg.WriterRetryBackoffMs) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.WriterMaxBackoffMs) * time.Millisecond,
+		DeadLetterFile: cfg.WriterDeadLetterSpool,
+		Cipher:         cipher,
 	}
+}
 
-	natsServer, err := jetstream.NewServer(cfg.NATSStoreDir)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to start embedded NATS")
+// vcrPlayer returns the playback player, or nil when VCR_MODE is off.
+func vcrPlayer(cfg *config.Config, store storage.Store) (*vcr.Player, error) {
+	if cfg.VCROnMiss != vcr.MissFail && cfg.VCROnMiss != vcr.MissRecord {
+		return nil, fmt.Errorf("unknown VCR_ON_MISS %q", cfg.VCROnMiss)
+	}
+	switch cfg.VCRMode {
+	case "", "off":
+		return nil, nil
+	case vcr.ModeRecord:
+		log.Info().Msg("VCR recording enabled")
+		return nil, nil
+	case vcr.ModePlayback:
+		log.Info().
+			Str("on_miss", cfg.VCROnMiss).
+			Float64("speed", cfg.VCRSpeed).
+			Msg("VCR playback enabled")
+		return vcr.NewPlayer(store, cfg.VCRSpeed, cfg.VCROnMiss == vcr.MissRecord), nil
+	default:
+		return nil, fmt.Errorf("unknown VCR_MODE %q", cfg.VCRMode)
 	}
+}
+
+// registerMetrics exposes the state of the writer, the stream consumer and
+// its JetStream backlog as gauges read at scrape time.
+func registerMetrics(writer *storage.BatchWriter, proc *processor.Processor, js nats.JetStreamContext) {
+	metrics.Gauge("writer", "queue_depth", "Write jobs waiting to be written.", func() float64 {
+		return float64(writer.QueueDepth())
+	})
+	metrics.Gauge("consumer", "open_streams", "Streams this replica is proxying and has not published the end of yet.", func() float64 {
+		return float64(proc.Stats().OpenStreams)
+	})
+	metrics.Gauge("consumer", "open_stream_bytes", "Bytes of the chunks of this replica's open streams.", func() float64 {
+		return float64(proc.Stats().OpenStreamBytes)
+	})
+	metrics.Gauge("consumer", "writing_streams", "Finished streams being written by this replica.", func() float64 {
+		return float64(proc.Stats().InFlight)
+	})
+	metrics.Counter("consumer", "evicted_streams_total", "Streams given up on after STREAM_IDLE_TTL_SEC without chunks.", func() float64 {
+		return float64(proc.Stats().Evicted)
+	})
+	metrics.GaugeGroup("jetstream", []metrics.GaugeDesc{
+		{Name: "consumer_pending", Help: "Finished streams not yet delivered to a processor."},
+		{Name: "consumer_ack_pending", Help: "Finished streams delivered but not yet written."},
+	}, func() ([]float64, error) {
+		ci, err := js.ConsumerInfo(jetstream.StreamName, jetstream.ConsumerName)
+		if err != nil {
+			return nil, err
+		}
+		return []float64{float64(ci.NumPending), float64(ci.NumAckPending)}, nil
+	})
+}
 
-	nc, err := natsServer.Connect()
+func serve(cfg *config.Config) {
+	ctx := context.Background()
+	nc, closeNATS, err := connectNATS(cfg, true)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to connect to embedded NATS")
+		log.Fatal().Err(err).Msg("failed to connect to NATS")
 	}
-	defer nc.Drain()
+	defer closeNATS()
 
 	js, err := nc.JetStream()
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to get JetStream context")
 	}
-	if err := jetstream.EnsureStream(js); err != nil {
+	streamOpts, err := streamOptions(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid stream settings")
+	}
+	err = waitJetStream(ctx, func() error {
+		return jetstream.EnsureStream(js, streamOpts)
+	})
+	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create JetStream stream")
 	}
+	err = jetstream.EnsureConsumer(js, jetstream.ConsumerOptions{
+		AckWait:       time.Duration(cfg.ConsumerAckWaitSec) * time.Second,
+		MaxAckPending: cfg.ConsumerMaxAckPending,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create JetStream consumer")
+	}
+
+	registry, err := cluster.Join(js, cfg.InstanceID, cfg.NATSStreamReplicas)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to join cluster registry")
+	}
+	registryCtx, registryCancel := context.WithCancel(ctx)
+	defer registryCancel()
+	registryDone := make(chan struct{})
+	go func() {
+		registry.Run(registryCtx)
+		close(registryDone)
+	}()
+
+	store, err := openStore(ctx, cfg, js)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open storage")
+	}
+	defer store.Close()
+
+	cipher, err := loadCipher(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load encryption keys")
+	}
 
-	writer := storage.NewBatchWriter(pool, cfg.WriterBufferSize, cfg.WriterBatchSize, cfg.WriterFlushMs)
-	proc := processor.New(writer)
+	writer := storage.NewBatchWriter(store, writerOptions(cfg, cipher))
+
+	err = events.EnsureStream(js, events.StreamOptions{
+		Replicas: cfg.NATSStreamReplicas,
+		MaxAge:   time.Duration(cfg.EventsMaxAgeSec) * time.Second,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create events stream")
+	}
+	// Tool inputs are prompt content: keep them out of the events stream
+	// when content is encrypted at rest, unless asked for.
+	eventPub, err := events.NewPublisher(nc, cfg.EncryptionKeys == "" || cfg.EventsToolInput)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create event publisher")
+	}
+	budgets, err := budget.NewTracker(js, budget.Limits{
+		DailyUSD:   cfg.BudgetDailyUSD,
+		MonthlyUSD: cfg.BudgetMonthlyUSD,
+		Thresholds: cfg.BudgetThresholds,
+	}, cfg.NATSStreamReplicas, eventPub)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open budgets")
+	}
+	proc := processor.New(writer, eventPub, budgets)
+	registerMetrics(writer, proc, js)
 
+	webhookCtx, webhookCancel := context.WithCancel(ctx)
+	defer webhookCancel()
+	webhookDone := make(chan struct{})
+	if cfg.WebhooksFile != "" {
+		endpoints, err := webhook.LoadEndpoints(cfg.WebhooksFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load webhooks")
+		}
+		opts := webhookOptions(cfg)
+		if err := webhook.EnsureConsumers(js, endpoints, opts); err != nil {
+			log.Fatal().Err(err).Msg("failed to create webhook consumers")
+		}
+		dispatcher := webhook.NewDispatcher(endpoints, writer, opts)
+		go func() {
+			dispatcher.Run(webhookCtx, js)
+			close(webhookDone)
+		}()
+		log.Info().Int("endpoints", len(endpoints)).Msg("webhook dispatcher started")
+	} else {
+		close(webhookDone)
+	}
+
+	sweep, err := cluster.NewLease(js, "stream-sweep", cfg.InstanceID, cfg.NATSStreamReplicas)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open stream sweep lease")
+	}
 	consumerCtx, consumerCancel := context.WithCancel(ctx)
 	defer consumerCancel()
-	go proc.StartConsumer(consumerCtx, js)
+	consumerDone := make(chan struct{})
+	go func() {
+		proc.StartConsumer(consumerCtx, nc, processor.ConsumerOptions{
+			StreamTTL: time.Duration(cfg.StreamIdleTTLSec) * time.Second,
+			Sweep:     sweep,
+		})
+		close(consumerDone)
+	}()
 
-	handler := proxy.NewHandler(cfg, writer, proc, js)
+	player, err := vcrPlayer(cfg, store)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid VCR settings")
+	}
+	handler := proxy.NewHandler(cfg, writer, proc, js, live.NewPublisher(nc), player)
 
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	server := &http.Server{
@@ -90,6 +299,39 @@ func main() {
 		}
 	}()
 
+	var adminServer *http.Server
+	// Cancelled before shutdown so long-lived live tails let go.
+	adminCtx, adminCancel := context.WithCancel(ctx)
+	defer adminCancel()
+	if cfg.AdminAddr != "" {
+		hub, err := live.NewHub(nc, time.Duration(cfg.StreamIdleTTLSec)*time.Second)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to start live feed")
+		}
+		defer hub.Close()
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/admin/", admin.NewHandler(proc, hub, registry, js, budgets))
+		var replayer *replay.Replayer
+		if cfg.ReplayAPI {
+			replayer = replay.NewReplayer(store, cfg.ReplayProxyURL, cfg.ReplayAPIKey)
+		}
+		adminMux.Handle("/api/", api.NewHandler(store, replayer))
+		adminMux.Handle(dashboard.Prefix, dashboard.Handler())
+		adminMux.Handle("GET /metrics", metrics.Handler())
+		adminMux.Handle("GET /{$}", http.RedirectHandler(dashboard.Prefix, http.StatusFound))
+		adminServer = &http.Server{
+			Addr:        cfg.AdminAddr,
+			Handler:     adminMux,
+			BaseContext: func(net.Listener) context.Context { return adminCtx },
+		}
+		go func() {
+			log.Info().Str("addr", cfg.AdminAddr).Msg("admin listener started")
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal().Err(err).Msg("admin server error")
+			}
+		}()
+	}
+
 	<-done
 	log.Info().Msg("shutting down...")
 
@@ -97,9 +339,19 @@ func main() {
 	defer cancel()
 
 	server.Shutdown(shutdownCtx)
+	if adminServer != nil {
+		adminCancel()
+		adminServer.Shutdown(shutdownCtx)
+	}
 	consumerCancel()
-	nc.Drain()
-	natsServer.Shutdown()
+	<-consumerDone
+	webhookCancel()
+	<-webhookDone
+	// Flush the writer while NATS is still up so settled requests get acked;
+	// anything unacked is redelivered on the next start.
 	writer.Shutdown()
+	registryCancel()
+	<-registryDone
+	closeNATS()
 	log.Info().Msg("shutdown complete")
 }
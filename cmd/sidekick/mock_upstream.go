@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/mockupstream"
+	"github.com/rs/zerolog/log"
+)
+
+// runMockUpstream implements `sidekick mock-upstream`: it serves a mock of
+// the Anthropic API to point ANTHROPIC_UPSTREAM_URL at.
+func runMockUpstream(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("mock-upstream", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:9090", "address to listen on")
+	script := fs.String("script", "", "JSON file of scripted responses (see mock-upstream.example.json)")
+	latency := fs.Duration("latency", 0, "time to the response headers")
+	chunkDelay := fs.Duration("chunk-delay", 0, "time between the deltas of streamed responses")
+	fs.Parse(args)
+
+	var rules []mockupstream.Rule
+	if *script != "" {
+		var err error
+		if rules, err = mockupstream.LoadScript(*script); err != nil {
+			log.Fatal().Err(err).Msg("failed to load script")
+		}
+	}
+	log.Info().
+		Str("addr", *addr).
+		Int("rules", len(rules)).
+		Dur("latency", *latency).
+		Dur("chunk_delay", *chunkDelay).
+		Msg("mock upstream started")
+	server := mockupstream.NewServer(rules, *latency, *chunkDelay)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		log.Fatal().Err(err).Msg("mock upstream error")
+	}
+}
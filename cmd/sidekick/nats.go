@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// connectNATS connects to NATS_URL when set, otherwise starts the embedded
+// server (with the external listener when listen is true). The returned
+// close func drains the connection and stops the embedded server; it is
+// safe to call more than once.
+func connectNATS(cfg *config.Config, listen bool) (*nats.Conn, func(), error) {
+	if cfg.NATSURL != "" {
+		if cfg.NATSListenAddr != "" {
+			log.Warn().Msg("NATS_LISTEN_ADDR is ignored when NATS_URL is set")
+		}
+		nc, err := jetstream.Dial(jetstream.ClientOptions{
+			URL:      cfg.NATSURL,
+			Creds:    cfg.NATSCreds,
+			User:     cfg.NATSUser,
+			Password: cfg.NATSPassword,
+			TLSCA:    cfg.NATSTLSCA,
+			TLSCert:  cfg.NATSTLSCert,
+			TLSKey:   cfg.NATSTLSKey,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Info().Str("url", nc.ConnectedUrlRedacted()).Msg("connected to external NATS")
+		return nc, sync.OnceFunc(func() { nc.Drain() }), nil
+	}
+
+	var listenOpts *jetstream.ListenOptions
+	if listen {
+		listenOpts = natsListenOptions(cfg)
+	}
+	var clusterOpts *jetstream.ClusterOptions
+	if cfg.NATSClusterAddr != "" {
+		clusterOpts = &jetstream.ClusterOptions{
+			ServerName: cfg.InstanceID,
+			Name:       cfg.NATSClusterName,
+			Addr:       cfg.NATSClusterAddr,
+			Routes:     cfg.NATSClusterRoutes,
+			User:       cfg.NATSClusterUser,
+			Password:   cfg.NATSClusterPassword,
+			TLSCert:    cfg.NATSClusterTLSCert,
+			TLSKey:     cfg.NATSClusterTLSKey,
+			TLSCA:      cfg.NATSClusterTLSCA,
+		}
+	}
+	natsServer, err := jetstream.NewServer(cfg.NATSStoreDir, listenOpts, clusterOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if clusterOpts != nil {
+		log.Info().
+			Str("cluster", clusterOpts.Name).
+			Str("addr", clusterOpts.Addr).
+			Strs("routes", clusterOpts.Routes).
+			Msg("embedded NATS joined cluster")
+	}
+	if listenOpts != nil {
+		log.Info().Str("addr", cfg.NATSListenAddr).Msg("NATS listener started (read-only sidekick.> for external users)")
+	}
+	nc, err := natsServer.Connect()
+	if err != nil {
+		natsServer.Shutdown()
+		return nil, nil, err
+	}
+	return nc, sync.OnceFunc(func() {
+		nc.Drain()
+		natsServer.Shutdown()
+	}), nil
+}
+
+// natsListenOptions returns the external listener config for the embedded
+// NATS server, or nil when NATS_LISTEN_ADDR is unset.
+func natsListenOptions(cfg *config.Config) *jetstream.ListenOptions {
+	if cfg.NATSListenAddr == "" {
+		return nil
+	}
+	return &jetstream.ListenOptions{
+		Addr:     cfg.NATSListenAddr,
+		User:     cfg.NATSListenUser,
+		Password: cfg.NATSListenPassword,
+		NKeys:    cfg.NATSListenNKeys,
+		TLSCert:  cfg.NATSListenTLSCert,
+		TLSKey:   cfg.NATSListenTLSKey,
+		TLSCA:    cfg.NATSListenTLSCA,
+	}
+}
+
+// commandJetStream connects maintenance commands to JetStream when blobs
+// live there. With the embedded server this starts it on NATS_STORE_DIR, so
+// the proxy must be stopped; with NATS_URL the commands can run alongside
+// it. Returns a nil context when JetStream is not needed.
+func commandJetStream(cfg *config.Config) (nats.JetStreamContext, func()) {
+	if cfg.BlobStore != "jetstream" {
+		return nil, func() {}
+	}
+	nc, closeNATS, err := connectNATS(cfg, false)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to NATS")
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to get JetStream context")
+	}
+	return js, closeNATS
+}
+
+func streamOptions(cfg *config.Config) (jetstream.StreamOptions, error) {
+	discard, err := jetstream.ParseDiscard(cfg.NATSStreamDiscard)
+	if err != nil {
+		return jetstream.StreamOptions{}, err
+	}
+	return jetstream.StreamOptions{
+		Replicas:   cfg.NATSStreamReplicas,
+		MaxAge:     time.Duration(cfg.NATSStreamMaxAgeSec) * time.Second,
+		MaxBytes:   cfg.NATSStreamMaxBytes,
+		MaxMsgs:    cfg.NATSStreamMaxMsgs,
+		MaxMsgSize: cfg.NATSStreamMaxMsgSize,
+		Discard:    discard,
+		Duplicates: time.Duration(cfg.NATSStreamDuplicatesSec) * time.Second,
+	}, nil
+}
+
+// waitJetStream retries fn while JetStream is still coming up. A clustered
+// JetStream answers only once its servers have elected a leader, which needs
+// a quorum of replicas to be running.
+func waitJetStream(ctx context.Context, fn func() error) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	for {
+		err := fn()
+		if err == nil || !jetstreamUnavailable(err) {
+			return err
+		}
+		log.Info().Err(err).Msg("waiting for JetStream")
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func jetstreamUnavailable(err error) bool {
+	var apiErr *nats.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == 503 {
+		return true
+	}
+	return errors.Is(err, nats.ErrTimeout) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, nats.ErrNoResponders) ||
+		errors.Is(err, nats.ErrJetStreamNotEnabled)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/rs/zerolog/log"
+)
+
+// runReindex implements `sidekick reindex`: it makes requests recorded
+// before full-text search existed searchable, by deriving their user and
+// response text from the stored bodies. Running it again only visits rows
+// still without text.
+func runReindex(cfg *config.Config, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: sidekick reindex")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	js, closeJS := commandJetStream(cfg)
+	defer closeJS()
+	store, err := openStore(ctx, cfg, js)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open storage")
+	}
+	defer store.Close()
+
+	n, err := store.BackfillSearchText(ctx, searchText)
+	if err != nil {
+		log.Fatal().Err(err).Int("rows", n).Msg("reindex failed")
+	}
+	log.Info().Int("rows", n).Msg("reindex complete")
+}
+
+// searchText derives what the proxy indexes for a request as it records it.
+func searchText(reqBody, respBody []byte) (string, string, error) {
+	userText := processor.ParseRequest(reqBody).UserText
+	var resp processor.AnthropicResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return userText, "", nil
+	}
+	return userText, resp.SearchText(), nil
+}
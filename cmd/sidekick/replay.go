@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/replay"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// runReplay implements `sidekick replay <request-id>`: it resends a stored
+// request through a running proxy and prints how the response differs.
+func runReplay(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	model := fs.String("model", "", "replay with this model")
+	temperature := fs.String("temperature", "", "replay with this temperature")
+	maxTokens := fs.Int("max-tokens", 0, "replay with this max_tokens")
+	proxyURL := fs.String("proxy", cfg.ReplayProxyURL, "proxy to send the replay through")
+	asJSON := fs.Bool("json", false, "print the diff as JSON")
+	arg := parseWithArg(fs, args)
+	if arg == "" {
+		fmt.Fprintln(os.Stderr, "usage: sidekick replay <request-id> [-model m] [-temperature t] [-max-tokens n] [-json]")
+		os.Exit(2)
+	}
+	id, err := uuid.Parse(arg)
+	if err != nil {
+		log.Fatal().Str("id", arg).Msg("invalid request ID")
+	}
+	o := replay.Overrides{Model: *model, MaxTokens: *maxTokens}
+	if *temperature != "" {
+		t, err := strconv.ParseFloat(*temperature, 64)
+		if err != nil {
+			log.Fatal().Str("temperature", *temperature).Msg("invalid temperature")
+		}
+		o.Temperature = &t
+	}
+
+	ctx := context.Background()
+	js, closeJS := commandJetStream(cfg)
+	defer closeJS()
+	store, err := openStore(ctx, cfg, js)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open storage")
+	}
+	defer store.Close()
+
+	res, err := replay.NewReplayer(store, *proxyURL, cfg.ReplayAPIKey).Replay(ctx, id, o)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Fatal().Str("id", arg).Msg("no such request")
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("replay failed")
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(res)
+		return
+	}
+	replay.WriteText(os.Stdout, res)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/envelope"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/storage/blob"
+	"github.com/namikmesic/claude-sidekick/internal/storage/sqlite"
+	"github.com/namikmesic/claude-sidekick/internal/storage/timescale"
+	nats "github.com/nats-io/nats.go"
+)
+
+// openStore connects to the configured storage backend and applies its
+// migrations. When encryption keys are configured the store seals payloads
+// at rest, and bodies over BLOB_THRESHOLD_BYTES are offloaded to the blob
+// store. js backs BLOB_STORE=jetstream and may be nil otherwise.
+func openStore(ctx context.Context, cfg *config.Config, js nats.JetStreamContext) (storage.Store, error) {
+	var store storage.Store
+	switch cfg.StorageBackend {
+	case "timescale", "postgres":
+		s, err := timescale.Open(ctx, cfg.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	case "sqlite":
+		s, err := sqlite.Open(ctx, cfg.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+
+	if err := store.Migrate(ctx); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("run migrations: %w", err)
+	}
+
+	cipher, err := loadCipher(cfg)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if cipher != nil {
+		store = storage.NewEncryptedStore(store, cipher)
+	}
+
+	blobs, err := openBlobStore(cfg, js)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if blobs != nil {
+		store = storage.NewOffloadStore(store, blobs, cfg.BlobThresholdBytes, cipher)
+	}
+	return store, nil
+}
+
+func openBlobStore(cfg *config.Config, js nats.JetStreamContext) (storage.BlobStore, error) {
+	switch cfg.BlobStore {
+	case "", "none":
+		return nil, nil
+	case "dir":
+		return blob.NewDir(cfg.BlobDir)
+	case "jetstream":
+		if js == nil {
+			return nil, fmt.Errorf("BLOB_STORE=jetstream requires a JetStream connection")
+		}
+		return blob.NewObjectStore(js, cfg.BlobBucket, cfg.NATSStreamReplicas)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.BlobStore)
+	}
+}
+
+// loadCipher returns the configured keyring, or nil when encryption at rest
+// is disabled.
+func loadCipher(cfg *config.Config) (storage.Cipher, error) {
+	if cfg.EncryptionKeys == "" {
+		return nil, nil
+	}
+	keyring, err := envelope.ParseKeyring(cfg.EncryptionKeys, cfg.EncryptionActiveKey)
+	if err != nil {
+		return nil, fmt.Errorf("load encryption keys: %w", err)
+	}
+	return keyring, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/config"
+	"github.com/namikmesic/claude-sidekick/internal/events"
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
+	"github.com/namikmesic/claude-sidekick/internal/webhook"
+	"github.com/rs/zerolog/log"
+)
+
+func webhookOptions(cfg *config.Config) webhook.Options {
+	return webhook.Options{
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+		Timeout:      time.Duration(cfg.WebhookTimeoutSec) * time.Second,
+		RetryBackoff: time.Duration(cfg.WebhookRetryBackoffMs) * time.Millisecond,
+		MaxBackoff:   time.Duration(cfg.WebhookMaxBackoffMs) * time.Millisecond,
+	}
+}
+
+// runWebhooks implements `sidekick webhooks`:
+//
+//	webhooks log [-endpoint name] [-failed] [-limit n]   print delivery attempts as JSON lines, newest first
+//	webhooks test <name>                                 send a sample request.completed event to an endpoint
+func runWebhooks(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: sidekick webhooks log|test")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "log":
+		fs := flag.NewFlagSet("webhooks log", flag.ExitOnError)
+		endpoint := fs.String("endpoint", "", "only this endpoint")
+		failed := fs.Bool("failed", false, "only failed attempts")
+		limit := fs.Int("limit", 100, "maximum number of entries")
+		fs.Parse(args[1:])
+
+		js, closeJS := commandJetStream(cfg)
+		defer closeJS()
+		store, err := openStore(ctx, cfg, js)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open storage")
+		}
+		defer store.Close()
+
+		deliveries, err := store.ListWebhookDeliveries(ctx, *endpoint, *failed, *limit)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to list webhook deliveries")
+		}
+		enc := json.NewEncoder(os.Stdout)
+		for _, d := range deliveries {
+			enc.Encode(d)
+		}
+
+	case "test":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: sidekick webhooks test <name>")
+			os.Exit(2)
+		}
+		if cfg.WebhooksFile == "" {
+			log.Fatal().Msg("WEBHOOKS_FILE is not set")
+		}
+		endpoints, err := webhook.LoadEndpoints(cfg.WebhooksFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load webhooks")
+		}
+		var ep *webhook.Endpoint
+		for i := range endpoints {
+			if endpoints[i].Name == args[1] {
+				ep = &endpoints[i]
+			}
+		}
+		if ep == nil {
+			log.Fatal().Str("webhook", args[1]).Msg("no such webhook")
+		}
+
+		now := time.Now().UTC()
+		usage := pricing.Usage{InputTokens: 1200, OutputTokens: 340}
+		data, _ := json.Marshal(events.RequestCompleted{
+			RequestID:  uuid.NewString(),
+			Timestamp:  now,
+			Model:      "claude-sonnet-4-5",
+			StopReason: "end_turn",
+			Usage:      usage,
+			CostUSD:    pricing.Cost("claude-sonnet-4-5", usage),
+		})
+		env := events.Envelope{
+			ID:      "test:" + uuid.NewString(),
+			Type:    events.RequestCompletedType,
+			Version: events.Version,
+			Time:    now,
+			Data:    data,
+		}
+		raw, _ := json.Marshal(env)
+
+		status, err := webhook.NewDispatcher(endpoints, nil, webhookOptions(cfg)).Send(ctx, ep, &env, raw, 1)
+		if err != nil {
+			log.Fatal().Err(err).Int("status", status).Msg("test delivery failed")
+		}
+		fmt.Printf("delivered, status %d\n", status)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown webhooks command %q\n", args[0])
+		os.Exit(2)
+	}
+}
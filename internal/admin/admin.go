@@ -0,0 +1,73 @@
+// Package admin serves sidekick's operational endpoints. They run on their
+// own listener, separate from the proxied API surface.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/namikmesic/claude-sidekick/internal/budget"
+	"github.com/namikmesic/claude-sidekick/internal/cluster"
+	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+	"github.com/namikmesic/claude-sidekick/internal/live"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// Handler routes the admin endpoints.
+type Handler struct {
+	mux     *http.ServeMux
+	proc    *processor.Processor
+	hub     *live.Hub
+	reg     *cluster.Registry
+	js      nats.JetStreamContext
+	budgets *budget.Tracker
+}
+
+func NewHandler(proc *processor.Processor, hub *live.Hub, reg *cluster.Registry, js nats.JetStreamContext, budgets *budget.Tracker) *Handler {
+	h := &Handler{mux: http.NewServeMux(), proc: proc, hub: hub, reg: reg, js: js, budgets: budgets}
+	h.mux.HandleFunc("GET /admin/status", h.status)
+	h.mux.HandleFunc("GET /admin/live", h.live)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+type statusResponse struct {
+	Instance string                  `json:"instance"`
+	Members  []cluster.Member        `json:"members"`
+	Consumer processor.ConsumerStats `json:"consumer"`
+	// JetStream is shared by all replicas; JetStreamError is set instead
+	// when it cannot be reached.
+	JetStream      *jetstream.Status `json:"jetstream,omitempty"`
+	JetStreamError string            `json:"jetstream_error,omitempty"`
+	Budgets        []budget.Window   `json:"budgets,omitempty"`
+}
+
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	resp := statusResponse{
+		Instance: h.reg.ID(),
+		Consumer: h.proc.Stats(),
+		Budgets:  h.budgets.Status(),
+	}
+	members, err := h.reg.Members()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to list cluster members")
+	}
+	resp.Members = members
+	if resp.JetStream, err = jetstream.GetStatus(h.js); err != nil {
+		resp.JetStreamError = err.Error()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("failed to write admin response")
+	}
+}
@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/live"
+)
+
+const liveHeartbeat = 15 * time.Second
+
+// live streams proxied traffic as server-sent events. Query parameters key,
+// model, agent and conversation filter the feed; deltas=true adds content
+// deltas of streamed responses.
+func (h *Handler) live(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	deltas, _ := strconv.ParseBool(q.Get("deltas"))
+	events, cancel := h.hub.Subscribe(live.Filter{
+		Key:          q.Get("key"),
+		Model:        q.Get("model"),
+		Agent:        q.Get("agent"),
+		Conversation: q.Get("conversation"),
+		Deltas:       deltas,
+	})
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev := <-events:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
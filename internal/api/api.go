@@ -0,0 +1,347 @@
+// Package api is the query API over stored traffic. It is served on the
+// admin listener and versioned by path; fields are only ever added within a
+// version. Replays are its only endpoint with side effects; they spend on
+// the upstream API, so they are only served when enabled with REPLAY_API.
+//
+//	GET /api/v1/requests                        list requests, newest first
+//	GET /api/v1/requests/{id}                   one request with its payload
+//	GET /api/v1/requests/{id}/events            the SSE event timeline of a streamed request
+//	GET /api/v1/requests/{id}/transcript        the request as a readable transcript (see transcript.go)
+//	POST /api/v1/requests/{id}/replay           resend the request and diff the responses (see replay.go)
+//	GET /api/v1/conversations/{id}/transcript   a whole conversation as a transcript
+//	GET /api/v1/stats/usage                     usage and cost over time (see stats.go)
+//	GET /api/v1/stats/breakdown                 usage and cost by model, agent, status, ...
+//	GET /api/v1/export                          requests in bulk as JSON Lines or Parquet (see export.go)
+//
+// Request listing filters, all optional: from, to (RFC 3339, to exclusive),
+// model, status (an HTTP status code, or success, error or incomplete), key
+// (key fingerprint), conversation, agent, stop_reason, q, limit (default 50,
+// at most 500) and cursor (the next_cursor of the previous page).
+//
+// q searches system prompts, user messages and responses: words and "quoted
+// phrases" must all match, "or" allows either of two terms and -word excludes
+// one. Listings filtered by q carry highlights, excerpts of the matching
+// fields per request ID with matches wrapped in <mark> (HTML-escaped).
+// With encryption at rest enabled content is not indexed and q is rejected
+// with 400.
+//
+// Errors are {"error": "..."} with a matching status code.
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/replay"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+type Handler struct {
+	mux      *http.ServeMux
+	store    storage.Store
+	replayer *replay.Replayer
+}
+
+// NewHandler returns the API over store. A nil replayer leaves the replay
+// endpoint out.
+func NewHandler(store storage.Store, replayer *replay.Replayer) *Handler {
+	h := &Handler{mux: http.NewServeMux(), store: store, replayer: replayer}
+	h.mux.HandleFunc("GET /api/v1/requests", h.listRequests)
+	h.mux.HandleFunc("GET /api/v1/requests/{id}", h.getRequest)
+	h.mux.HandleFunc("GET /api/v1/requests/{id}/events", h.listEvents)
+	h.mux.HandleFunc("GET /api/v1/requests/{id}/transcript", h.requestTranscript)
+	if replayer != nil {
+		h.mux.HandleFunc("POST /api/v1/requests/{id}/replay", h.replayRequest)
+	}
+	h.mux.HandleFunc("GET /api/v1/conversations/{id}/transcript", h.conversationTranscript)
+	h.mux.HandleFunc("GET /api/v1/stats/usage", h.usageOverTime)
+	h.mux.HandleFunc("GET /api/v1/stats/breakdown", h.usageBy)
+	h.mux.HandleFunc("GET /api/v1/export", h.export)
+	h.mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	})
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+type requestList struct {
+	Requests   []storage.Request              `json:"requests"`
+	Highlights map[string][]storage.Highlight `json:"highlights,omitempty"`
+	NextCursor string                         `json:"next_cursor,omitempty"`
+}
+
+func (h *Handler) listRequests(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r, defaultLimit, maxLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := f.Limit
+	// One extra row tells whether another page follows.
+	f.Limit++
+	reqs, err := h.store.ListRequests(r.Context(), f)
+	if errors.Is(err, storage.ErrSearchUnavailable) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list requests")
+		writeError(w, http.StatusInternalServerError, "failed to list requests")
+		return
+	}
+
+	resp := requestList{Requests: reqs}
+	if len(reqs) > limit {
+		resp.Requests = reqs[:limit]
+		last := resp.Requests[limit-1]
+		resp.NextCursor = encodeCursor(&storage.RequestCursor{TS: last.Timestamp, ID: last.ID})
+	}
+	if resp.Requests == nil {
+		resp.Requests = []storage.Request{}
+	}
+	if f.Text != "" && len(resp.Requests) > 0 {
+		if resp.Highlights, err = h.highlights(r, f.Text, resp.Requests); err != nil {
+			log.Error().Err(err).Msg("failed to highlight search results")
+			writeError(w, http.StatusInternalServerError, "failed to highlight search results")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+var markReplacer = strings.NewReplacer(storage.HighlightStart, "<mark>", storage.HighlightEnd, "</mark>")
+
+func (h *Handler) highlights(r *http.Request, text string, reqs []storage.Request) (map[string][]storage.Highlight, error) {
+	ids := make([]uuid.UUID, len(reqs))
+	for i, req := range reqs {
+		ids[i] = req.ID
+	}
+	found, err := h.store.Highlights(r.Context(), text, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]storage.Highlight, len(found))
+	for id, hs := range found {
+		for i := range hs {
+			hs[i].Snippet = markReplacer.Replace(html.EscapeString(hs[i].Snippet))
+		}
+		out[id.String()] = hs
+	}
+	return out, nil
+}
+
+// parseFilter reads the request listing filters; limit defaults to
+// defLimit and is capped at maxLimit.
+func parseFilter(r *http.Request, defLimit, maxLimit int) (*storage.RequestFilter, error) {
+	q := r.URL.Query()
+	f := &storage.RequestFilter{
+		Model:        q.Get("model"),
+		Key:          q.Get("key"),
+		Conversation: q.Get("conversation"),
+		Agent:        q.Get("agent"),
+		StopReason:   q.Get("stop_reason"),
+		Text:         strings.TrimSpace(q.Get("q")),
+		Limit:        defLimit,
+	}
+	var err error
+	if v := q.Get("from"); v != "" {
+		if f.From, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	switch v := q.Get("status"); v {
+	case "":
+	case storage.OutcomeSuccess, storage.OutcomeError, storage.OutcomeIncomplete:
+		f.Outcome = v
+	default:
+		if f.StatusCode, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid status %q: want a status code, success, error or incomplete", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 {
+			return nil, fmt.Errorf("invalid limit %q", v)
+		}
+		f.Limit = min(f.Limit, maxLimit)
+	}
+	if v := q.Get("cursor"); v != "" {
+		if f.After, err = decodeCursor(v); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Cursors are opaque to clients: base64 of "<unix nanos>:<request id>".
+func encodeCursor(c *storage.RequestCursor) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%s", c.TS.UnixNano(), c.ID))
+}
+
+func decodeCursor(s string) (*storage.RequestCursor, error) {
+	invalid := errors.New("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, invalid
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	c := &storage.RequestCursor{TS: time.Unix(0, n)}
+	if c.ID, err = uuid.Parse(id); err != nil {
+		return nil, invalid
+	}
+	return c, nil
+}
+
+type requestDetail struct {
+	Request *storage.Request `json:"request"`
+	Payload *payload         `json:"payload,omitempty"`
+}
+
+// payload holds a request's stored bodies. For streamed requests the
+// response body is the message reconstructed from the stream.
+type payload struct {
+	RequestHeaders  map[string][]string `json:"request_headers,omitempty"`
+	RequestBody     json.RawMessage     `json:"request_body,omitempty"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody    json.RawMessage     `json:"response_body,omitempty"`
+	SystemPrompt    string              `json:"system_prompt,omitempty"`
+	MaxTokens       int                 `json:"max_tokens,omitempty"`
+	Temperature     *float64            `json:"temperature,omitempty"`
+	TopP            *float64            `json:"top_p,omitempty"`
+	MessageCount    int                 `json:"message_count,omitempty"`
+	StopSequence    *string             `json:"stop_sequence,omitempty"`
+}
+
+func (h *Handler) getRequest(w http.ResponseWriter, r *http.Request) {
+	id, ok := requestID(w, r)
+	if !ok {
+		return
+	}
+	req, err := h.store.GetRequest(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "request not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("request_id", id.String()).Msg("failed to get request")
+		writeError(w, http.StatusInternalServerError, "failed to get request")
+		return
+	}
+
+	resp := requestDetail{Request: req}
+	p, err := h.store.GetPayload(r.Context(), id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+	case err != nil:
+		log.Error().Err(err).Str("request_id", id.String()).Msg("failed to get payload")
+		writeError(w, http.StatusInternalServerError, "failed to get payload")
+		return
+	default:
+		resp.Payload = &payload{
+			RequestHeaders:  p.ReqHeaders,
+			RequestBody:     jsonValue(p.ReqBody),
+			ResponseHeaders: p.RespHeaders,
+			ResponseBody:    jsonValue(p.RespBody),
+			SystemPrompt:    p.Extras.SystemPrompt,
+			MaxTokens:       p.Extras.MaxTokens,
+			Temperature:     p.Extras.Temperature,
+			TopP:            p.Extras.TopP,
+			MessageCount:    p.Extras.MessageCount,
+			StopSequence:    p.Extras.StopSequence,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type sseEvent struct {
+	Index int             `json:"index"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Bytes int             `json:"bytes"`
+}
+
+func (h *Handler) listEvents(w http.ResponseWriter, r *http.Request) {
+	id, ok := requestID(w, r)
+	if !ok {
+		return
+	}
+	evs, err := h.store.ListSSEEvents(r.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Str("request_id", id.String()).Msg("failed to list SSE events")
+		writeError(w, http.StatusInternalServerError, "failed to list events")
+		return
+	}
+	if len(evs) == 0 {
+		if _, err := h.store.GetRequest(r.Context(), id); errors.Is(err, storage.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "request not found")
+			return
+		}
+	}
+	out := make([]sseEvent, len(evs))
+	for i, ev := range evs {
+		out[i] = sseEvent{Index: ev.Index, Type: ev.EventType, Data: jsonValue([]byte(ev.RawData)), Bytes: ev.RawBytes}
+	}
+	writeJSON(w, http.StatusOK, map[string][]sseEvent{"events": out})
+}
+
+func requestID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request id")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// jsonValue embeds a stored body as JSON, or as a JSON string when it is
+// not valid JSON (e.g. a raw SSE stream whose reconstruction failed).
+func jsonValue(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	if json.Valid(b) {
+		return b
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("failed to write API response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/namikmesic/claude-sidekick/internal/export"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Bulk export takes the request listing filters and streams matching
+// requests oldest first as format=jsonl (default) or parquet, one row per
+// request:
+//
+//	GET /api/v1/export?from=...&to=...&payloads=true&tools=true&limit=10000
+//
+// payloads adds system prompts and request and response bodies, tools the
+// tool calls of each response. When more requests match than limit (default
+// 10000, at most 100000), the X-Next-Cursor header carries the cursor of
+// the next chunk.
+//
+// A complete export ends with the trailer X-Export-Complete: true. An export
+// that fails once rows are streaming is cut off without the end of the
+// chunked body, so clients see an error rather than a short file.
+const (
+	defaultExportLimit = 10000
+	maxExportLimit     = 100000
+)
+
+func (h *Handler) export(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r, defaultExportLimit, maxExportLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if !slices.Contains(export.Formats, format) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid format %q: want jsonl or parquet", format))
+		return
+	}
+	var opts export.Options
+	for name, dst := range map[string]*bool{"payloads": &opts.Payloads, "tools": &opts.ToolCalls} {
+		if v := q.Get(name); v != "" {
+			if *dst, err = strconv.ParseBool(v); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q", name, v))
+				return
+			}
+		}
+	}
+
+	reqs, more, err := export.Page(r.Context(), h.store, *f, f.After, f.Limit)
+	if errors.Is(err, storage.ErrSearchUnavailable) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list requests for export")
+		writeError(w, http.StatusInternalServerError, "failed to list requests")
+		return
+	}
+	if more {
+		last := reqs[len(reqs)-1]
+		w.Header().Set("X-Next-Cursor", encodeCursor(&storage.RequestCursor{TS: last.Timestamp, ID: last.ID}))
+	}
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="requests.`+format+`"`)
+	w.Header().Set("Trailer", "X-Export-Complete")
+
+	cw := &countingWriter{w: w}
+	ew, _ := export.NewWriter(cw, format)
+	err = export.WriteRows(r.Context(), h.store, ew, reqs, opts)
+	if err == nil {
+		err = ew.Close()
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("export failed")
+		if cw.n == 0 {
+			for _, name := range []string{"Trailer", "Content-Disposition", "X-Next-Cursor"} {
+				w.Header().Del(name)
+			}
+			writeError(w, http.StatusInternalServerError, "export failed")
+			return
+		}
+		// The status is sent; only a broken response tells the client.
+		panic(http.ErrAbortHandler)
+	}
+	w.Header().Set("X-Export-Complete", "true")
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
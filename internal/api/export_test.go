@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// exportStore lists n requests and fails to load the payload of the
+// failAt'th (counting from 1; 0 never fails).
+type exportStore struct {
+	storage.Store
+	n, failAt int
+	loaded    int
+}
+
+func (s *exportStore) ListRequests(context.Context, *storage.RequestFilter) ([]storage.Request, error) {
+	reqs := make([]storage.Request, s.n)
+	for i := range reqs {
+		reqs[i] = storage.Request{ID: uuid.New(), Timestamp: time.Now(), Model: "claude-sonnet-4-5"}
+	}
+	return reqs, nil
+}
+
+func (s *exportStore) GetPayload(context.Context, uuid.UUID) (*storage.PayloadRecord, error) {
+	s.loaded++
+	if s.loaded == s.failAt {
+		return nil, errors.New("database gone")
+	}
+	// Large enough for every row to reach the client at once.
+	return &storage.PayloadRecord{ReqBody: []byte(`"` + strings.Repeat("x", 8192) + `"`)}, nil
+}
+
+func TestExportSignalsTruncation(t *testing.T) {
+	tests := []struct {
+		name       string
+		failAt     int
+		wantStatus int
+		wantErr    bool // body cut off
+		complete   string
+	}{
+		{"complete", 0, http.StatusOK, false, "true"},
+		{"fails before any row", 1, http.StatusInternalServerError, false, ""},
+		{"fails midway", 3, http.StatusOK, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(NewHandler(&exportStore{n: 5, failAt: tt.failAt}, nil))
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/api/v1/export?payloads=true")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			_, err = io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d; want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("reading the body: %v; want an error: %v", err, tt.wantErr)
+			}
+			if got := resp.Trailer.Get("X-Export-Complete"); got != tt.complete {
+				t.Errorf("X-Export-Complete = %q; want %q", got, tt.complete)
+			}
+		})
+	}
+}
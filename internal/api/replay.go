@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/namikmesic/claude-sidekick/internal/replay"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Replays resend a stored request through the proxy and diff the responses
+// (see package replay). The optional body overrides the model or sampling:
+//
+//	POST /api/v1/requests/{id}/replay   {"model": "...", "temperature": 0, "max_tokens": 1024}
+//
+// A replay the API rejects is a 502 carrying the upstream error.
+
+func (h *Handler) replayRequest(w http.ResponseWriter, r *http.Request) {
+	id, ok := requestID(w, r)
+	if !ok {
+		return
+	}
+	var o replay.Overrides
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid overrides: "+err.Error())
+		return
+	}
+
+	res, err := h.replayer.Replay(r.Context(), id, o)
+	var upstream *replay.UpstreamError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeError(w, http.StatusNotFound, "request not found")
+	case errors.Is(err, replay.ErrNoRequestBody):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.As(err, &upstream):
+		writeError(w, http.StatusBadGateway, err.Error())
+	case err != nil:
+		log.Error().Err(err).Str("request_id", id.String()).Msg("replay failed")
+		writeError(w, http.StatusInternalServerError, "replay failed")
+	default:
+		writeJSON(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Aggregates take the request listing filters (without cursor). from
+// defaults to seven days ago.
+//
+//	GET /api/v1/stats/usage?bucket=minute|hour|day         usage over time (default: hour up to two days, else day)
+//	GET /api/v1/stats/breakdown?by=model|agent|status|...  usage per value of a dimension, most expensive first
+
+const defaultStatsRange = 7 * 24 * time.Hour
+
+var buckets = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+func statsFilter(r *http.Request) (*storage.RequestFilter, error) {
+	f, err := parseFilter(r, defaultLimit, maxLimit)
+	if err != nil {
+		return nil, err
+	}
+	f.After = nil
+	if f.From.IsZero() {
+		f.From = time.Now().Add(-defaultStatsRange)
+	}
+	return f, nil
+}
+
+type usageSeries struct {
+	Bucket string                `json:"bucket"`
+	From   time.Time             `json:"from"`
+	Points []storage.UsageBucket `json:"points"`
+}
+
+func (h *Handler) usageOverTime(w http.ResponseWriter, r *http.Request) {
+	f, err := statsFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := r.URL.Query().Get("bucket")
+	if name == "" {
+		to := f.To
+		if to.IsZero() {
+			to = time.Now()
+		}
+		name = "hour"
+		if to.Sub(f.From) > 48*time.Hour {
+			name = "day"
+		}
+	}
+	bucket, ok := buckets[name]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid bucket %q: want minute, hour or day", name))
+		return
+	}
+
+	points, err := h.store.UsageOverTime(r.Context(), f, bucket)
+	if errors.Is(err, storage.ErrSearchUnavailable) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to aggregate usage")
+		writeError(w, http.StatusInternalServerError, "failed to aggregate usage")
+		return
+	}
+	if points == nil {
+		points = []storage.UsageBucket{}
+	}
+	writeJSON(w, http.StatusOK, usageSeries{Bucket: name, From: f.From, Points: points})
+}
+
+type usageBreakdown struct {
+	By     string               `json:"by"`
+	From   time.Time            `json:"from"`
+	Groups []storage.UsageGroup `json:"groups"`
+}
+
+func (h *Handler) usageBy(w http.ResponseWriter, r *http.Request) {
+	f, err := statsFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	by := r.URL.Query().Get("by")
+	if !slices.Contains(storage.UsageDimensions, by) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid by %q: want one of %v", by, storage.UsageDimensions))
+		return
+	}
+
+	groups, err := h.store.UsageBy(r.Context(), f, by)
+	if errors.Is(err, storage.ErrSearchUnavailable) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to aggregate usage")
+		writeError(w, http.StatusInternalServerError, "failed to aggregate usage")
+		return
+	}
+	if groups == nil {
+		groups = []storage.UsageGroup{}
+	}
+	writeJSON(w, http.StatusOK, usageBreakdown{By: by, From: f.From, Groups: groups})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/transcript"
+	"github.com/rs/zerolog/log"
+)
+
+// Transcripts render as format=json (default), markdown or html.
+//
+//	GET /api/v1/requests/{id}/transcript        one request's prompt and response
+//	GET /api/v1/conversations/{id}/transcript   every request of a conversation, oldest first
+
+func (h *Handler) requestTranscript(w http.ResponseWriter, r *http.Request) {
+	id, ok := requestID(w, r)
+	if !ok {
+		return
+	}
+	h.writeTranscript(w, r, func() (*transcript.Transcript, error) {
+		return transcript.Request(r.Context(), h.store, id)
+	})
+}
+
+func (h *Handler) conversationTranscript(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	h.writeTranscript(w, r, func() (*transcript.Transcript, error) {
+		return transcript.Conversation(r.Context(), h.store, id)
+	})
+}
+
+func (h *Handler) writeTranscript(w http.ResponseWriter, r *http.Request, build func() (*transcript.Transcript, error)) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if !slices.Contains(transcript.Formats, format) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid format %q: want json, markdown or html", format))
+		return
+	}
+	t, err := build()
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to build transcript")
+		writeError(w, http.StatusInternalServerError, "failed to build transcript")
+		return
+	}
+	w.Header().Set("Content-Type", transcript.ContentType(format))
+	if err := transcript.Render(w, t, format); err != nil {
+		log.Debug().Err(err).Msg("failed to write transcript")
+	}
+}
@@ -0,0 +1,147 @@
+// Package budget tracks spend against daily and monthly limits and announces
+// threshold crossings as budget.threshold events. Totals live in a JetStream
+// KV bucket, so every replica adds to the same windows and each crossing is
+// announced by exactly one of them.
+package budget
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/events"
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	Bucket      = "sidekick_budgets"
+	maxAttempts = 10
+)
+
+type Limits struct {
+	DailyUSD   float64
+	MonthlyUSD float64
+	// Thresholds are percentages of a limit, e.g. 50, 80, 100.
+	Thresholds []int
+}
+
+// Window is the spend in one budget window.
+type Window struct {
+	Period   string  `json:"period"`
+	Window   string  `json:"window"`
+	LimitUSD float64 `json:"limit_usd"`
+	SpentUSD float64 `json:"spent_usd"`
+}
+
+// Tracker accumulates spend. A nil Tracker ignores everything.
+type Tracker struct {
+	kv     nats.KeyValue
+	limits Limits
+	events *events.Publisher
+}
+
+// NewTracker returns nil when no limit is set.
+func NewTracker(js nats.JetStreamContext, limits Limits, replicas int, pub *events.Publisher) (*Tracker, error) {
+	if limits.DailyUSD <= 0 && limits.MonthlyUSD <= 0 {
+		return nil, nil
+	}
+	kv, err := js.KeyValue(Bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      Bucket,
+			Description: "sidekick spend per budget window",
+			// Long enough to outlive a monthly window.
+			TTL:      40 * 24 * time.Hour,
+			Storage:  nats.FileStorage,
+			Replicas: max(replicas, 1),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Tracker{kv: kv, limits: limits, events: pub}, nil
+}
+
+func (t *Tracker) windows(at time.Time) []Window {
+	at = at.UTC()
+	var ws []Window
+	if t.limits.DailyUSD > 0 {
+		ws = append(ws, Window{Period: "daily", Window: at.Format("2006-01-02"), LimitUSD: t.limits.DailyUSD})
+	}
+	if t.limits.MonthlyUSD > 0 {
+		ws = append(ws, Window{Period: "monthly", Window: at.Format("2006-01"), LimitUSD: t.limits.MonthlyUSD})
+	}
+	return ws
+}
+
+// Add records cost spent at the given time and publishes an event for every
+// threshold the addition crosses. A request reprocessed after a redelivery
+// is counted again.
+func (t *Tracker) Add(cost float64, at time.Time) {
+	if t == nil || cost <= 0 {
+		return
+	}
+	for _, w := range t.windows(at) {
+		before, after, err := t.add(w.Period+"."+w.Window, cost)
+		if err != nil {
+			log.Warn().Err(err).Str("window", w.Window).Msg("failed to update budget")
+			continue
+		}
+		for _, pct := range t.limits.Thresholds {
+			threshold := w.LimitUSD * float64(pct) / 100
+			if before < threshold && after >= threshold {
+				log.Warn().Str("period", w.Period).Int("threshold_pct", pct).Float64("spent_usd", after).Msg("budget threshold crossed")
+				t.events.BudgetThreshold(events.BudgetThreshold{
+					Period:       w.Period,
+					Window:       w.Window,
+					ThresholdPct: pct,
+					LimitUSD:     w.LimitUSD,
+					SpentUSD:     after,
+				})
+			}
+		}
+	}
+}
+
+// add increments a window total with compare-and-set, so concurrent
+// replicas never lose an update and each sees a distinct before/after pair.
+func (t *Tracker) add(key string, cost float64) (before, after float64, err error) {
+	for range maxAttempts {
+		entry, err := t.kv.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			if _, err := t.kv.Create(key, formatUSD(cost)); err == nil {
+				return 0, cost, nil
+			}
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		before, _ = strconv.ParseFloat(string(entry.Value()), 64)
+		after = before + cost
+		if _, err := t.kv.Update(key, formatUSD(after), entry.Revision()); err == nil {
+			return before, after, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("budget %s: too many concurrent updates", key)
+}
+
+// Status reports the current windows.
+func (t *Tracker) Status() []Window {
+	if t == nil {
+		return nil
+	}
+	ws := t.windows(time.Now())
+	for i := range ws {
+		if entry, err := t.kv.Get(ws[i].Period + "." + ws[i].Window); err == nil {
+			ws[i].SpentUSD, _ = strconv.ParseFloat(string(entry.Value()), 64)
+		}
+	}
+	return ws
+}
+
+func formatUSD(v float64) []byte {
+	return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+}
@@ -0,0 +1,129 @@
+// Package cache is an in-memory cache of API responses to deterministic
+// requests, so repeated identical requests are answered without calling
+// upstream.
+//
+// Only Messages API requests with temperature 0 are cached. They are keyed
+// on their normalized body (keys sorted, stream and metadata left out, so a
+// cached response serves both streamed and unstreamed requests), the
+// anthropic-beta and anthropic-version headers and the caller's key
+// fingerprint. Entries expire after a TTL; the least recently used ones are
+// evicted beyond a total size.
+//
+// Requests with the header "X-Sidekick-Cache: bypass" are neither served
+// from nor stored in the cache, nor played back from VCR recordings.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/vcr"
+)
+
+// BypassHeader set to "bypass" keeps a request away from the cache.
+const BypassHeader = "X-Sidekick-Cache"
+
+// Bypass reports whether r asks to reach upstream whatever is cached or
+// recorded.
+func Bypass(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(BypassHeader), "bypass")
+}
+
+type Cache struct {
+	ttl      time.Duration
+	maxBytes int64
+	hasher   *vcr.Hasher
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List // of *entry, most recently used first
+	items map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	body    []byte
+	expires time.Time
+}
+
+// New returns a cache holding responses for ttl, up to maxBytes of them.
+func New(ttl time.Duration, maxBytes int64) *Cache {
+	return &Cache{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		hasher:   vcr.NewHasher([]string{"stream", "metadata"}),
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Key returns the cache key of a request, or "" when it is not cacheable.
+func (c *Cache) Key(r *http.Request, body []byte, parsed processor.ParsedRequest, keyFingerprint string) string {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" || Bypass(r) {
+		return ""
+	}
+	if parsed.Temperature == nil || *parsed.Temperature != 0 {
+		return ""
+	}
+	var betas []string
+	for _, v := range r.Header.Values("Anthropic-Beta") {
+		for _, b := range strings.Split(v, ",") {
+			betas = append(betas, strings.TrimSpace(b))
+		}
+	}
+	slices.Sort(betas)
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%s\n%s\n%s",
+		c.hasher.Hash(r.Method, r.URL.Path, body),
+		strings.Join(betas, ","), r.Header.Get("Anthropic-Version"), keyFingerprint)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// Get returns the cached response body for key.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.body, true
+}
+
+// Put caches a response body for key. Bodies larger than the whole cache
+// are not cached.
+func (c *Cache) Put(key string, body []byte) {
+	if int64(len(body)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.items[key] = c.lru.PushFront(&entry{key: key, body: body, expires: time.Now().Add(c.ttl)})
+	c.size += int64(len(body))
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.size -= int64(len(e.body))
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+)
+
+func TestKey(t *testing.T) {
+	c := New(time.Minute, 1<<20)
+	zero, warm := 0.0, 0.7
+	body := `{"model":"m","temperature":0,"stream":true,"messages":[]}`
+	key := func(method, path, body string, temp *float64, headers map[string]string) string {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return c.Key(r, []byte(body), processor.ParsedRequest{Temperature: temp}, "fp")
+	}
+
+	base := key("POST", "/v1/messages", body, &zero, nil)
+	if base == "" {
+		t.Fatal("temperature 0 request not cacheable")
+	}
+	unstreamed := `{"messages":[],"model":"m","temperature":0}`
+	if got := key("POST", "/v1/messages", unstreamed, &zero, nil); got != base {
+		t.Error("stream flag or key order changes the key")
+	}
+	for name, got := range map[string]string{
+		"warm":           key("POST", "/v1/messages", body, &warm, nil),
+		"no temperature": key("POST", "/v1/messages", body, nil, nil),
+		"other path":     key("POST", "/v1/messages/count_tokens", body, &zero, nil),
+		"bypass":         key("POST", "/v1/messages", body, &zero, map[string]string{BypassHeader: "bypass"}),
+	} {
+		if got != "" {
+			t.Errorf("%s: cacheable", name)
+		}
+	}
+	if got := key("POST", "/v1/messages", body, &zero, map[string]string{"Anthropic-Beta": "b"}); got == base {
+		t.Error("anthropic-beta does not change the key")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := New(time.Minute, 10)
+	c.Put("a", []byte("aaaa"))
+	c.Put("b", []byte("bbbb"))
+	c.Get("a")
+	c.Put("c", []byte("cccc")) // over 10 bytes: evicts b, the least recently used
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b not evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("%s evicted", k)
+		}
+	}
+
+	c.Put("a", []byte("aa"))
+	if c.size != 6 {
+		t.Errorf("size after replacing a = %d; want 6", c.size)
+	}
+	c.Put("big", []byte("0123456789x"))
+	if _, ok := c.Get("big"); ok || c.size != 6 {
+		t.Error("body larger than the cache was cached")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := New(20*time.Millisecond, 1<<20)
+	c.Put("a", []byte("a"))
+	if body, ok := c.Get("a"); !ok || string(body) != "a" {
+		t.Fatalf("Get = %q, %v", body, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expired entry served")
+	}
+	if c.size != 0 || len(c.items) != 0 {
+		t.Errorf("expired entry kept: size %d, items %d", c.size, len(c.items))
+	}
+}
@@ -0,0 +1,225 @@
+// Package claudecode imports the session transcripts Claude Code keeps
+// under ~/.claude/projects as stored requests, to backfill history from
+// before sidekick was deployed or from clients that bypassed it.
+//
+// A transcript is JSON Lines, one entry per message, each pointing at its
+// parent. An API call shows up as the assistant message it returned (split
+// over several entries sharing the message ID in recent versions); its
+// request is rebuilt from the chain of messages before it. Transcripts lack
+// the system prompt, tool definitions and sampling parameters, so imported
+// request bodies hold only the model and messages.
+package claudecode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+)
+
+// entry is a transcript line. Types other than user and assistant
+// (summary, system, file-history-snapshot, ...) are skipped.
+type entry struct {
+	Type       string          `json:"type"`
+	UUID       string          `json:"uuid"`
+	ParentUUID string          `json:"parentUuid"`
+	SessionID  string          `json:"sessionId"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Message    json.RawMessage `json:"message"`
+
+	msg message
+}
+
+type message struct {
+	ID           string              `json:"id"`
+	Role         string              `json:"role"`
+	Model        string              `json:"model"`
+	Content      json.RawMessage     `json:"content"`
+	StopReason   string              `json:"stop_reason"`
+	StopSequence *string             `json:"stop_sequence"`
+	Usage        processor.UsageInfo `json:"usage"`
+}
+
+// syntheticModel marks assistant messages Claude Code writes itself
+// (interruptions, API errors) without calling the API.
+const syntheticModel = "<synthetic>"
+
+// Call is one API call recovered from a transcript.
+type Call struct {
+	MessageID    string
+	SessionID    string
+	Timestamp    time.Time // of the first entry of the response
+	Model        string
+	Content      []json.RawMessage // response content blocks
+	StopReason   string
+	StopSequence *string
+	Usage        processor.UsageInfo
+
+	// The request is rebuilt from the transcript's entries on demand:
+	// copies of the history of every call would grow quadratically.
+	byUUID map[string]*entry
+	parent string
+}
+
+// Messages returns the conversation the call was made with.
+func (c *Call) Messages() []processor.ReqMessage {
+	return history(c.byUUID, c.parent)
+}
+
+// maxLine bounds transcript lines. Entries embed whole tool results and can
+// be large; longer ones are skipped.
+const maxLine = 64 << 20
+
+// Parse reads a transcript and returns its API calls in the order their
+// responses appear. Lines that are not valid entries or longer than maxLine
+// are counted in skipped.
+func Parse(r io.Reader) (calls []*Call, skipped int, err error) {
+	byUUID := make(map[string]*entry)
+	byMessage := make(map[string]*Call)
+	br := bufio.NewReaderSize(r, 1<<20)
+	for {
+		line, err := readLine(br)
+		if errors.Is(err, errLineTooLong) {
+			skipped++
+			continue
+		}
+		if err == io.EOF {
+			return calls, skipped, nil
+		}
+		if err != nil {
+			return calls, skipped, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		e := &entry{}
+		if json.Unmarshal(line, e) != nil {
+			skipped++
+			continue
+		}
+		if e.Type != "user" && e.Type != "assistant" {
+			continue
+		}
+		if json.Unmarshal(e.Message, &e.msg) != nil || e.UUID == "" {
+			skipped++
+			continue
+		}
+		e.Message = nil // decoded into msg
+		if e.msg.Model == syntheticModel {
+			continue
+		}
+		byUUID[e.UUID] = e
+		if e.Type != "assistant" || e.msg.ID == "" {
+			continue
+		}
+
+		c, ok := byMessage[e.msg.ID]
+		if !ok {
+			c = &Call{
+				MessageID: e.msg.ID,
+				SessionID: e.SessionID,
+				Timestamp: e.Timestamp,
+				Model:     e.msg.Model,
+				byUUID:    byUUID,
+				parent:    e.ParentUUID,
+			}
+			byMessage[e.msg.ID] = c
+			calls = append(calls, c)
+		}
+		c.Content = append(c.Content, blocks(e.msg.Content)...)
+		if e.msg.StopReason != "" {
+			c.StopReason, c.StopSequence = e.msg.StopReason, e.msg.StopSequence
+		}
+		// Split entries repeat the usage; later ones have the final count.
+		c.Usage = e.msg.Usage
+	}
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine returns the next line without its line ending, or io.EOF after
+// the last one. A line longer than maxLine is read past and reported as
+// errLineTooLong.
+func readLine(br *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLine+2 { // room for "\r\n"
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = br.ReadSlice('\n')
+			}
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, errLineTooLong
+		}
+		line = append(line, chunk...)
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == io.EOF && len(line) > 0:
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		return bytes.TrimSuffix(line, []byte("\r")), nil
+	}
+}
+
+// history returns the conversation ending at the entry parent, oldest first,
+// with consecutive entries of one role merged into one message as the API
+// requires.
+func history(byUUID map[string]*entry, parent string) []processor.ReqMessage {
+	var chain []*entry
+	seen := make(map[string]bool)
+	for e := byUUID[parent]; e != nil && !seen[e.UUID]; e = byUUID[e.ParentUUID] {
+		seen[e.UUID] = true
+		chain = append(chain, e)
+	}
+
+	var msgs []processor.ReqMessage
+	var content []json.RawMessage
+	flush := func(role string) {
+		if len(content) > 0 {
+			raw, _ := json.Marshal(content)
+			msgs = append(msgs, processor.ReqMessage{Role: role, Content: raw})
+		}
+		content = nil
+	}
+	role := ""
+	for i := len(chain) - 1; i >= 0; i-- {
+		e := chain[i]
+		if e.msg.Role != role {
+			flush(role)
+			role = e.msg.Role
+		}
+		content = append(content, blocks(e.msg.Content)...)
+	}
+	flush(role)
+	return msgs
+}
+
+// blocks returns message content as content blocks; a plain string becomes
+// a text block.
+func blocks(content json.RawMessage) []json.RawMessage {
+	var s string
+	if json.Unmarshal(content, &s) == nil {
+		if s == "" {
+			return nil
+		}
+		raw, _ := json.Marshal(struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}{"text", s})
+		return []json.RawMessage{raw}
+	}
+	var out []json.RawMessage
+	json.Unmarshal(content, &out)
+	return out
+}
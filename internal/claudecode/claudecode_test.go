@@ -0,0 +1,76 @@
+package claudecode
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+const transcript = `{"type":"summary","summary":"chat"}
+{"type":"user","uuid":"u1","sessionId":"s","timestamp":"2026-01-02T10:00:00Z","message":{"role":"user","content":"hi"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","sessionId":"s","timestamp":"2026-01-02T10:00:01Z","message":{"id":"m1","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"thinking","thinking":"hm"}],"usage":{"input_tokens":3,"output_tokens":1}}}
+{"type":"assistant","uuid":"a2","parentUuid":"a1","sessionId":"s","timestamp":"2026-01-02T10:00:02Z","message":{"id":"m1","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":5}}}
+not json
+{"type":"assistant","uuid":"a3","parentUuid":"a2","sessionId":"s","message":{"id":"x","model":"<synthetic>","content":[]}}
+`
+
+const followUp = `{"type":"user","uuid":"u2","parentUuid":"a2","sessionId":"s","timestamp":"2026-01-02T10:01:00Z","message":{"role":"user","content":"again"}}
+{"type":"assistant","uuid":"a4","parentUuid":"u2","sessionId":"s","timestamp":"2026-01-02T10:01:01Z","message":{"id":"m2","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"sure"}],"stop_reason":"end_turn","usage":{"input_tokens":9,"output_tokens":2}}}
+`
+
+func TestParse(t *testing.T) {
+	calls, skipped, err := Parse(strings.NewReader(transcript + followUp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 {
+		t.Errorf("skipped = %d; want 1", skipped)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("%d calls; want 2", len(calls))
+	}
+
+	first := calls[0]
+	if first.MessageID != "m1" || len(first.Content) != 2 || first.StopReason != "end_turn" || first.Usage.OutputTokens != 5 {
+		t.Errorf("first call = %+v", first)
+	}
+	if msgs := first.Messages(); len(msgs) != 1 || msgs[0].Role != "user" {
+		t.Errorf("first call history = %+v", msgs)
+	}
+
+	second := calls[1].Messages()
+	if len(second) != 3 {
+		t.Fatalf("second call history has %d messages; want user, assistant, user", len(second))
+	}
+	for i, role := range []string{"user", "assistant", "user"} {
+		if second[i].Role != role {
+			t.Errorf("message %d role = %q; want %q", i, second[i].Role, role)
+		}
+	}
+}
+
+func TestParseSkipsOversizedLines(t *testing.T) {
+	huge := io.MultiReader(
+		strings.NewReader(`{"type":"user","uuid":"big","message":{"role":"user","content":"`),
+		strings.NewReader(strings.Repeat("x", maxLine)),
+		strings.NewReader("\"}}\r\n"),
+	)
+	r := io.MultiReader(strings.NewReader(transcript), huge, strings.NewReader(followUp))
+	calls, skipped, err := Parse(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped = %d; want 2", skipped)
+	}
+	if len(calls) != 2 || calls[1].MessageID != "m2" {
+		t.Fatalf("calls = %d; want both, including the one after the long line", len(calls))
+	}
+}
+
+func TestParseWithoutTrailingNewline(t *testing.T) {
+	calls, _, err := Parse(strings.NewReader(strings.TrimSuffix(transcript, "\n")))
+	if err != nil || len(calls) != 1 || calls[0].StopReason != "end_turn" {
+		t.Errorf("calls = %d, err = %v", len(calls), err)
+	}
+}
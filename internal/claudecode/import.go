@@ -0,0 +1,189 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// agent is the agent name proxied Claude Code traffic is attributed to.
+const agent = "claude-cli"
+
+// Stats counts what Import did.
+type Stats struct {
+	Files    int // transcripts read
+	Calls    int // API calls found
+	Imported int
+	Existing int // already stored, proxied or imported before
+	Skipped  int // unreadable lines
+}
+
+// Import loads the API calls of every transcript (*.jsonl) under dir into
+// store as imported requests. Calls whose message ID is already stored are
+// skipped, so proxied traffic is not duplicated and importing again is a
+// no-op.
+func Import(ctx context.Context, store storage.Store, dir string) (Stats, error) {
+	var st Stats
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".jsonl") {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		calls, skipped, err := Parse(f)
+		f.Close()
+		if err != nil {
+			log.Warn().Err(err).Str("file", path).Msg("failed to read transcript")
+			return nil
+		}
+		st.Files++
+		st.Skipped += skipped
+
+		// Resumed sessions repeat earlier messages in a new file.
+		var fresh []*Call
+		for _, c := range calls {
+			if !seen[c.MessageID] {
+				seen[c.MessageID] = true
+				fresh = append(fresh, c)
+			}
+		}
+		st.Calls += len(fresh)
+		n, err := importCalls(ctx, store, fresh)
+		st.Imported += n
+		st.Existing += len(fresh) - n
+		if err != nil {
+			return err
+		}
+		log.Debug().Str("file", path).Int("calls", len(fresh)).Int("imported", n).Msg("imported transcript")
+		return nil
+	})
+	return st, err
+}
+
+const existingBatch = 500
+
+// importCalls stores the calls whose message IDs are not stored yet and
+// returns how many it stored.
+func importCalls(ctx context.Context, store storage.Store, calls []*Call) (int, error) {
+	n := 0
+	for len(calls) > 0 {
+		batch := calls[:min(existingBatch, len(calls))]
+		calls = calls[len(batch):]
+
+		ids := make([]string, len(batch))
+		for i, c := range batch {
+			ids[i] = c.MessageID
+		}
+		existing, err := store.ExistingMessageIDs(ctx, ids)
+		if err != nil {
+			return n, err
+		}
+		for _, c := range batch {
+			if existing[c.MessageID] {
+				continue
+			}
+			if err := c.store(ctx, store); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// requestID derives a stable request ID from an API message ID.
+func requestID(messageID string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("sidekick:claude-code:"+messageID))
+}
+
+func (c *Call) store(ctx context.Context, store storage.Store) error {
+	msgs := c.Messages()
+	reqBody, err := json.Marshal(struct {
+		Model    string                 `json:"model"`
+		Messages []processor.ReqMessage `json:"messages"`
+	}{c.Model, msgs})
+	if err != nil {
+		return err
+	}
+	respBody, err := json.Marshal(struct {
+		ID           string              `json:"id"`
+		Type         string              `json:"type"`
+		Role         string              `json:"role"`
+		Model        string              `json:"model"`
+		Content      []json.RawMessage   `json:"content"`
+		StopReason   string              `json:"stop_reason,omitempty"`
+		StopSequence *string             `json:"stop_sequence"`
+		Usage        processor.UsageInfo `json:"usage"`
+	}{c.MessageID, "message", "assistant", c.Model, c.Content, c.StopReason, c.StopSequence, c.Usage})
+	if err != nil {
+		return err
+	}
+	var resp processor.AnthropicResponse
+	json.Unmarshal(respBody, &resp)
+
+	id := requestID(c.MessageID)
+	usage := c.Usage.Tokens()
+	cost := pricing.Cost(c.Model, usage)
+	err = store.UpsertRequest(ctx, &storage.RequestRecord{
+		ID:                  id,
+		Timestamp:           c.Timestamp,
+		Method:              "POST",
+		Path:                "/v1/messages",
+		StatusCode:          200,
+		Success:             true,
+		Model:               c.Model,
+		InputTokens:         usage.InputTokens,
+		OutputTokens:        usage.OutputTokens,
+		CacheReadTokens:     usage.CacheReadTokens,
+		CacheCreationTokens: usage.CacheCreationTokens,
+		TotalTokens:         usage.Total(),
+		CostUSD:             cost,
+		IsStream:            true,
+		AgentUsed:           agent,
+		ConversationID:      c.SessionID,
+		Imported:            true,
+	})
+	if err != nil {
+		return err
+	}
+	err = store.UpsertRequestUsage(ctx, &storage.RequestUsage{
+		RequestID:     id,
+		TS:            c.Timestamp,
+		Model:         c.Model,
+		InputTokens:   usage.InputTokens,
+		OutputTokens:  usage.OutputTokens,
+		CacheRead:     usage.CacheReadTokens,
+		CacheCreation: usage.CacheCreationTokens,
+		TotalTokens:   usage.Total(),
+		CostUSD:       cost,
+		StopReason:    c.StopReason,
+		MessageID:     c.MessageID,
+	})
+	if err != nil {
+		return err
+	}
+	return store.UpsertPayload(ctx, &storage.PayloadRecord{
+		RequestID: id,
+		TS:        c.Timestamp,
+		ReqBody:   reqBody,
+		RespBody:  respBody,
+		Extras: storage.PayloadExtras{
+			MessageCount: len(msgs),
+			StopSequence: c.StopSequence,
+			UserText:     processor.ParseRequest(reqBody).UserText,
+			ResponseText: resp.SearchText(),
+		},
+	})
+}
@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"errors"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	LeasesBucket = "sidekick_leases"
+	// LeaseTTL is how long a lease outlives its holder's last renewal.
+	LeaseTTL = time.Minute
+)
+
+// Lease is a named lock held by at most one replica at a time, for the rare
+// work that must not run everywhere. It expires unless renewed within
+// LeaseTTL, so the lease of a crashed holder passes to another replica.
+type Lease struct {
+	kv     nats.KeyValue
+	name   string
+	holder string
+	rev    uint64 // revision of our entry while we hold the lease
+}
+
+// NewLease opens the lease name for replica holder. replicas is the bucket's
+// replication factor on a JetStream cluster.
+func NewLease(js nats.JetStreamContext, name, holder string, replicas int) (*Lease, error) {
+	kv, err := js.KeyValue(LeasesBucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      LeasesBucket,
+			Description: "sidekick leases",
+			TTL:         LeaseTTL,
+			Storage:     nats.MemoryStorage,
+			Replicas:    max(replicas, 1),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{kv: kv, name: name, holder: holder}, nil
+}
+
+// Acquire takes the lease if it is free, or renews it if this replica holds
+// it, and reports whether it does. Callers renew by calling it again well
+// within LeaseTTL.
+func (l *Lease) Acquire() bool {
+	if l.rev != 0 {
+		rev, err := l.kv.Update(l.name, []byte(l.holder), l.rev)
+		if err == nil {
+			l.rev = rev
+			return true
+		}
+		// Expired and possibly taken by another replica.
+		l.rev = 0
+	}
+	rev, err := l.kv.Create(l.name, []byte(l.holder))
+	if err != nil {
+		return false
+	}
+	l.rev = rev
+	return true
+}
+
+// Release gives the lease up so another replica can take it right away.
+func (l *Lease) Release() {
+	if l.rev == 0 {
+		return
+	}
+	l.kv.Delete(l.name, nats.LastRevision(l.rev))
+	l.rev = 0
+}
@@ -0,0 +1,49 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+)
+
+func TestLease(t *testing.T) {
+	srv, err := jetstream.NewServer(t.TempDir(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown()
+	nc, err := srv.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewLease(js, "sweep", "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewLease(js, "sweep", "b", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Acquire() {
+		t.Fatal("a did not get a free lease")
+	}
+	if b.Acquire() {
+		t.Fatal("b took a held lease")
+	}
+	if !a.Acquire() {
+		t.Fatal("a could not renew its lease")
+	}
+	a.Release()
+	if !b.Acquire() {
+		t.Fatal("b did not get a released lease")
+	}
+	if a.Acquire() {
+		t.Fatal("a took the lease back from b")
+	}
+}
@@ -0,0 +1,119 @@
+// Package cluster tracks the sidekick replicas that share a JetStream.
+// Replicas coordinate through JetStream itself (the shared durable consumer,
+// deduplicated publishes and KV buckets), so there is no leader to elect;
+// the little work that must run on one replica at a time takes a Lease.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MembersBucket = "sidekick_members"
+	heartbeat     = 10 * time.Second
+)
+
+type Member struct {
+	ID        string    `json:"id"`
+	Hostname  string    `json:"hostname"`
+	StartedAt time.Time `json:"started_at"`
+	SeenAt    time.Time `json:"seen_at"`
+}
+
+// Registry announces this replica in the members bucket. Entries expire when
+// a replica stops heartbeating, so crashed replicas drop out on their own.
+type Registry struct {
+	kv   nats.KeyValue
+	self Member
+}
+
+// Join registers the replica id. replicas is the bucket's replication factor
+// on a JetStream cluster.
+func Join(js nats.JetStreamContext, id string, replicas int) (*Registry, error) {
+	kv, err := js.KeyValue(MembersBucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      MembersBucket,
+			Description: "sidekick replicas",
+			TTL:         3 * heartbeat,
+			Storage:     nats.MemoryStorage,
+			Replicas:    max(replicas, 1),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	now := time.Now().UTC()
+	r := &Registry{kv: kv, self: Member{ID: id, Hostname: hostname, StartedAt: now}}
+	if err := r.beat(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Registry) ID() string {
+	return r.self.ID
+}
+
+// Run heartbeats until ctx is cancelled, then leaves the registry.
+func (r *Registry) Run(ctx context.Context) {
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.beat(); err != nil {
+				log.Warn().Err(err).Msg("cluster heartbeat failed")
+			}
+		case <-ctx.Done():
+			if err := r.kv.Delete(r.self.ID); err != nil {
+				log.Debug().Err(err).Msg("failed to leave cluster registry")
+			}
+			return
+		}
+	}
+}
+
+func (r *Registry) beat() error {
+	r.self.SeenAt = time.Now().UTC()
+	data, err := json.Marshal(r.self)
+	if err != nil {
+		return err
+	}
+	_, err = r.kv.Put(r.self.ID, data)
+	return err
+}
+
+// Members lists the live replicas, ordered by ID.
+func (r *Registry) Members() ([]Member, error) {
+	keys, err := r.kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	members := make([]Member, 0, len(keys))
+	for _, key := range keys {
+		entry, err := r.kv.Get(key)
+		if err != nil {
+			continue
+		}
+		var m Member
+		if err := json.Unmarshal(entry.Value(), &m); err == nil {
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, nil
+}
@@ -0,0 +1,26 @@
+// Package dashboard serves the built-in web UI. It is a static single-page
+// app embedded in the binary that reads the query API (/api/v1) and the live
+// feed (/admin/live) from the same admin listener, so it needs no separate
+// deployment or build step.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Prefix is the path the UI is served under.
+const Prefix = "/ui/"
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the UI under Prefix.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix(Prefix, http.FileServer(http.FS(files)))
+}
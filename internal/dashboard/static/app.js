@@ -0,0 +1,342 @@
+"use strict";
+
+// sidekick dashboard: reads /api/v1 and /admin/live on the same origin.
+
+const $ = (sel) => document.querySelector(sel);
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs || {})) {
+    if (k === "class") e.className = v;
+    else if (k.startsWith("on")) e.addEventListener(k.slice(2), v);
+    else e.setAttribute(k, v);
+  }
+  for (const c of children.flat()) {
+    if (c != null) e.append(c instanceof Node ? c : String(c));
+  }
+  return e;
+}
+
+async function api(path, params) {
+  const q = new URLSearchParams();
+  for (const [k, v] of Object.entries(params || {})) if (v) q.set(k, v);
+  const res = await fetch(`/api/v1/${path}${q.size ? "?" + q : ""}`);
+  const body = await res.json();
+  if (!res.ok) throw new Error(body.error || res.statusText);
+  return body;
+}
+
+const fmt = {
+  usd: (v) => "$" + (v >= 100 ? v.toFixed(0) : v >= 1 ? v.toFixed(2) : v.toFixed(4)),
+  int: (v) => Math.round(v).toLocaleString(),
+  short: (v) => v >= 1e9 ? (v / 1e9).toFixed(1) + "B" : v >= 1e6 ? (v / 1e6).toFixed(1) + "M" : v >= 1e3 ? (v / 1e3).toFixed(1) + "k" : String(Math.round(v)),
+  time: (s) => new Date(s).toLocaleString(),
+};
+
+// ---- navigation ----
+
+let current = null;
+function show(view) {
+  document.querySelectorAll(".view").forEach((s) => (s.hidden = s.id !== view));
+  document.querySelectorAll("nav a").forEach((a) => a.classList.toggle("active", a.dataset.view === view));
+  if (view === current) return;
+  current = view;
+  if (view === "overview") loadOverview();
+  if (view === "requests" && !$("#request-list").rows.length) loadRequests(true);
+  if (view === "live") startLive();
+  else stopLive();
+}
+window.addEventListener("hashchange", () => show(location.hash.slice(1) || "overview"));
+
+// ---- overview ----
+
+async function loadOverview() {
+  const from = new Date(Date.now() - $("#range").value * 3600e3).toISOString();
+  try {
+    const [series, models, agents, statuses] = await Promise.all([
+      api("stats/usage", { from }),
+      api("stats/breakdown", { from, by: "model", limit: 10 }),
+      api("stats/breakdown", { from, by: "agent", limit: 10 }),
+      api("stats/breakdown", { from, by: "status", limit: 10 }),
+    ]);
+    renderTotals(series.points);
+    barChart($("#chart-cost"), series.points, [["cost_usd", "bar"]], fmt.usd, series.bucket);
+    barChart($("#chart-tokens"), series.points, [["input_tokens", "bar2"], ["output_tokens", "bar"]], fmt.short, series.bucket);
+    breakdown($("#by-model"), "Model", models.groups);
+    breakdown($("#by-agent"), "Agent", agents.groups);
+    breakdown($("#by-status"), "Status", statuses.groups);
+  } catch (err) {
+    $("#totals").replaceChildren(el("p", { class: "bad" }, "Failed to load: " + err.message));
+  }
+}
+$("#range").addEventListener("change", loadOverview);
+
+function renderTotals(points) {
+  const t = { requests: 0, errors: 0, input_tokens: 0, output_tokens: 0, cache_read_tokens: 0, cost_usd: 0 };
+  for (const p of points) for (const k in t) t[k] += p[k];
+  const card = (label, value) => el("div", { class: "card" }, el("div", { class: "label" }, label), el("div", { class: "value" }, value));
+  $("#totals").replaceChildren(
+    card("Spend", fmt.usd(t.cost_usd)),
+    card("Requests", fmt.int(t.requests)),
+    card("Errors", fmt.int(t.errors)),
+    card("Input tokens", fmt.short(t.input_tokens)),
+    card("Output tokens", fmt.short(t.output_tokens)),
+    card("Cache reads", fmt.short(t.cache_read_tokens)),
+  );
+}
+
+// barChart draws stacked bars, one per point.
+function barChart(container, points, series, format, bucket) {
+  const ns = "http://www.w3.org/2000/svg";
+  const W = 600, H = 180, pad = { l: 48, b: 18, t: 6 };
+  const svg = document.createElementNS(ns, "svg");
+  svg.setAttribute("viewBox", `0 0 ${W} ${H}`);
+  svg.setAttribute("preserveAspectRatio", "none");
+  const total = (p) => series.reduce((s, [k]) => s + p[k], 0);
+  const max = Math.max(...points.map(total), 0) || 1;
+  const bw = (W - pad.l) / Math.max(points.length, 1);
+  const y = (v) => ((H - pad.b - pad.t) * v) / max;
+  const add = (tag, attrs, text) => {
+    const e = document.createElementNS(ns, tag);
+    for (const [k, v] of Object.entries(attrs)) e.setAttribute(k, v);
+    if (text != null) e.textContent = text;
+    svg.append(e);
+    return e;
+  };
+  add("text", { x: 0, y: pad.t + 8 }, format(max));
+  add("text", { x: 0, y: H - pad.b }, format(0));
+  points.forEach((p, i) => {
+    let base = H - pad.b;
+    for (const [k, cls] of series) {
+      const h = y(p[k]);
+      base -= h;
+      const r = add("rect", { class: cls, x: pad.l + i * bw + 1, y: base, width: Math.max(bw - 2, 1), height: h });
+      const title = document.createElementNS(ns, "title");
+      title.textContent = `${fmt.time(p.start)}\n${series.map(([k]) => `${k}: ${format(p[k])}`).join("\n")}`;
+      r.append(title);
+    }
+  });
+  if (points.length) {
+    const label = (p) => bucket === "day" ? new Date(p.start).toLocaleDateString() : new Date(p.start).toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" });
+    add("text", { x: pad.l, y: H - 4 }, label(points[0]));
+    add("text", { x: W, y: H - 4, "text-anchor": "end" }, label(points[points.length - 1]));
+  } else {
+    add("text", { x: W / 2, y: H / 2, "text-anchor": "middle" }, "no traffic");
+  }
+  container.replaceChildren(svg);
+}
+
+function breakdown(table, label, groups) {
+  table.replaceChildren(
+    el("thead", {}, el("tr", {}, el("th", {}, label), el("th", { class: "num" }, "Requests"), el("th", { class: "num" }, "Errors"), el("th", { class: "num" }, "Tokens"), el("th", { class: "num" }, "Spend"))),
+    el("tbody", {}, groups.map((g) => el("tr", {},
+      el("td", {}, g.key || el("span", { class: "muted" }, "(none)")),
+      el("td", { class: "num" }, fmt.int(g.requests)),
+      el("td", { class: g.errors ? "num bad" : "num" }, fmt.int(g.errors)),
+      el("td", { class: "num" }, fmt.short(g.input_tokens + g.output_tokens)),
+      el("td", { class: "num" }, fmt.usd(g.cost_usd)),
+    ))),
+  );
+}
+
+// ---- request browser ----
+
+let cursor = "";
+
+async function loadRequests(reset) {
+  const table = $("#request-list");
+  if (reset) {
+    cursor = "";
+    table.replaceChildren(el("thead", {}, el("tr", {},
+      el("th", {}, "Time"), el("th", {}, "Model"), el("th", {}, "Agent"), el("th", {}, "Status"),
+      el("th", { class: "num" }, "Tokens"), el("th", { class: "num" }, "Cost"), el("th", {}, "Stop"))), el("tbody"));
+  }
+  const params = Object.fromEntries(new FormData($("#filters")));
+  params.cursor = cursor;
+  try {
+    const page = await api("requests", params);
+    const body = table.tBodies[0];
+    for (const r of page.requests) {
+      const status = r.incomplete ? "incomplete" : r.status_code || "?";
+      const row = el("tr", { onclick: () => { body.querySelectorAll(".selected").forEach((e) => e.classList.remove("selected")); row.classList.add("selected"); showDetail(r.id); } },
+        el("td", {}, fmt.time(r.timestamp)),
+        el("td", {}, r.model || ""),
+        el("td", {}, r.agent || ""),
+        el("td", { class: r.success ? "" : "bad" }, status + (r.stream ? " ⇶" : "")),
+        el("td", { class: "num" }, fmt.short(r.input_tokens + r.output_tokens)),
+        el("td", { class: "num" }, fmt.usd(r.cost_usd)),
+        el("td", {}, r.stop_reason || ""));
+      body.append(row);
+      for (const h of (page.highlights || {})[r.id] || []) {
+        // Snippets are HTML-escaped by the API, apart from <mark>.
+        const snippet = el("span");
+        snippet.innerHTML = h.snippet;
+        body.append(el("tr", { class: "hit", onclick: () => row.click() },
+          el("td", { colspan: 7 }, el("span", { class: "field" }, h.field), snippet)));
+      }
+    }
+    cursor = page.next_cursor || "";
+    $("#more").hidden = !cursor;
+  } catch (err) {
+    table.tBodies[0].append(el("tr", {}, el("td", { class: "bad", colspan: 7 }, err.message)));
+  }
+}
+$("#filters").addEventListener("submit", (e) => { e.preventDefault(); $("#detail").hidden = true; loadRequests(true); });
+$("#more").addEventListener("click", () => loadRequests(false));
+
+// blockText renders message content (a string or content blocks) as text.
+function blockText(content) {
+  if (typeof content === "string") return content;
+  return (content || []).map((b) => {
+    switch (b.type) {
+      case "text": return b.text;
+      case "thinking": return "[thinking] " + (b.thinking || "");
+      case "tool_use": return `[tool_use ${b.name}] ${JSON.stringify(b.input)}`;
+      case "tool_result": return "[tool_result] " + blockText(b.content);
+      default: return `[${b.type}]`;
+    }
+  }).join("\n");
+}
+
+function message(role, content) {
+  return el("div", { class: "msg " + role }, el("div", { class: "role" }, role), blockText(content));
+}
+
+async function showDetail(id) {
+  const aside = $("#detail");
+  aside.hidden = false;
+  aside.replaceChildren(el("p", { class: "muted" }, "Loading…"));
+  try {
+    const { request: r, payload: p } = await api("requests/" + id);
+    const facts = [
+      ["ID", r.id], ["Time", fmt.time(r.timestamp)], ["Model", r.model], ["Agent", r.agent],
+      ["Key", r.key_fingerprint], ["Conversation", r.conversation_id], ["Status", r.status_code],
+      ["Stop reason", r.stop_reason], ["Error", r.error_message], ["Latency", r.response_time_ms + " ms"],
+      ["Tokens in / out", `${fmt.int(r.input_tokens)} / ${fmt.int(r.output_tokens)}`],
+      ["Cache read / write", `${fmt.int(r.cache_read_tokens)} / ${fmt.int(r.cache_creation_tokens)}`],
+      ["Cost", fmt.usd(r.cost_usd)], ["Source", r.imported ? "imported from local history" : r.cache_hit ? "response cache" : undefined],
+    ].filter(([, v]) => v !== undefined && v !== "" && v !== 0);
+    const parts = [el("dl", {}, facts.map(([k, v]) => [el("dt", {}, k), el("dd", {}, v)]))];
+    const transcript = (path, label) => [
+      el("a", { href: `/api/v1/${path}/transcript?format=html`, target: "_blank" }, label),
+      " (", el("a", { href: `/api/v1/${path}/transcript?format=markdown`, target: "_blank" }, "Markdown"), ")",
+    ];
+    parts.push(el("p", { class: "links" },
+      transcript("requests/" + r.id, "Transcript"),
+      r.conversation_id ? [" · ", transcript("conversations/" + encodeURIComponent(r.conversation_id), "Conversation transcript")] : null));
+
+    if (p) {
+      const req = p.request_body || {};
+      if (p.system_prompt) parts.push(message("system", p.system_prompt));
+      for (const m of req.messages || []) parts.push(message(m.role, m.content));
+      const resp = p.response_body;
+      if (resp && typeof resp === "object" && resp.content) parts.push(message("assistant", resp.content));
+      parts.push(
+        el("details", {}, el("summary", {}, "Request JSON"), el("pre", {}, JSON.stringify(req, null, 2))),
+        el("details", {}, el("summary", {}, "Response JSON"), el("pre", {}, JSON.stringify(resp, null, 2))),
+        el("details", {}, el("summary", {}, "Headers"), el("pre", {}, JSON.stringify({ request: p.request_headers, response: p.response_headers }, null, 2))),
+      );
+    } else {
+      parts.push(el("p", { class: "muted" }, "No payload stored."));
+    }
+    if (r.stream) {
+      const events = el("details", {}, el("summary", {}, "SSE timeline"));
+      events.addEventListener("toggle", async () => {
+        if (!events.open || events.dataset.loaded) return;
+        events.dataset.loaded = "1";
+        const { events: evs } = await api(`requests/${id}/events`);
+        events.append(el("pre", {}, evs.map((e) => `${e.index}\t${e.type}\t${JSON.stringify(e.data)}`).join("\n")));
+      });
+      parts.push(events);
+    }
+    aside.replaceChildren(...parts);
+  } catch (err) {
+    aside.replaceChildren(el("p", { class: "bad" }, err.message));
+  }
+}
+
+// ---- live tail ----
+
+let source = null;
+const liveRows = new Map();
+const maxLive = 50;
+
+function startLive() {
+  stopLive();
+  const q = new URLSearchParams();
+  if ($("#live-deltas").checked) q.set("deltas", "true");
+  if ($("#live-model").value) q.set("model", $("#live-model").value);
+  if ($("#live-agent").value) q.set("agent", $("#live-agent").value);
+  source = new EventSource("/admin/live?" + q);
+  source.onopen = () => ($("#live-state").textContent = "connected");
+  source.onerror = () => ($("#live-state").textContent = "reconnecting…");
+  source.addEventListener("request.start", (e) => liveStart(JSON.parse(e.data)));
+  source.addEventListener("content.delta", (e) => liveDelta(JSON.parse(e.data)));
+  source.addEventListener("request.end", (e) => liveEnd(JSON.parse(e.data)));
+  $("#live-toggle").textContent = "Pause";
+}
+
+function stopLive() {
+  if (source) source.close();
+  source = null;
+  $("#live-state").textContent = "paused";
+  $("#live-toggle").textContent = "Resume";
+}
+
+function liveRow(ev) {
+  let row = liveRows.get(ev.request_id);
+  if (!row) {
+    row = {
+      head: el("div", { class: "head" }),
+      text: el("div", { class: "text" }),
+    };
+    row.node = el("div", { class: "req" }, row.head, row.text);
+    liveRows.set(ev.request_id, row);
+    $("#live-list").prepend(row.node);
+    while (liveRows.size > maxLive) {
+      const [oldest] = liveRows.keys();
+      liveRows.get(oldest).node.remove();
+      liveRows.delete(oldest);
+    }
+  }
+  return row;
+}
+
+function liveStart(ev) {
+  const row = liveRow(ev);
+  row.head.replaceChildren(
+    el("span", {}, new Date(ev.ts).toLocaleTimeString()),
+    el("strong", {}, ev.model || "?"),
+    el("span", {}, ev.agent || ""),
+    el("span", { class: "muted" }, ev.stream ? "streaming…" : "waiting…"),
+  );
+}
+
+function liveDelta(ev) {
+  const row = liveRow(ev);
+  row.text.append(ev.delta_type === "text" ? ev.delta : el("span", { class: "muted" }, ev.delta));
+  row.text.scrollTop = row.text.scrollHeight;
+}
+
+function liveEnd(ev) {
+  const row = liveRow(ev);
+  row.node.classList.add("done");
+  const usage = ev.usage ? `${fmt.int(ev.usage.input_tokens)} in / ${fmt.int(ev.usage.output_tokens)} out` : "";
+  row.head.replaceChildren(
+    el("span", {}, new Date(ev.ts).toLocaleTimeString()),
+    el("strong", {}, ev.model || "?"),
+    el("span", {}, ev.agent || ""),
+    el("span", { class: ev.status_code >= 400 || ev.error ? "bad" : "" }, ev.error || ev.status_code || ""),
+    el("span", {}, ev.stop_reason || ""),
+    el("span", {}, usage),
+    el("span", {}, ev.cost_usd ? fmt.usd(ev.cost_usd) : ""),
+    el("span", { class: "muted" }, ev.duration_ms ? ev.duration_ms + " ms" : ""),
+  );
+}
+
+$("#live-toggle").addEventListener("click", () => (source ? stopLive() : startLive()));
+for (const id of ["#live-deltas", "#live-model", "#live-agent"]) {
+  $(id).addEventListener("change", () => source && startLive());
+}
+
+show(location.hash.slice(1) || "overview");
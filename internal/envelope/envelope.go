@@ -0,0 +1,242 @@
+// Package envelope implements envelope encryption for values stored at rest.
+//
+// Every value is encrypted with its own random 256-bit data key using
+// AES-GCM. The data key is wrapped by a master key from the Keyring and
+// stored next to the ciphertext, so rotating master keys only requires
+// re-wrapping data keys, never re-encrypting bodies. A sealed value is a
+// self-describing JSON object:
+//
+//	{"$enc":1,"kid":"<master key id>","dk":"<wrapped data key>","ct":"<ciphertext>"}
+//
+// which keeps it valid in JSONB columns. JSONB does not preserve key order or
+// whitespace, so sealed values are recognised structurally rather than by
+// prefix. Plaintext can take the same shape, so Seal never skips values that
+// look sealed, and Reseal relies on the caller's record of which values are.
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const version = 1
+
+var sealedMarker = []byte(`"$enc"`)
+
+type sealed struct {
+	Version    int    `json:"$enc"`
+	KeyID      string `json:"kid"`
+	DataKey    []byte `json:"dk"`
+	Ciphertext []byte `json:"ct"`
+}
+
+// Keyring holds master keys by ID. New values are sealed with the active
+// key; any key in the ring can open existing values.
+type Keyring struct {
+	keys    map[string]cipher.AEAD
+	macKeys map[string][]byte
+	active  string
+}
+
+// ParseKeyring parses a comma-separated list of id:base64key pairs. Keys
+// must decode to 32 bytes. When active is empty the first key is active.
+func ParseKeyring(spec, active string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD), macKeys: make(map[string][]byte)}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key entry %q, want id:base64key", entry)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decode key %s: %w", id, err)
+		}
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", id)
+		}
+		k.keys[id] = aead
+		k.macKeys[id] = deriveMACKey(raw)
+		if k.active == "" {
+			k.active = id
+		}
+	}
+	if len(k.keys) == 0 {
+		return nil, errors.New("no keys configured")
+	}
+	if active != "" {
+		if _, ok := k.keys[active]; !ok {
+			return nil, fmt.Errorf("active key %q is not in the keyring", active)
+		}
+		k.active = active
+	}
+	return k, nil
+}
+
+// GenerateKey returns a new random master key, base64 encoded.
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// KeyID returns the ID of the active master key.
+func (k *Keyring) KeyID() string {
+	return k.active
+}
+
+// MAC returns the HMAC-SHA256 of value under a key derived from the active
+// master key, to name content without revealing a hash of it.
+func (k *Keyring) MAC(value []byte) []byte {
+	mac := hmac.New(sha256.New, k.macKeys[k.active])
+	mac.Write(value)
+	return mac.Sum(nil)
+}
+
+// deriveMACKey keeps MAC keys apart from the master keys wrapping data keys.
+func deriveMACKey(master []byte) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("sidekick mac key"))
+	return mac.Sum(nil)
+}
+
+// Seal encrypts plaintext under a fresh data key wrapped by the active
+// master key.
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := seal(aead, plaintext, nil)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.keys[k.active], dataKey, []byte(k.active))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealed{Version: version, KeyID: k.active, DataKey: wrapped, Ciphertext: ct})
+}
+
+// Open decrypts a sealed value. Values that are not sealed (written before
+// encryption was enabled) are returned unchanged.
+func (k *Keyring) Open(value []byte) ([]byte, error) {
+	env, ok := parse(value)
+	if !ok {
+		return value, nil
+	}
+	dataKey, err := k.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, env.Ciphertext, nil)
+}
+
+// Reseal brings a stored value up to the active master key. sealed is
+// whether the caller recorded value as sealed: sealed values get their data
+// key re-wrapped, plaintext values are sealed.
+func (k *Keyring) Reseal(value []byte, sealed bool) ([]byte, error) {
+	if !sealed {
+		return k.Seal(value)
+	}
+	env, ok := parse(value)
+	if !ok {
+		return nil, errors.New("value recorded as sealed is not an envelope")
+	}
+	if env.KeyID == k.active {
+		return value, nil
+	}
+	dataKey, err := k.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+	env.DataKey, err = seal(k.keys[k.active], dataKey, []byte(k.active))
+	if err != nil {
+		return nil, err
+	}
+	env.KeyID = k.active
+	return json.Marshal(env)
+}
+
+func (k *Keyring) unwrap(env *sealed) ([]byte, error) {
+	master, ok := k.keys[env.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q not in keyring", env.KeyID)
+	}
+	dataKey, err := open(master, env.DataKey, []byte(env.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// parse decodes value as an envelope. Anything that is not a JSON object
+// with all envelope fields is treated as plaintext.
+func parse(value []byte) (*sealed, bool) {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, sealedMarker) {
+		return nil, false
+	}
+	var env sealed
+	if err := json.Unmarshal(trimmed, &env); err != nil {
+		return nil, false
+	}
+	if env.Version != version || env.KeyID == "" || len(env.DataKey) == 0 || len(env.Ciphertext) == 0 {
+		return nil, false
+	}
+	return &env, true
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce || ciphertext.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, data, aad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ct := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ct, aad)
+}
@@ -0,0 +1,150 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKeys(t *testing.T, n int) []string {
+	t.Helper()
+	var keys []string
+	for i := range n {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(rune('a'+i))+":"+key)
+	}
+	return keys
+}
+
+func keyring(t *testing.T, spec []string, active string) *Keyring {
+	t.Helper()
+	k, err := ParseKeyring(strings.Join(spec, ","), active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := keyring(t, testKeys(t, 1), "")
+	for _, plaintext := range []string{`{"model":"m"}`, "not json", ""} {
+		sealed, err := k.Seal([]byte(plaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != "" && bytes.Contains(sealed, []byte(plaintext)) {
+			t.Errorf("plaintext %q visible in %s", plaintext, sealed)
+		}
+		got, err := k.Open(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != plaintext {
+			t.Errorf("Open = %q; want %q", got, plaintext)
+		}
+	}
+
+	again, _ := k.Seal([]byte("x"))
+	once, _ := k.Seal([]byte("x"))
+	if bytes.Equal(again, once) {
+		t.Error("sealing twice gave the same ciphertext")
+	}
+}
+
+func TestSealAlwaysSeals(t *testing.T) {
+	k := keyring(t, testKeys(t, 1), "")
+	// Plaintext shaped like an envelope must not be stored as it is.
+	lookalike, _ := k.Seal([]byte("inner"))
+	sealed, err := k.Seal(lookalike)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, lookalike) {
+		t.Fatal("envelope-shaped plaintext stored unsealed")
+	}
+	got, err := k.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, lookalike) {
+		t.Errorf("Open = %s; want the original plaintext %s", got, lookalike)
+	}
+}
+
+func TestOpenPlaintext(t *testing.T) {
+	k := keyring(t, testKeys(t, 1), "")
+	got, err := k.Open([]byte(`{"written":"before encryption"}`))
+	if err != nil || string(got) != `{"written":"before encryption"}` {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+}
+
+func TestReseal(t *testing.T) {
+	keys := testKeys(t, 2)
+	old := keyring(t, keys, "a")
+	rotated := keyring(t, keys, "b")
+
+	sealed, _ := old.Seal([]byte("body"))
+	resealed, err := rotated.Reseal(sealed, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env, _ := parse(resealed); env.KeyID != "b" {
+		t.Errorf("resealed under %q; want b", env.KeyID)
+	}
+	// Only key b is needed from now on.
+	onlyB := keyring(t, keys[1:], "")
+	if got, err := onlyB.Open(resealed); err != nil || string(got) != "body" {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+	if _, err := onlyB.Open(sealed); err == nil {
+		t.Error("opened a value sealed under a key not in the ring")
+	}
+
+	if same, _ := rotated.Reseal(resealed, true); !bytes.Equal(same, resealed) {
+		t.Error("value under the active key rewritten")
+	}
+
+	plain, err := rotated.Reseal([]byte("plain"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := rotated.Open(plain); string(got) != "plain" {
+		t.Errorf("sealed plaintext opens to %q", got)
+	}
+
+	if _, err := rotated.Reseal([]byte("plain"), true); err == nil {
+		t.Error("plaintext recorded as sealed accepted")
+	}
+}
+
+func TestMAC(t *testing.T) {
+	keys := testKeys(t, 2)
+	a := keyring(t, keys, "a")
+	if !bytes.Equal(a.MAC([]byte("x")), keyring(t, keys, "a").MAC([]byte("x"))) {
+		t.Error("MAC not deterministic")
+	}
+	if bytes.Equal(a.MAC([]byte("x")), a.MAC([]byte("y"))) {
+		t.Error("MAC ignores the value")
+	}
+	if bytes.Equal(a.MAC([]byte("x")), keyring(t, keys, "b").MAC([]byte("x"))) {
+		t.Error("MAC ignores the key")
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	short := "k:" + base64.StdEncoding.EncodeToString([]byte("short"))
+	valid := testKeys(t, 1)[0]
+	for _, spec := range []string{"", short, "nokey", valid + "," + valid} {
+		if _, err := ParseKeyring(spec, ""); err == nil {
+			t.Errorf("ParseKeyring(%q) accepted", spec)
+		}
+	}
+	if _, err := ParseKeyring(valid, "missing"); err == nil {
+		t.Error("unknown active key accepted")
+	}
+}
@@ -0,0 +1,92 @@
+// Package events publishes sidekick's domain events: typed JSON documents
+// describing what happened to a request, for tools that should not have to
+// parse SSE.
+//
+// Every event is published on sidekick.events.v1.<type> and stored in the
+// SIDEKICK_EVENTS stream, so consumers can replay what they missed. The
+// payload is an Envelope whose data field holds the type's schema:
+//
+//	request.completed  RequestCompleted  a response finished and was recorded
+//	tool.called        ToolCalled        one per tool_use block in a response
+//	request.failed     RequestFailed     upstream error, error status or broken stream
+//	budget.threshold   BudgetThreshold   spend in a budget window crossed a threshold
+//
+// Fields are only ever added within a version; a breaking change gets a new
+// subject version (v2) published alongside v1.
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
+)
+
+const (
+	Version       = 1
+	SubjectPrefix = "sidekick.events.v1."
+)
+
+// Event types.
+const (
+	RequestCompletedType = "request.completed"
+	ToolCalledType       = "tool.called"
+	RequestFailedType    = "request.failed"
+	BudgetThresholdType  = "budget.threshold"
+)
+
+func Subject(eventType string) string {
+	return SubjectPrefix + eventType
+}
+
+// Envelope wraps every event. ID is stable for a given occurrence, so a
+// request processed twice (e.g. after a redelivery) yields the same IDs and
+// consumers can deduplicate on it.
+type Envelope struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type RequestCompleted struct {
+	RequestID  string        `json:"request_id"`
+	Timestamp  time.Time     `json:"timestamp"` // when the request arrived
+	Model      string        `json:"model"`
+	MessageID  string        `json:"message_id,omitempty"`
+	Stream     bool          `json:"stream"`
+	StopReason string        `json:"stop_reason,omitempty"`
+	Usage      pricing.Usage `json:"usage"`
+	CostUSD    float64       `json:"cost_usd"`
+	ToolCalls  int           `json:"tool_calls"`
+}
+
+// ToolCalled carries the tool's input unless content is encrypted at rest
+// (see EVENTS_TOOL_INPUT).
+type ToolCalled struct {
+	RequestID string          `json:"request_id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Model     string          `json:"model"`
+	ToolUseID string          `json:"tool_use_id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input,omitempty"`
+}
+
+type RequestFailed struct {
+	RequestID  string    `json:"request_id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Model      string    `json:"model,omitempty"`
+	Stream     bool      `json:"stream"`
+	StatusCode int       `json:"status_code,omitempty"` // 0 when no response arrived
+	ErrorType  string    `json:"error_type,omitempty"`  // Anthropic error type, or "incomplete_stream"
+	Message    string    `json:"message,omitempty"`
+}
+
+type BudgetThreshold struct {
+	Period       string  `json:"period"` // daily | monthly
+	Window       string  `json:"window"` // 2006-01-02 or 2006-01, UTC
+	ThresholdPct int     `json:"threshold_pct"`
+	LimitUSD     float64 `json:"limit_usd"`
+	SpentUSD     float64 `json:"spent_usd"`
+}
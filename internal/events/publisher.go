@@ -0,0 +1,119 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const StreamName = "SIDEKICK_EVENTS"
+
+type StreamOptions struct {
+	Replicas int
+	MaxAge   time.Duration
+}
+
+// EnsureStream creates the events stream or updates its retention.
+func EnsureStream(js nats.JetStreamContext, opts StreamOptions) error {
+	want := &nats.StreamConfig{
+		Name:        StreamName,
+		Description: "sidekick domain events",
+		Subjects:    []string{SubjectPrefix + ">"},
+		Storage:     nats.FileStorage,
+		Retention:   nats.LimitsPolicy,
+		MaxAge:      opts.MaxAge,
+		Replicas:    max(opts.Replicas, 1),
+		Duplicates:  2 * time.Minute,
+	}
+	info, err := js.StreamInfo(StreamName)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(want)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	have := info.Config
+	if have.MaxAge == want.MaxAge && have.Replicas == want.Replicas {
+		return nil
+	}
+	have.MaxAge = want.MaxAge
+	have.Replicas = want.Replicas
+	if _, err := js.UpdateStream(&have); err != nil {
+		return fmt.Errorf("update stream %s: %w", StreamName, err)
+	}
+	return nil
+}
+
+// Publisher sends domain events. Publishing is asynchronous and never blocks
+// request processing; failures are logged. A nil Publisher drops events.
+type Publisher struct {
+	js nats.JetStreamContext
+	// toolInput keeps tool inputs in tool.called events. They are left
+	// out while content is encrypted at rest, as the events stream is not.
+	toolInput bool
+}
+
+// NewPublisher returns a Publisher; toolInput says whether tool.called
+// events carry the tool's input.
+func NewPublisher(nc *nats.Conn, toolInput bool) (*Publisher, error) {
+	js, err := nc.JetStream(nats.PublishAsyncErrHandler(func(_ nats.JetStream, msg *nats.Msg, err error) {
+		log.Warn().Err(err).Str("subject", msg.Subject).Msg("failed to publish event")
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{js: js, toolInput: toolInput}, nil
+}
+
+func (p *Publisher) RequestCompleted(ev RequestCompleted) {
+	p.publish(RequestCompletedType, ev.RequestID, ev)
+}
+
+func (p *Publisher) ToolCalled(ev ToolCalled) {
+	if p != nil && !p.toolInput {
+		ev.Input = nil
+	}
+	p.publish(ToolCalledType, ev.RequestID+"."+ev.ToolUseID, ev)
+}
+
+func (p *Publisher) RequestFailed(ev RequestFailed) {
+	p.publish(RequestFailedType, ev.RequestID, ev)
+}
+
+func (p *Publisher) BudgetThreshold(ev BudgetThreshold) {
+	p.publish(BudgetThresholdType, fmt.Sprintf("%s.%s.%d", ev.Period, ev.Window, ev.ThresholdPct), ev)
+}
+
+// publish sends one event. key identifies the occurrence within its type;
+// JetStream drops repeats of the same ID within its duplicate window.
+func (p *Publisher) publish(eventType, key string, data any) {
+	if p == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	env := Envelope{
+		ID:      eventType + ":" + key,
+		Type:    eventType,
+		Version: Version,
+		Time:    time.Now().UTC(),
+		Data:    payload,
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		return
+	}
+	msg := nats.NewMsg(Subject(eventType))
+	msg.Header.Set(nats.MsgIdHdr, env.ID)
+	msg.Data = body
+	if _, err := p.js.PublishMsgAsync(msg); err != nil {
+		log.Warn().Err(err).Str("event", eventType).Msg("failed to publish event")
+	}
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+)
+
+func TestToolCalledInput(t *testing.T) {
+	srv, err := jetstream.NewServer(t.TempDir(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown()
+	nc, err := srv.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureStream(js, StreamOptions{MaxAge: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := nc.SubscribeSync(Subject(ToolCalledType))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, toolInput := range []bool{true, false} {
+		pub, err := NewPublisher(nc, toolInput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub.ToolCalled(ToolCalled{RequestID: fmt.Sprint(toolInput), ToolUseID: "t", Name: "bash", Input: json.RawMessage(`{"command":"rm -rf migrations"}`)})
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var env Envelope
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(msg.Data, &env); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(env.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := data["input"]; ok != toolInput {
+			t.Errorf("toolInput %v: event data %s", toolInput, env.Data)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package export writes stored requests in bulk, oldest first, as JSON
+// Lines or Parquet for analysis outside sidekick. Rows can carry the
+// request's payload and the tool calls of its response.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// Options select the optional parts of a Row.
+type Options struct {
+	Payloads  bool // system prompt, request and response bodies
+	ToolCalls bool // tool_use blocks of the response
+}
+
+// Row is one exported request. Payload and tool call fields are empty
+// unless requested in Options.
+type Row struct {
+	ID                   uuid.UUID `json:"id" parquet:"id,uuid"`
+	Timestamp            time.Time `json:"timestamp" parquet:"timestamp,timestamp(microsecond)"`
+	Method               string    `json:"method" parquet:"method,dict"`
+	Path                 string    `json:"path" parquet:"path,dict"`
+	StatusCode           int32     `json:"status_code" parquet:"status_code"`
+	Success              bool      `json:"success" parquet:"success"`
+	Incomplete           bool      `json:"incomplete" parquet:"incomplete"`
+	ErrorMessage         string    `json:"error_message,omitempty" parquet:"error_message,optional"`
+	ResponseTimeMs       int32     `json:"response_time_ms" parquet:"response_time_ms"`
+	Model                string    `json:"model" parquet:"model,dict"`
+	IsStream             bool      `json:"stream" parquet:"stream"`
+	InputTokens          int64     `json:"input_tokens" parquet:"input_tokens"`
+	OutputTokens         int64     `json:"output_tokens" parquet:"output_tokens"`
+	CacheReadTokens      int64     `json:"cache_read_tokens" parquet:"cache_read_tokens"`
+	CacheCreationTokens  int64     `json:"cache_creation_tokens" parquet:"cache_creation_tokens"`
+	TotalTokens          int64     `json:"total_tokens" parquet:"total_tokens"`
+	CostUSD              float64   `json:"cost_usd" parquet:"cost_usd"`
+	TokensPerSecond      float32   `json:"tokens_per_second" parquet:"tokens_per_second"`
+	StopReason           string    `json:"stop_reason,omitempty" parquet:"stop_reason,optional,dict"`
+	MessageID            string    `json:"message_id,omitempty" parquet:"message_id,optional"`
+	Agent                string    `json:"agent,omitempty" parquet:"agent,optional,dict"`
+	KeyFingerprint       string    `json:"key_fingerprint,omitempty" parquet:"key_fingerprint,optional,dict"`
+	ConversationID       string    `json:"conversation_id,omitempty" parquet:"conversation_id,optional"`
+	ToolCount            int32     `json:"tool_count" parquet:"tool_count"`
+	ThinkingBudgetTokens int32     `json:"thinking_budget_tokens" parquet:"thinking_budget_tokens"`
+	Imported             bool      `json:"imported" parquet:"imported"`
+	CacheHit             bool      `json:"cache_hit" parquet:"cache_hit"`
+
+	SystemPrompt string     `json:"system_prompt,omitempty" parquet:"system_prompt,optional"`
+	RequestBody  JSON       `json:"request_body,omitempty" parquet:"request_body,optional,json"`
+	ResponseBody JSON       `json:"response_body,omitempty" parquet:"response_body,optional,json"`
+	ToolCalls    []ToolCall `json:"tool_calls,omitempty" parquet:"tool_calls,list"`
+}
+
+// JSON is a JSON document kept as text. parquet-go writes optional
+// json.RawMessage columns empty; strings it writes, and JSON Lines embed the
+// document as is.
+type JSON string
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+func (j *JSON) UnmarshalJSON(b []byte) error {
+	*j = JSON(b)
+	return nil
+}
+
+// ToolCall is a tool_use block of a response.
+type ToolCall struct {
+	ID    string          `json:"id" parquet:"id"`
+	Name  string          `json:"name" parquet:"name,dict"`
+	Input json.RawMessage `json:"input" parquet:"input,json"`
+}
+
+// Page lists up to limit requests matching f after the cursor, oldest
+// first, and reports whether more follow. f's own cursor, limit and order
+// are ignored.
+func Page(ctx context.Context, store storage.Store, f storage.RequestFilter, after *storage.RequestCursor, limit int) ([]storage.Request, bool, error) {
+	f.After, f.Ascending = after, true
+	// One extra row tells whether another page follows.
+	f.Limit = limit + 1
+	reqs, err := store.ListRequests(ctx, &f)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(reqs) > limit {
+		return reqs[:limit], true, nil
+	}
+	return reqs, false, nil
+}
+
+// WriteRows writes a row per request to w, loading payloads as opts
+// require.
+func WriteRows(ctx context.Context, store storage.Store, w Writer, reqs []storage.Request, opts Options) error {
+	for i := range reqs {
+		row, err := NewRow(ctx, store, &reqs[i], opts)
+		if err != nil {
+			return err
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewRow builds the row of req.
+func NewRow(ctx context.Context, store storage.Store, req *storage.Request, opts Options) (*Row, error) {
+	row := &Row{
+		ID:                   req.ID,
+		Timestamp:            req.Timestamp.UTC(),
+		Method:               req.Method,
+		Path:                 req.Path,
+		StatusCode:           int32(req.StatusCode),
+		Success:              req.Success,
+		Incomplete:           req.Incomplete,
+		ErrorMessage:         req.ErrorMessage,
+		ResponseTimeMs:       int32(req.ResponseTimeMs),
+		Model:                req.Model,
+		IsStream:             req.IsStream,
+		InputTokens:          int64(req.InputTokens),
+		OutputTokens:         int64(req.OutputTokens),
+		CacheReadTokens:      int64(req.CacheReadTokens),
+		CacheCreationTokens:  int64(req.CacheCreationTokens),
+		TotalTokens:          int64(req.TotalTokens),
+		CostUSD:              req.CostUSD,
+		TokensPerSecond:      req.TokensPerSecond,
+		StopReason:           req.StopReason,
+		MessageID:            req.MessageID,
+		Agent:                req.Agent,
+		KeyFingerprint:       req.KeyFingerprint,
+		ConversationID:       req.ConversationID,
+		ToolCount:            int32(req.ToolCount),
+		ThinkingBudgetTokens: int32(req.ThinkingBudgetTokens),
+		Imported:             req.Imported,
+		CacheHit:             req.CacheHit,
+	}
+	if !opts.Payloads && !opts.ToolCalls {
+		return row, nil
+	}
+
+	p, err := store.GetPayload(ctx, req.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return row, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.Payloads {
+		row.SystemPrompt = p.Extras.SystemPrompt
+		row.RequestBody = JSON(jsonValue(p.ReqBody))
+		row.ResponseBody = JSON(jsonValue(p.RespBody))
+	}
+	if opts.ToolCalls {
+		var resp processor.AnthropicResponse
+		if json.Unmarshal(p.RespBody, &resp) == nil {
+			for _, c := range resp.Content {
+				if c.Type == "tool_use" {
+					row.ToolCalls = append(row.ToolCalls, ToolCall{ID: c.ID, Name: c.Name, Input: jsonValue(c.Input)})
+				}
+			}
+		}
+	}
+	return row, nil
+}
+
+// jsonValue embeds a stored body as JSON, or as a JSON string when it is
+// not valid JSON (e.g. a raw SSE stream whose reconstruction failed).
+func jsonValue(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	if json.Valid(b) {
+		return b
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
@@ -0,0 +1,66 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Formats NewWriter accepts.
+var Formats = []string{"jsonl", "parquet"}
+
+// Writer encodes rows. Close completes the output (Parquet writes its
+// footer) but does not close the underlying io.Writer.
+type Writer interface {
+	Write(row *Row) error
+	Close() error
+}
+
+// NewWriter returns a Writer for one of Formats.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case "jsonl":
+		bw := bufio.NewWriter(w)
+		return &jsonlWriter{bw: bw, enc: json.NewEncoder(bw)}, nil
+	case "parquet":
+		return &parquetWriter{pw: parquet.NewGenericWriter[Row](w,
+			parquet.Compression(&parquet.Zstd),
+			// Bounds the rows buffered in memory, which matters with payloads.
+			parquet.MaxRowsPerRowGroup(rowGroupRows),
+		)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q: want jsonl or parquet", format)
+	}
+}
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	if format == "parquet" {
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+type jsonlWriter struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) Write(row *Row) error { return w.enc.Encode(row) }
+func (w *jsonlWriter) Close() error         { return w.bw.Flush() }
+
+const rowGroupRows = 1000
+
+type parquetWriter struct {
+	pw *parquet.GenericWriter[Row]
+}
+
+func (w *parquetWriter) Write(row *Row) error {
+	_, err := w.pw.Write([]Row{*row})
+	return err
+}
+
+func (w *parquetWriter) Close() error { return w.pw.Close() }
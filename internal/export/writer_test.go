@@ -0,0 +1,120 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParquetRoundTrip(t *testing.T) {
+	rows := []Row{
+		{
+			ID:           uuid.New(),
+			Timestamp:    time.Date(2026, 1, 2, 10, 0, 0, 123456000, time.UTC),
+			Method:       "POST",
+			Path:         "/v1/messages",
+			StatusCode:   200,
+			Success:      true,
+			Model:        "claude-sonnet-4-5",
+			IsStream:     true,
+			InputTokens:  12,
+			OutputTokens: 7,
+			TotalTokens:  19,
+			CostUSD:      0.25,
+			StopReason:   "tool_use",
+			SystemPrompt: "be brief",
+			RequestBody:  `{"model":"claude-sonnet-4-5"}`,
+			ResponseBody: `{"id":"msg_1"}`,
+			ToolCalls: []ToolCall{
+				{ID: "t1", Name: "bash", Input: json.RawMessage(`{"command":"ls"}`)},
+				{ID: "t2", Name: "read", Input: json.RawMessage(`{"path":"go.mod"}`)},
+			},
+		},
+		{
+			// Optional fields and payloads left out.
+			ID:           uuid.New(),
+			Timestamp:    time.Date(2026, 1, 2, 10, 0, 1, 0, time.UTC),
+			Method:       "POST",
+			Path:         "/v1/messages",
+			StatusCode:   529,
+			ErrorMessage: "overloaded",
+			Model:        "claude-haiku-4-5",
+		},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range rows {
+		if err := w.Write(&rows[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := parquet.Read[Row](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("read %d rows; want %d", len(got), len(rows))
+	}
+	for i := range rows {
+		if len(got[i].ToolCalls) == 0 {
+			got[i].ToolCalls = nil // lists read back empty, not nil
+		}
+		if !reflect.DeepEqual(got[i], rows[i]) {
+			t.Errorf("row %d:\n got %+v\nwant %+v", i, got[i], rows[i])
+		}
+	}
+}
+
+func TestParquetSchema(t *testing.T) {
+	schema := parquet.SchemaOf(Row{})
+	for _, tt := range []struct {
+		column []string
+		want   string // logical type
+	}{
+		{[]string{"id"}, "UUID"},
+		{[]string{"timestamp"}, "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)"},
+		{[]string{"request_body"}, "JSON"},
+		{[]string{"tool_calls", "list", "element", "input"}, "JSON"},
+	} {
+		col, ok := schema.Lookup(tt.column...)
+		if !ok {
+			t.Errorf("no column %v", tt.column)
+			continue
+		}
+		if lt := col.Node.Type().LogicalType(); lt == nil || lt.String() != tt.want {
+			t.Errorf("column %v has logical type %v; want %s", tt.column, lt, tt.want)
+		}
+	}
+}
+
+func TestJSONLEmbedsBodies(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, "jsonl")
+	w.Write(&Row{RequestBody: `{"model":"m"}`})
+	w.Write(&Row{})
+	w.Close()
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var first struct {
+		RequestBody map[string]any `json:"request_body"`
+	}
+	if err := json.Unmarshal(lines[0], &first); err != nil || first.RequestBody["model"] != "m" {
+		t.Errorf("request_body = %v (%v); want the embedded document", first.RequestBody, err)
+	}
+	if bytes.Contains(lines[1], []byte("request_body")) {
+		t.Errorf("empty body exported: %s", lines[1])
+	}
+}
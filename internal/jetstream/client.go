@@ -0,0 +1,45 @@
+package jetstream
+
+import (
+	"errors"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// ClientOptions configures a connection to an external NATS server, used
+// instead of the embedded one.
+type ClientOptions struct {
+	URL      string
+	Creds    string // JWT credentials file
+	User     string
+	Password string
+
+	TLSCA   string
+	TLSCert string
+	TLSKey  string
+}
+
+// Dial connects to an external NATS server. The connection retries forever
+// so a NATS failover does not take the proxy down.
+func Dial(opts ClientOptions) (*nats.Conn, error) {
+	o := []nats.Option{
+		nats.Name("sidekick"),
+		nats.MaxReconnects(-1),
+	}
+	if opts.Creds != "" {
+		o = append(o, nats.UserCredentials(opts.Creds))
+	}
+	if opts.User != "" {
+		o = append(o, nats.UserInfo(opts.User, opts.Password))
+	}
+	if opts.TLSCA != "" {
+		o = append(o, nats.RootCAs(opts.TLSCA))
+	}
+	if opts.TLSCert != "" || opts.TLSKey != "" {
+		if opts.TLSCert == "" || opts.TLSKey == "" {
+			return nil, errors.New("NATS client TLS needs both a certificate and a key")
+		}
+		o = append(o, nats.ClientCert(opts.TLSCert, opts.TLSKey))
+	}
+	return nats.Connect(opts.URL, o...)
+}
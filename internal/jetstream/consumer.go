@@ -0,0 +1,47 @@
+package jetstream
+
+import (
+	"errors"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// ConsumerName is the durable consumer the processor reads end-of-stream
+// markers through. Its delivery state lives in JetStream, so unfinished work
+// survives restarts, and every replica pulls from it, so any replica can
+// process any request.
+const ConsumerName = "sidekick-processor"
+
+type ConsumerOptions struct {
+	// AckWait is how long a delivered marker may go without an ack or
+	// progress signal before JetStream redelivers it. The processor keeps
+	// the markers it holds alive, so this bounds how long a crashed
+	// replica's work waits before another replica picks it up.
+	AckWait       time.Duration
+	MaxAckPending int
+}
+
+// EnsureConsumer creates the processor's durable pull consumer, or updates
+// its settings if it already exists.
+func EnsureConsumer(js nats.JetStreamContext, opts ConsumerOptions) error {
+	cfg := &nats.ConsumerConfig{
+		Durable:       ConsumerName,
+		Description:   "sidekick analytics processor",
+		FilterSubject: SubjectPrefix + "*.done",
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       opts.AckWait,
+		MaxAckPending: opts.MaxAckPending,
+	}
+	_, err := js.ConsumerInfo(StreamName, ConsumerName)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(StreamName, cfg)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = js.UpdateConsumer(StreamName, cfg)
+	return err
+}
@@ -1,21 +1,92 @@
 package jetstream
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	server "github.com/nats-io/nats-server/v2/server"
 	nats "github.com/nats-io/nats.go"
 )
 
-type Server struct{ ns *server.Server }
+// ListenOptions exposes the embedded server on a network port for external
+// subscribers. External users may only subscribe to sidekick.> subjects.
+type ListenOptions struct {
+	Addr     string // host:port
+	User     string
+	Password string
+	NKeys    []string // public user nkeys, as an alternative to User/Password
 
-func NewServer(storeDir string) (*Server, error) {
-	ns, err := server.NewServer(&server.Options{
+	TLSCert string
+	TLSKey  string
+	TLSCA   string // when set, clients must present a certificate signed by it
+}
+
+// ClusterOptions joins the embedded server to a NATS cluster of sidekick
+// replicas so they share one JetStream. Clustered JetStream needs at least
+// three servers to elect a leader.
+//
+// Routes carry every chunk, so they must be authenticated: with a shared
+// user and password, with mutual TLS, or both.
+type ClusterOptions struct {
+	ServerName string // unique per replica
+	Name       string
+	Addr       string   // host:port for cluster routes
+	Routes     []string // nats-route://host:port of the other replicas
+	User       string
+	Password   string
+
+	TLSCert string
+	TLSKey  string
+	TLSCA   string // routes must present a certificate signed by it
+}
+
+// internalUser is the account the in-process connection authenticates as
+// once the server has a client port.
+const internalUser = "sidekick-internal"
+
+type Server struct {
+	ns           *server.Server
+	internalPass string
+}
+
+// NewServer starts the embedded NATS server. With listen nil the server
+// accepts in-process connections only; with cluster nil it runs standalone.
+func NewServer(storeDir string, listen *ListenOptions, cluster *ClusterOptions) (*Server, error) {
+	opts := &server.Options{
 		DontListen: true,
 		JetStream:  true,
 		StoreDir:   storeDir,
-	})
+		// sidekick shuts the server down itself, after the processor and
+		// writer have flushed and acked.
+		NoSigs: true,
+	}
+	s := &Server{}
+	if listen != nil || cluster != nil {
+		var err error
+		if s.internalPass, err = randomPassword(); err != nil {
+			return nil, err
+		}
+		opts.Users = []*server.User{{Username: internalUser, Password: s.internalPass}}
+	}
+	if listen != nil {
+		if err := configureListener(opts, listen); err != nil {
+			return nil, err
+		}
+	}
+	if cluster != nil {
+		if err := configureCluster(opts, cluster); err != nil {
+			return nil, err
+		}
+	}
+
+	ns, err := server.NewServer(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -23,11 +94,147 @@ func NewServer(storeDir string) (*Server, error) {
 	if !ns.ReadyForConnections(5 * time.Second) {
 		return nil, fmt.Errorf("NATS server not ready")
 	}
-	return &Server{ns: ns}, nil
+	s.ns = ns
+	return s, nil
 }
 
+func configureListener(opts *server.Options, listen *ListenOptions) error {
+	host, portStr, err := net.SplitHostPort(listen.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid NATS listen address %q: %w", listen.Addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid NATS listen port %q", portStr)
+	}
+	if listen.User == "" && len(listen.NKeys) == 0 {
+		return errors.New("NATS listener requires a user/password or nkeys")
+	}
+	if listen.User != "" && listen.Password == "" {
+		return errors.New("NATS listener user has no password")
+	}
+
+	opts.DontListen = false
+	opts.Host = host
+	opts.Port = port
+
+	readOnly := &server.Permissions{
+		Publish:   &server.SubjectPermission{Deny: []string{">"}},
+		Subscribe: &server.SubjectPermission{Allow: []string{"sidekick.>"}},
+	}
+	if listen.User != "" {
+		opts.Users = append(opts.Users, &server.User{
+			Username:    listen.User,
+			Password:    listen.Password,
+			Permissions: readOnly,
+		})
+	}
+	for _, key := range listen.NKeys {
+		opts.Nkeys = append(opts.Nkeys, &server.NkeyUser{Nkey: key, Permissions: readOnly})
+	}
+
+	if listen.TLSCert != "" || listen.TLSKey != "" {
+		tc, err := server.GenTLSConfig(&server.TLSConfigOpts{
+			CertFile: listen.TLSCert,
+			KeyFile:  listen.TLSKey,
+			CaFile:   listen.TLSCA,
+			Verify:   listen.TLSCA != "",
+		})
+		if err != nil {
+			return fmt.Errorf("NATS listener TLS: %w", err)
+		}
+		opts.TLS = true
+		opts.TLSConfig = tc
+		opts.TLSVerify = listen.TLSCA != ""
+	}
+	return nil
+}
+
+func configureCluster(opts *server.Options, cluster *ClusterOptions) error {
+	host, portStr, err := net.SplitHostPort(cluster.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid NATS cluster address %q: %w", cluster.Addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid NATS cluster port %q", portStr)
+	}
+	if cluster.ServerName == "" {
+		return errors.New("NATS cluster requires a server name")
+	}
+	if cluster.User == "" && cluster.TLSCert == "" {
+		return errors.New("NATS cluster requires route credentials or TLS")
+	}
+	if cluster.User != "" && cluster.Password == "" {
+		return errors.New("NATS cluster user has no password")
+	}
+
+	if opts.DontListen {
+		// Routes only start once the server accepts clients. Without an
+		// external listener, accept them on a random loopback port that
+		// only the internal user can use.
+		opts.DontListen = false
+		opts.Host = "127.0.0.1"
+		opts.Port = server.RANDOM_PORT
+	}
+	opts.ServerName = cluster.ServerName
+	opts.Cluster = server.ClusterOpts{
+		Name:     cluster.Name,
+		Host:     host,
+		Port:     port,
+		Username: cluster.User,
+		Password: cluster.Password,
+	}
+	if cluster.TLSCert != "" || cluster.TLSKey != "" || cluster.TLSCA != "" {
+		if cluster.TLSCert == "" || cluster.TLSKey == "" || cluster.TLSCA == "" {
+			return errors.New("NATS cluster TLS requires a cert, key and CA")
+		}
+		tc, err := server.GenTLSConfig(&server.TLSConfigOpts{
+			CertFile: cluster.TLSCert,
+			KeyFile:  cluster.TLSKey,
+			CaFile:   cluster.TLSCA,
+			Verify:   true,
+		})
+		if err != nil {
+			return fmt.Errorf("NATS cluster TLS: %w", err)
+		}
+		opts.Cluster.TLSConfig = tc
+		opts.Cluster.TLSTimeout = 2
+	}
+	if len(cluster.Routes) > 0 {
+		opts.Routes = server.RoutesFromStr(strings.Join(cluster.Routes, ","))
+		// Routes dial out with the credentials in their URL.
+		for _, r := range opts.Routes {
+			if r.User == nil && cluster.User != "" {
+				r.User = url.UserPassword(cluster.User, cluster.Password)
+			}
+		}
+	}
+	return nil
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Connect opens an in-process connection. The server never requires TLS of
+// in-process clients, so the connection goes without, whatever the
+// listener's TLS settings; the URL's scheme must not ask for it either.
 func (s *Server) Connect() (*nats.Conn, error) {
-	return nats.Connect(s.ns.ClientURL(), nats.InProcessServer(s.ns))
+	opts := []nats.Option{nats.InProcessServer(s.ns)}
+	if s.internalPass != "" {
+		opts = append(opts, nats.UserInfo(internalUser, s.internalPass))
+	}
+	u, err := url.Parse(s.ns.ClientURL())
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "nats"
+	return nats.Connect(u.String(), opts...)
 }
 
 func (s *Server) Shutdown() {
@@ -0,0 +1,102 @@
+package jetstream
+
+import (
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// Status reports how full the SIDEKICK stream is and how far the processor
+// consumer is behind.
+type Status struct {
+	Stream   StreamStatus   `json:"stream"`
+	Consumer ConsumerStatus `json:"consumer"`
+}
+
+type StreamStatus struct {
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+	// Requests is the number of requests with chunks still stored.
+	Requests  int       `json:"requests"`
+	FirstSeq  uint64    `json:"first_seq"`
+	LastSeq   uint64    `json:"last_seq"`
+	OldestAt  time.Time `json:"oldest_at,omitzero"`
+	BytesUsed float64   `json:"bytes_used_pct,omitempty"`
+	MsgsUsed  float64   `json:"msgs_used_pct,omitempty"`
+	Consumers int       `json:"consumers"`
+	Replicas  int       `json:"replicas"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Leader    string    `json:"leader,omitempty"`
+
+	Subjects   []string `json:"subjects"`
+	MaxAge     string   `json:"max_age"`
+	MaxBytes   int64    `json:"max_bytes"`
+	MaxMsgs    int64    `json:"max_msgs"`
+	MaxMsgSize int32    `json:"max_msg_size"`
+	Discard    string   `json:"discard"`
+	Duplicates string   `json:"duplicates_window"`
+}
+
+type ConsumerStatus struct {
+	// Pending is the number of finished streams not yet delivered to any
+	// replica; AckPending those delivered but not yet written.
+	Pending     uint64 `json:"pending"`
+	AckPending  int    `json:"ack_pending"`
+	Redelivered int    `json:"redelivered"`
+	Waiting     int    `json:"waiting"`
+	Delivered   uint64 `json:"delivered_seq"`
+	AckFloor    uint64 `json:"ack_floor_seq"`
+}
+
+func GetStatus(js nats.JetStreamContext) (*Status, error) {
+	info, err := js.StreamInfo(StreamName, &nats.StreamInfoRequest{SubjectsFilter: SubjectPrefix + "*"})
+	if err != nil {
+		return nil, err
+	}
+	ci, err := js.ConsumerInfo(StreamName, ConsumerName)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, state := info.Config, info.State
+	st := &Status{
+		Stream: StreamStatus{
+			Messages:   state.Msgs,
+			Bytes:      state.Bytes,
+			Requests:   len(state.Subjects),
+			FirstSeq:   state.FirstSeq,
+			LastSeq:    state.LastSeq,
+			MaxBytes:   cfg.MaxBytes,
+			MaxMsgs:    cfg.MaxMsgs,
+			MaxAge:     cfg.MaxAge.String(),
+			Discard:    cfg.Discard.String(),
+			Replicas:   cfg.Replicas,
+			Consumers:  state.Consumers,
+			Subjects:   cfg.Subjects,
+			MaxMsgSize: cfg.MaxMsgSize,
+			Duplicates: cfg.Duplicates.String(),
+		},
+		Consumer: ConsumerStatus{
+			Pending:     ci.NumPending,
+			AckPending:  ci.NumAckPending,
+			Redelivered: ci.NumRedelivered,
+			Waiting:     ci.NumWaiting,
+			Delivered:   ci.Delivered.Stream,
+			AckFloor:    ci.AckFloor.Stream,
+		},
+	}
+	if state.Msgs > 0 {
+		st.Stream.OldestAt = state.FirstTime
+	}
+	if cfg.MaxBytes > 0 {
+		st.Stream.BytesUsed = 100 * float64(state.Bytes) / float64(cfg.MaxBytes)
+	}
+	if cfg.MaxMsgs > 0 {
+		st.Stream.MsgsUsed = 100 * float64(state.Msgs) / float64(cfg.MaxMsgs)
+	}
+	if info.Cluster != nil {
+		st.Stream.Cluster = info.Cluster.Name
+		st.Stream.Leader = info.Cluster.Leader
+	}
+	return st, nil
+}
@@ -1,10 +1,16 @@
 package jetstream
 
 import (
-	"strings"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
 	"time"
 
 	nats "github.com/nats-io/nats.go"
+	natsjs "github.com/nats-io/nats.go/jetstream"
 )
 
 const (
@@ -12,20 +18,102 @@ const (
 	SubjectPrefix = "sidekick.req."
 )
 
-func EnsureStream(js nats.JetStreamContext) error {
-	_, err := js.AddStream(&nats.StreamConfig{
-		Name:      StreamName,
-		Subjects:  []string{"sidekick.>"},
-		Storage:   nats.FileStorage,
-		MaxAge:    24 * time.Hour,
-		Retention: nats.WorkQueuePolicy,
-	})
-	if err != nil && !strings.Contains(err.Error(), "already exists") {
+// StreamOptions configures the SIDEKICK stream. Zero limits keep the
+// defaults below; -1 means unlimited.
+type StreamOptions struct {
+	// Replicas is how many copies a JetStream cluster keeps of the stream.
+	Replicas int
+
+	MaxAge     time.Duration
+	MaxBytes   int64
+	MaxMsgs    int64
+	MaxMsgSize int32
+	// Discard decides what happens at a limit: DiscardNew rejects new
+	// chunks, DiscardOld drops the oldest unprocessed ones.
+	Discard    nats.DiscardPolicy
+	Duplicates time.Duration
+}
+
+func streamConfig(opts StreamOptions) *nats.StreamConfig {
+	return &nats.StreamConfig{
+		Name:       StreamName,
+		Subjects:   []string{SubjectPrefix + ">"},
+		Storage:    nats.FileStorage,
+		Retention:  nats.WorkQueuePolicy,
+		Replicas:   max(opts.Replicas, 1),
+		MaxAge:     cmp.Or(opts.MaxAge, 24*time.Hour),
+		MaxBytes:   cmp.Or(opts.MaxBytes, -1),
+		MaxMsgs:    cmp.Or(opts.MaxMsgs, -1),
+		MaxMsgSize: cmp.Or(opts.MaxMsgSize, -1),
+		Discard:    opts.Discard,
+		Duplicates: cmp.Or(opts.Duplicates, 2*time.Minute),
+	}
+}
+
+// ParseDiscard maps "old" or "new" to a discard policy.
+func ParseDiscard(s string) (nats.DiscardPolicy, error) {
+	switch s {
+	case "old":
+		return nats.DiscardOld, nil
+	case "new":
+		return nats.DiscardNew, nil
+	}
+	return 0, fmt.Errorf("invalid discard policy %q (want old or new)", s)
+}
+
+// EnsureStream creates the SIDEKICK stream or brings an existing one in line
+// with opts. Settings JetStream cannot change in place (retention, storage)
+// are reported as errors rather than silently left as they are.
+func EnsureStream(js nats.JetStreamContext, opts StreamOptions) error {
+	want := streamConfig(opts)
+	info, err := js.StreamInfo(StreamName)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(want)
 		return err
 	}
+	if err != nil {
+		return err
+	}
+
+	have := info.Config
+	if have.Retention != want.Retention {
+		return fmt.Errorf("stream %s has %s retention, want %s", StreamName, have.Retention, want.Retention)
+	}
+	if have.Storage != want.Storage {
+		return fmt.Errorf("stream %s uses %s storage, want %s", StreamName, have.Storage, want.Storage)
+	}
+
+	updated := have
+	updated.Subjects = want.Subjects
+	updated.Replicas = want.Replicas
+	updated.MaxAge = want.MaxAge
+	updated.MaxBytes = want.MaxBytes
+	updated.MaxMsgs = want.MaxMsgs
+	updated.MaxMsgSize = want.MaxMsgSize
+	updated.Discard = want.Discard
+	updated.Duplicates = want.Duplicates
+	if reflect.DeepEqual(updated, have) {
+		return nil
+	}
+	_, err = js.UpdateStream(&updated)
+	if err != nil {
+		return fmt.Errorf("update stream %s: %w", StreamName, err)
+	}
 	return nil
 }
 
+// TSHeader carries the request timestamp (Unix nanoseconds) on every chunk,
+// so a stream that never completes can still be matched to its request row.
+const TSHeader = "Sidekick-Ts"
+
+// ChunkMsg builds a stream chunk message for a request.
+func ChunkMsg(requestID string, ts time.Time, data []byte) *nats.Msg {
+	msg := nats.NewMsg(ChunkSubject(requestID))
+	msg.Header.Set(TSHeader, strconv.FormatInt(ts.UnixNano(), 10))
+	msg.Data = data
+	return msg
+}
+
 func ChunkSubject(requestID string) string {
 	return SubjectPrefix + requestID
 }
@@ -33,3 +121,114 @@ func ChunkSubject(requestID string) string {
 func DoneSubject(requestID string) string {
 	return SubjectPrefix + requestID + ".done"
 }
+
+// AbandonedHeader marks an end-of-stream message published on behalf of a
+// stream whose proxy never finished it.
+const AbandonedHeader = "Sidekick-Abandoned"
+
+// AbandonedMsg builds the end-of-stream message for an abandoned stream. The
+// message ID lets JetStream drop the duplicates other replicas publish for
+// the same stream.
+func AbandonedMsg(requestID string) *nats.Msg {
+	msg := nats.NewMsg(DoneSubject(requestID))
+	msg.Header.Set(AbandonedHeader, "true")
+	msg.Header.Set(nats.MsgIdHdr, "abandoned."+requestID)
+	msg.Data = []byte("{}")
+	return msg
+}
+
+// ChunkReader reads a request's stored chunks by subject. Reads go through
+// a consumer on the stream leader, so every chunk the proxy got an ack for
+// is seen, even right after a leader change.
+type ChunkReader struct {
+	stream natsjs.Stream
+}
+
+func NewChunkReader(ctx context.Context, nc *nats.Conn) (*ChunkReader, error) {
+	js, err := natsjs.New(nc)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := js.Stream(ctx, StreamName)
+	if err != nil {
+		return nil, err
+	}
+	return &ChunkReader{stream: stream}, nil
+}
+
+// chunkBatch is the number of chunks fetched per round-trip.
+const chunkBatch = 256
+
+// Read returns the chunks of requestID in stream order. An ephemeral
+// consumer filtered on the request's subject starts at its first chunk and
+// delivers them in batches. The work-queue stream requires explicit acks,
+// but chunks are never acked: that would delete them before the request is
+// written. They are purged once it is.
+func (r *ChunkReader) Read(ctx context.Context, requestID string) ([]*natsjs.RawStreamMsg, error) {
+	cons, err := r.stream.CreateConsumer(ctx, natsjs.ConsumerConfig{
+		FilterSubject:     ChunkSubject(requestID),
+		DeliverPolicy:     natsjs.DeliverAllPolicy,
+		AckPolicy:         natsjs.AckExplicitPolicy,
+		MaxAckPending:     -1,
+		MemoryStorage:     true,
+		InactiveThreshold: time.Minute,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create chunk consumer: %w", err)
+	}
+	info := cons.CachedInfo()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		r.stream.DeleteConsumer(ctx, info.Name)
+	}()
+
+	pending := int(info.NumPending)
+	chunks := make([]*natsjs.RawStreamMsg, 0, pending)
+	for len(chunks) < pending {
+		batch, err := fetchChunks(ctx, cons, min(chunkBatch, pending-len(chunks)))
+		if err != nil {
+			return nil, fmt.Errorf("fetch chunks: %w", err)
+		}
+		if len(batch) == 0 {
+			// Purged while reading.
+			break
+		}
+		chunks = append(chunks, batch...)
+	}
+	return chunks, nil
+}
+
+// fetchChunks fetches up to n chunks. In a cluster the consumer may live on
+// another server whose interest in pull requests has not reached this one
+// yet; those fetches find no responders and are retried.
+func fetchChunks(ctx context.Context, cons natsjs.Consumer, n int) ([]*natsjs.RawStreamMsg, error) {
+	for attempt := 1; ; attempt++ {
+		batch, err := cons.Fetch(n, natsjs.FetchMaxWait(5*time.Second))
+		var chunks []*natsjs.RawStreamMsg
+		if err == nil {
+			for msg := range batch.Messages() {
+				md, err := msg.Metadata()
+				if err != nil {
+					continue
+				}
+				chunks = append(chunks, &natsjs.RawStreamMsg{
+					Subject:  msg.Subject(),
+					Sequence: md.Sequence.Stream,
+					Header:   msg.Headers(),
+					Data:     msg.Data(),
+					Time:     md.Timestamp,
+				})
+			}
+			err = batch.Error()
+		}
+		if !errors.Is(err, nats.ErrNoResponders) || len(chunks) > 0 || attempt == 5 {
+			return chunks, err
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * 50 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
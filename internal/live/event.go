@@ -0,0 +1,95 @@
+// Package live fans out a compact, real-time view of proxied traffic.
+//
+// The proxy publishes request.start and (for non-streamed requests)
+// request.end events on core NATS subjects under sidekick.live. The Hub ends
+// streamed requests from the processor's request.completed and
+// request.failed events, which carry their usage and cost, and follows the
+// stream chunks flowing through JetStream for content deltas while a client
+// asks for them.
+// Live subjects are not stored in the SIDEKICK stream; subscribers only see
+// traffic while they are connected.
+package live
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	SubjectPrefix = "sidekick.live."
+	startSubject  = SubjectPrefix + "start"
+	endSubject    = SubjectPrefix + "end"
+)
+
+// Event types.
+const (
+	RequestStart = "request.start"
+	ContentDelta = "content.delta"
+	RequestEnd   = "request.end"
+)
+
+type Event struct {
+	Type      string    `json:"type"`
+	RequestID string    `json:"request_id"`
+	TS        time.Time `json:"ts"`
+
+	// Attribution, set on every event of a request.
+	Model        string `json:"model,omitempty"`
+	Key          string `json:"key,omitempty"` // API key fingerprint, never the key
+	Agent        string `json:"agent,omitempty"`
+	Conversation string `json:"conversation,omitempty"`
+	Stream       bool   `json:"stream,omitempty"`
+	Path         string `json:"path,omitempty"`
+
+	// content.delta
+	DeltaType string `json:"delta_type,omitempty"` // text | thinking | tool_input
+	Delta     string `json:"delta,omitempty"`
+
+	// request.end
+	StatusCode int            `json:"status_code,omitempty"`
+	DurationMs int64          `json:"duration_ms,omitempty"`
+	StopReason string         `json:"stop_reason,omitempty"`
+	Usage      *pricing.Usage `json:"usage,omitempty"`
+	CostUSD    float64        `json:"cost_usd,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Publisher sends the proxy's side of the live feed. Publishing is
+// fire-and-forget: the live feed must never slow down or fail a request.
+type Publisher struct {
+	nc *nats.Conn
+}
+
+func NewPublisher(nc *nats.Conn) *Publisher {
+	return &Publisher{nc: nc}
+}
+
+func (p *Publisher) Start(ev Event) {
+	ev.Type = RequestStart
+	p.publish(startSubject, ev)
+}
+
+// End reports a finished request. Streamed requests are finished by the Hub
+// once the processor has recorded them instead.
+func (p *Publisher) End(ev Event) {
+	ev.Type = RequestEnd
+	ev.TS = time.Now()
+	p.publish(endSubject, ev)
+}
+
+func (p *Publisher) publish(subject string, ev Event) {
+	if p == nil {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	if err := p.nc.Publish(subject, data); err != nil {
+		log.Debug().Err(err).Str("subject", subject).Msg("live publish failed")
+	}
+}
@@ -0,0 +1,343 @@
+package live
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/events"
+	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+	"github.com/namikmesic/claude-sidekick/internal/stream"
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const clientBuffer = 256
+
+// Filter selects the events a client receives. Empty fields match anything.
+type Filter struct {
+	Key          string
+	Model        string
+	Agent        string
+	Conversation string
+	Deltas       bool // include content.delta events
+}
+
+func (f Filter) match(ev *Event) bool {
+	if ev.Type == ContentDelta && !f.Deltas {
+		return false
+	}
+	return (f.Key == "" || f.Key == ev.Key) &&
+		(f.Model == "" || f.Model == ev.Model) &&
+		(f.Agent == "" || f.Agent == ev.Agent) &&
+		(f.Conversation == "" || f.Conversation == ev.Conversation)
+}
+
+type client struct {
+	filter Filter
+	ch     chan Event
+}
+
+// streamState follows one streamed response until the processor has
+// recorded it.
+type streamState struct {
+	start  Event
+	status int       // from the end-of-stream marker
+	ended  time.Time // when the end-of-stream marker arrived
+
+	mu     sync.Mutex
+	parser *stream.Parser // nil until chunks are followed for deltas
+}
+
+// Hub subscribes to the live subjects and to the processor's completion
+// events and fans events out to connected clients. Stream chunks are only
+// followed, for content deltas, while a client asks for them. Slow clients
+// lose events rather than stall the hub.
+type Hub struct {
+	nc   *nats.Conn
+	ttl  time.Duration
+	subs []*nats.Subscription
+	stop chan struct{}
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	streams map[string]*streamState
+	deltas  int                // clients with Filter.Deltas
+	chunks  *nats.Subscription // chunk subjects, while deltas > 0
+}
+
+// NewHub starts a hub. ttl is how long a stream's request.end waits for the
+// processor after the end of the stream.
+//
+// Every stream ends, if only with the abandoned marker a processor
+// publishes STREAM_IDLE_TTL_SEC after its last chunk.
+func NewHub(nc *nats.Conn, ttl time.Duration) (*Hub, error) {
+	h := &Hub{
+		nc:      nc,
+		ttl:     ttl,
+		stop:    make(chan struct{}),
+		clients: make(map[*client]struct{}),
+		streams: make(map[string]*streamState),
+	}
+	for subject, handler := range map[string]nats.MsgHandler{
+		SubjectPrefix + ">":                         h.onLive,
+		jetstream.SubjectPrefix + "*.done":          h.onDone,
+		events.Subject(events.RequestCompletedType): h.onRecorded,
+		events.Subject(events.RequestFailedType):    h.onRecorded,
+	} {
+		sub, err := nc.Subscribe(subject, handler)
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
+		h.subs = append(h.subs, sub)
+	}
+	go h.sweep()
+	return h, nil
+}
+
+func (h *Hub) Close() {
+	for _, sub := range h.subs {
+		sub.Unsubscribe()
+	}
+	h.mu.Lock()
+	if h.chunks != nil {
+		h.chunks.Unsubscribe()
+		h.chunks = nil
+	}
+	h.mu.Unlock()
+	select {
+	case <-h.stop:
+	default:
+		close(h.stop)
+	}
+}
+
+// Subscribe registers a client. The returned func unregisters it and must be
+// called when the client goes away.
+func (h *Hub) Subscribe(f Filter) (<-chan Event, func()) {
+	c := &client{filter: f, ch: make(chan Event, clientBuffer)}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	if f.Deltas {
+		h.deltas++
+		h.followChunks()
+	}
+	h.mu.Unlock()
+	return c.ch, func() {
+		h.mu.Lock()
+		delete(h.clients, c)
+		if f.Deltas {
+			h.deltas--
+			h.followChunks()
+		}
+		h.mu.Unlock()
+	}
+}
+
+// followChunks subscribes to stream chunks while any client wants deltas
+// and unsubscribes once none does. It must be called with h.mu held.
+func (h *Hub) followChunks() {
+	switch {
+	case h.deltas > 0 && h.chunks == nil && h.nc != nil:
+		// Chunk subjects are a single token, end markers two.
+		sub, err := h.nc.Subscribe(jetstream.SubjectPrefix+"*", h.onChunk)
+		if err != nil {
+			log.Warn().Err(err).Msg("live feed cannot follow stream chunks, deltas unavailable")
+			return
+		}
+		h.chunks = sub
+	case h.deltas == 0 && h.chunks != nil:
+		h.chunks.Unsubscribe()
+		h.chunks = nil
+		// Parsers resume mid-stream next time; drop what they buffered.
+		for _, st := range h.streams {
+			st.mu.Lock()
+			st.parser = nil
+			st.mu.Unlock()
+		}
+	}
+}
+
+func (h *Hub) onLive(msg *nats.Msg) {
+	var ev Event
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch ev.Type {
+	case RequestStart:
+		if ev.Stream {
+			h.streams[ev.RequestID] = &streamState{start: ev}
+		}
+	case RequestEnd:
+		delete(h.streams, ev.RequestID)
+	}
+	h.broadcast(ev)
+}
+
+// onDone notes the end of a stream. Its request.end waits for the processor
+// to record the stream and publish its usage.
+func (h *Hub) onDone(msg *nats.Msg) {
+	requestID := strings.TrimSuffix(strings.TrimPrefix(msg.Subject, jetstream.SubjectPrefix), ".done")
+	var meta struct {
+		Status int `json:"status"`
+	}
+	json.Unmarshal(msg.Data, &meta)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if st, ok := h.streams[requestID]; ok {
+		st.status = meta.Status
+		st.ended = time.Now()
+	}
+}
+
+// onRecorded finishes a stream from the processor's request.completed or
+// request.failed event.
+func (h *Hub) onRecorded(msg *nats.Msg) {
+	var env events.Envelope
+	if err := json.Unmarshal(msg.Data, &env); err != nil {
+		return
+	}
+	var rec struct {
+		events.RequestCompleted
+		StatusCode int    `json:"status_code"`
+		ErrorType  string `json:"error_type"`
+		Message    string `json:"message"`
+	}
+	if err := json.Unmarshal(env.Data, &rec); err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st, ok := h.streams[rec.RequestID]
+	if !ok {
+		return
+	}
+	delete(h.streams, rec.RequestID)
+
+	ev := st.start
+	ev.Type = RequestEnd
+	ev.TS = time.Now()
+	ended := st.ended
+	if ended.IsZero() {
+		ended = ev.TS
+	}
+	ev.DurationMs = ended.Sub(st.start.TS).Milliseconds()
+	ev.StatusCode = st.status
+	if rec.Model != "" {
+		ev.Model = rec.Model
+	}
+	if env.Type == events.RequestFailedType {
+		if rec.StatusCode != 0 {
+			ev.StatusCode = rec.StatusCode
+		}
+		ev.Error = rec.Message
+		if ev.Error == "" {
+			ev.Error = rec.ErrorType
+		}
+	} else {
+		ev.StopReason = rec.StopReason
+		usage := rec.Usage
+		ev.Usage = &usage
+		ev.CostUSD = rec.CostUSD
+	}
+	h.broadcast(ev)
+}
+
+// onChunk emits the content deltas of a chunk.
+func (h *Hub) onChunk(msg *nats.Msg) {
+	requestID := strings.TrimPrefix(msg.Subject, jetstream.SubjectPrefix)
+
+	h.mu.Lock()
+	st, ok := h.streams[requestID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	st.mu.Lock()
+	if st.parser == nil {
+		st.parser = stream.NewParser()
+	}
+	var deltas []Event
+	for _, sse := range st.parser.ParseChunk(msg.Data) {
+		if ev, ok := delta(st.start, sse); ok {
+			deltas = append(deltas, ev)
+		}
+	}
+	st.mu.Unlock()
+
+	if len(deltas) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ev := range deltas {
+		h.broadcast(ev)
+	}
+}
+
+// delta turns a content_block_delta into a content.delta event of the
+// stream that started with start.
+func delta(start Event, sse stream.SSEEvent) (Event, bool) {
+	if sse.EventType != "content_block_delta" {
+		return Event{}, false
+	}
+	var m stream.ContentBlockDelta
+	if json.Unmarshal([]byte(sse.RawData), &m) != nil {
+		return Event{}, false
+	}
+	ev := start
+	ev.Type = ContentDelta
+	ev.TS = time.Now()
+	switch m.Delta.Type {
+	case "text_delta":
+		ev.DeltaType, ev.Delta = "text", m.Delta.Text
+	case "thinking_delta":
+		ev.DeltaType, ev.Delta = "thinking", m.Delta.Thinking
+	case "input_json_delta":
+		ev.DeltaType, ev.Delta = "tool_input", m.Delta.PartialJSON
+	default:
+		return Event{}, false
+	}
+	return ev, true
+}
+
+// broadcast must be called with h.mu held.
+func (h *Hub) broadcast(ev Event) {
+	for c := range h.clients {
+		if !c.filter.match(&ev) {
+			continue
+		}
+		select {
+		case c.ch <- ev:
+		default:
+		}
+	}
+}
+
+// sweep drops ended streams whose recording never arrived.
+func (h *Hub) sweep() {
+	ticker := time.NewTicker(min(time.Minute, h.ttl))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.mu.Lock()
+			for id, st := range h.streams {
+				if !st.ended.IsZero() && time.Since(st.ended) > h.ttl {
+					delete(h.streams, id)
+				}
+			}
+			h.mu.Unlock()
+		case <-h.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package live
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/events"
+	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
+	nats "github.com/nats-io/nats.go"
+)
+
+func sse(event, data string) []byte {
+	return []byte("event: " + event + "\ndata: " + data + "\n\n")
+}
+
+func TestHubStream(t *testing.T) {
+	srv, err := jetstream.NewServer(t.TempDir(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown()
+	nc, err := srv.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	h, err := NewHub(nc, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	following := func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.chunks != nil
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+	next := func(events <-chan Event) Event {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+			return Event{}
+		}
+	}
+
+	ends, unsubscribeEnds := h.Subscribe(Filter{})
+	defer unsubscribeEnds()
+	if following() {
+		t.Error("following chunks without a client asking for deltas")
+	}
+
+	NewPublisher(nc).Start(Event{RequestID: "r1", TS: time.Now(), Stream: true, Model: "claude-sonnet-4-5"})
+	if ev := next(ends); ev.Type != RequestStart {
+		t.Fatalf("first event = %+v; want the start", ev)
+	}
+
+	deltas, unsubscribeDeltas := h.Subscribe(Filter{Deltas: true})
+	if !following() {
+		t.Fatal("not following chunks for a client asking for deltas")
+	}
+	subject := jetstream.SubjectPrefix + "r1"
+	nc.Publish(subject, sse("message_start",
+		`{"type":"message_start","message":{"model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":12,"output_tokens":1}}}`))
+	nc.Publish(subject, sse("content_block_delta",
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`))
+	if ev := next(deltas); ev.Type != ContentDelta || ev.Delta != "hi" || ev.Model != "claude-sonnet-4-5" {
+		t.Errorf("delta = %+v", ev)
+	}
+	unsubscribeDeltas()
+	if following() {
+		t.Error("still following chunks after the last delta client left")
+	}
+
+	nc.Publish(jetstream.DoneSubject("r1"), []byte(`{"status":200}`))
+	waitFor("the end marker", func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.streams["r1"] != nil && !h.streams["r1"].ended.IsZero()
+	})
+	data, _ := json.Marshal(events.RequestCompleted{
+		RequestID:  "r1",
+		Model:      "claude-sonnet-4-5-20250929",
+		Stream:     true,
+		StopReason: "end_turn",
+		Usage:      pricing.Usage{InputTokens: 12, OutputTokens: 7},
+		CostUSD:    0.5,
+	})
+	env, _ := json.Marshal(events.Envelope{Type: events.RequestCompletedType, Data: data})
+	nc.PublishMsg(&nats.Msg{Subject: events.Subject(events.RequestCompletedType), Data: env})
+
+	end := next(ends)
+	if end.Type != RequestEnd || end.Usage == nil {
+		t.Fatalf("event = %+v; want the end", end)
+	}
+	if end.Usage.InputTokens != 12 || end.Usage.OutputTokens != 7 || end.StopReason != "end_turn" || end.CostUSD != 0.5 {
+		t.Errorf("end usage = %+v, stop reason %q, cost %v", *end.Usage, end.StopReason, end.CostUSD)
+	}
+	if end.Model != "claude-sonnet-4-5-20250929" || end.StatusCode != 200 {
+		t.Errorf("end model, status = %q, %d", end.Model, end.StatusCode)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.streams) != 0 {
+		t.Errorf("%d streams left after the end", len(h.streams))
+	}
+}
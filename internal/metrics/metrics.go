@@ -0,0 +1,224 @@
+// Package metrics exposes sidekick's Prometheus metrics on the admin
+// listener's /metrics.
+//
+// Counters are per replica: requests are counted by the replica that
+// proxied them, tokens and cost by the replica that processed them, so
+// sums across replicas count everything once.
+//
+// Usage is labelled by Claude Code account and API key fingerprint for the
+// first maxLabels distinct accounts and keys a replica sees; the rest are
+// counted under "other", so clients sending arbitrary keys or metadata
+// cannot grow the series without bound.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sidekick"
+
+var registry = prometheus.NewRegistry()
+
+var factory = promauto.With(registry)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+var (
+	requests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Proxied requests by model, status code and whether they were streamed.",
+	}, []string{"model", "status", "stream"})
+
+	requestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time to the end of proxied responses.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 40, 80, 160, 320, 600},
+	}, []string{"model", "status", "stream"})
+
+	upstreamTTFT = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_ttft_seconds",
+		Help:      "Time to the first byte of upstream responses.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32, 64},
+	}, []string{"model", "stream"})
+
+	tokens = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "Tokens used by model, account, API key fingerprint and token type.",
+	}, []string{"model", "account", "key", "type"})
+
+	cost = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cost_usd_total",
+		Help:      "Estimated spend in USD by model, account and API key fingerprint.",
+	}, []string{"model", "account", "key"})
+
+	writerDropped = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "writer",
+		Name:      "dropped_jobs_total",
+		Help:      "Write jobs spooled to the dead-letter file because the write queue was full.",
+	})
+
+	writerFlush = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "writer",
+		Name:      "flush_duration_seconds",
+		Help:      "Time to write a batch of jobs, retries included.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 9),
+	})
+
+	publishErrors = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "jetstream",
+		Name:      "publish_errors_total",
+		Help:      "Stream chunks and end-of-stream messages JetStream did not accept.",
+	})
+)
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Request records a finished proxied request.
+func Request(model string, status int, stream bool, seconds float64) {
+	if model == "" {
+		model = "unknown"
+	}
+	labels := []string{model, strconv.Itoa(status), strconv.FormatBool(stream)}
+	requests.WithLabelValues(labels...).Inc()
+	requestDuration.WithLabelValues(labels...).Observe(seconds)
+}
+
+// UpstreamTTFT records the time to the first byte of an upstream response.
+func UpstreamTTFT(model string, stream bool, seconds float64) {
+	if model == "" {
+		model = "unknown"
+	}
+	upstreamTTFT.WithLabelValues(model, strconv.FormatBool(stream)).Observe(seconds)
+}
+
+// maxLabels bounds the account and key label values of the usage metrics.
+const maxLabels = 100
+
+// labelSet hands out up to maxLabels distinct label values.
+type labelSet struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+var (
+	accounts = &labelSet{seen: make(map[string]bool)}
+	keys     = &labelSet{seen: make(map[string]bool)}
+)
+
+// label returns v, or "other" once maxLabels other values are labelled.
+func (s *labelSet) label(v string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.seen[v] {
+		if len(s.seen) >= maxLabels {
+			return "other"
+		}
+		s.seen[v] = true
+	}
+	return v
+}
+
+// Usage records the tokens and cost of a processed response.
+func Usage(model, account, key string, input, output, cacheRead, cacheCreation int, costUSD float64) {
+	account, key = accounts.label(account), keys.label(key)
+	for typ, n := range map[string]int{
+		"input":          input,
+		"output":         output,
+		"cache_read":     cacheRead,
+		"cache_creation": cacheCreation,
+	} {
+		tokens.WithLabelValues(model, account, key, typ).Add(float64(n))
+	}
+	cost.WithLabelValues(model, account, key).Add(costUSD)
+}
+
+// WriterDropped counts a write job spooled because the queue was full.
+func WriterDropped() { writerDropped.Inc() }
+
+// WriterFlush records the duration of a batch write.
+func WriterFlush(seconds float64) { writerFlush.Observe(seconds) }
+
+// PublishError counts a message JetStream did not accept.
+func PublishError() { publishErrors.Inc() }
+
+// Gauge registers a gauge read from fn at every scrape, for values owned
+// elsewhere such as queue depths.
+func Gauge(subsystem, name, help string, fn func() float64) {
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, fn)
+}
+
+// Counter registers a counter read from fn at every scrape.
+func Counter(subsystem, name, help string, fn func() float64) {
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, fn)
+}
+
+// GaugeDesc names and describes one gauge of a group.
+type GaugeDesc struct {
+	Name, Help string
+}
+
+// GaugeGroup registers gauges read together by one call of fn per scrape,
+// for values that cost a round trip such as JetStream consumer info. fn
+// returns a value per gauge, in order; on error none are reported.
+func GaugeGroup(subsystem string, gauges []GaugeDesc, fn func() ([]float64, error)) {
+	g := &gaugeGroup{fn: fn}
+	for _, d := range gauges {
+		g.descs = append(g.descs, prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, d.Name), d.Help, nil, nil))
+	}
+	registry.MustRegister(g)
+}
+
+type gaugeGroup struct {
+	descs []*prometheus.Desc
+	fn    func() ([]float64, error)
+}
+
+func (g *gaugeGroup) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range g.descs {
+		ch <- d
+	}
+}
+
+func (g *gaugeGroup) Collect(ch chan<- prometheus.Metric) {
+	values, err := g.fn()
+	if err != nil {
+		return
+	}
+	for i, d := range g.descs {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, values[i])
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUsageLabelsAreCapped(t *testing.T) {
+	for i := range maxLabels + 10 {
+		Usage("m", fmt.Sprintf("account-%d", i), fmt.Sprintf("key-%d", i), 1, 1, 0, 0, 0.01)
+	}
+	for _, tt := range []struct {
+		name string
+		set  *labelSet
+	}{
+		{"account", accounts},
+		{"key", keys},
+	} {
+		first := tt.name + "-0"
+		if got := tt.set.label(first); got != first {
+			t.Errorf("labelled %s = %q", tt.name, got)
+		}
+		if got := tt.set.label(tt.name + "-new"); got != "other" {
+			t.Errorf("%s beyond the cap = %q; want other", tt.name, got)
+		}
+		if n := len(tt.set.seen); n != maxLabels {
+			t.Errorf("%d %ss labelled; want %d", n, tt.name, maxLabels)
+		}
+	}
+}
+
+func TestGaugeGroupCallsOncePerScrape(t *testing.T) {
+	calls := 0
+	var fail bool
+	GaugeGroup("test", []GaugeDesc{{Name: "a", Help: "a"}, {Name: "b", Help: "b"}}, func() ([]float64, error) {
+		calls++
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return []float64{1, 2}, nil
+	})
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		return rec.Body.String()
+	}
+	out := scrape()
+	if calls != 1 {
+		t.Errorf("fn called %d times; want 1", calls)
+	}
+	for _, line := range []string{"sidekick_test_a 1", "sidekick_test_b 2"} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %q", line)
+		}
+	}
+
+	fail = true
+	if out := scrape(); strings.Contains(out, "sidekick_test_a") {
+		t.Error("gauges reported despite an error")
+	}
+}
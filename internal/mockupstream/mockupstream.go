@@ -0,0 +1,341 @@
+// Package mockupstream is a stand-in for the Anthropic API, for exercising
+// the proxy, processor and storage offline and in tests (sidekick
+// mock-upstream).
+//
+// It serves /v1/messages, streamed and not, /v1/messages/count_tokens and
+// /v1/models. Replies echo the new user text unless a script says
+// otherwise; scripts can also return tool calls and thinking, fail with API
+// errors, including errors in the middle of a stream, and slow down single
+// responses. Usage is estimated from the request and reply sizes, with
+// prompt caching simulated from the requests' cache_control breakpoints.
+// Any credentials are accepted.
+package mockupstream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+)
+
+type Server struct {
+	rules      []Rule
+	latency    time.Duration
+	chunkDelay time.Duration
+	mux        *http.ServeMux
+
+	mu     sync.Mutex
+	used   []int                // times each rule has applied
+	cached map[string]time.Time // prompt cache: prefix hash → expiry
+}
+
+// NewServer returns a mock API answering after latency, with chunkDelay
+// between the deltas of streamed responses.
+func NewServer(rules []Rule, latency, chunkDelay time.Duration) *Server {
+	s := &Server{
+		rules:      rules,
+		latency:    latency,
+		chunkDelay: chunkDelay,
+		mux:        http.NewServeMux(),
+		used:       make([]int, len(rules)),
+		cached:     make(map[string]time.Time),
+	}
+	s.mux.HandleFunc("POST /v1/messages", s.messages)
+	s.mux.HandleFunc("POST /v1/messages/count_tokens", s.countTokens)
+	s.mux.HandleFunc("GET /v1/models", s.listModels)
+	s.mux.HandleFunc("GET /v1/models/{id}", s.getModel)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found_error", "Not found")
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Request-Id", newID("req_mock_"))
+	s.mux.ServeHTTP(w, r)
+}
+
+type apiUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+}
+
+type message struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Role         string           `json:"role"`
+	Model        string           `json:"model"`
+	Content      []map[string]any `json:"content"`
+	StopReason   *string          `json:"stop_reason"`
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        apiUsage         `json:"usage"`
+}
+
+// reply is the content of a response.
+type reply struct {
+	thinking   string
+	text       string
+	tools      []ToolUse
+	stopReason string
+}
+
+func (s *Server) messages(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	parsed, msg := validate(body)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
+	if parsed.MaxTokens <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "max_tokens: Field required")
+		return
+	}
+
+	s.mu.Lock()
+	rule := s.match(parsed)
+	in := s.usage(body)
+	s.mu.Unlock()
+
+	latency := s.latency
+	if rule != nil && rule.LatencyMs != nil {
+		latency = time.Duration(*rule.LatencyMs) * time.Millisecond
+	}
+	if !sleep(r.Context(), latency) {
+		return
+	}
+	var midStream *Error
+	if rule != nil && rule.Error != nil {
+		if !rule.Error.MidStream || !parsed.Stream {
+			writeAPIError(w, rule.Error)
+			return
+		}
+		midStream = rule.Error
+	}
+
+	rep := newReply(rule, parsed)
+	usage := apiUsage{
+		InputTokens:              in.input,
+		CacheCreationInputTokens: in.cacheCreation,
+		CacheReadInputTokens:     in.cacheRead,
+		OutputTokens:             rep.outputTokens(),
+	}
+	content := rep.content()
+	if parsed.Stream {
+		s.stream(w, r, parsed.Model, content, rep.stopReason, usage, midStream)
+		return
+	}
+	writeJSON(w, http.StatusOK, message{
+		ID:         newID("msg_mock_"),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      parsed.Model,
+		Content:    content,
+		StopReason: &rep.stopReason,
+		Usage:      usage,
+	})
+}
+
+// validate checks the fields the API requires of every request and
+// returns its error message for invalid requests.
+func validate(body []byte) (processor.ParsedRequest, string) {
+	if !json.Valid(body) {
+		return processor.ParsedRequest{}, "Request body is not valid JSON"
+	}
+	parsed := processor.ParseRequest(body)
+	switch {
+	case parsed.Model == "":
+		return parsed, "model: Field required"
+	case parsed.MessageCount == 0:
+		return parsed, "messages: Field required"
+	}
+	return parsed, ""
+}
+
+// match returns the first rule applying to a request. Callers hold s.mu.
+func (s *Server) match(p processor.ParsedRequest) *Rule {
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if rule.Times > 0 && s.used[i] >= rule.Times {
+			continue
+		}
+		if !strings.Contains(p.UserText, rule.Match) || !strings.HasPrefix(p.Model, rule.Model) {
+			continue
+		}
+		s.used[i]++
+		return rule
+	}
+	return nil
+}
+
+func newReply(rule *Rule, p processor.ParsedRequest) reply {
+	rep := reply{stopReason: "end_turn"}
+	if rule != nil {
+		rep.text = strings.ReplaceAll(rule.Text, "{input}", p.UserText)
+		rep.thinking = rule.Thinking
+		rep.tools = rule.ToolUse
+		if len(rep.tools) > 0 {
+			rep.stopReason = "tool_use"
+		}
+		if rule.StopReason != "" {
+			rep.stopReason = rule.StopReason
+		}
+	} else {
+		rep.text = p.UserText
+		if rep.text == "" {
+			rep.text = "Hello from the sidekick mock upstream."
+		}
+	}
+	// Thinking blocks only come back when the request enables thinking.
+	if p.ThinkingBudgetTokens == 0 {
+		rep.thinking = ""
+	} else if rep.thinking == "" {
+		rep.thinking = fmt.Sprintf("The request has %d messages. I will answer the last one.", p.MessageCount)
+	}
+
+	if rep.outputTokens() > p.MaxTokens {
+		limit := max(p.MaxTokens*4-len(rep.thinking), 0)
+		if len(rep.text) > limit {
+			rep.text = strings.ToValidUTF8(rep.text[:limit], "")
+		}
+		rep.tools = nil
+		rep.stopReason = "max_tokens"
+	}
+	return rep
+}
+
+func (rep reply) outputTokens() int {
+	n := tokens(rep.thinking) + tokens(rep.text)
+	for _, t := range rep.tools {
+		n += tokens(t.Name) + tokens(string(t.Input))
+	}
+	return max(n, 1)
+}
+
+// content returns the reply's content blocks as the API sends them.
+func (rep reply) content() []map[string]any {
+	var blocks []map[string]any
+	if rep.thinking != "" {
+		blocks = append(blocks, map[string]any{"type": "thinking", "thinking": rep.thinking, "signature": signature})
+	}
+	if rep.text != "" || len(rep.tools) == 0 {
+		blocks = append(blocks, map[string]any{"type": "text", "text": rep.text})
+	}
+	for _, t := range rep.tools {
+		blocks = append(blocks, map[string]any{"type": "tool_use", "id": newID("toolu_mock_"), "name": t.Name, "input": t.Input})
+	}
+	return blocks
+}
+
+// signature stands in for the signature of thinking blocks.
+const signature = "bW9jay10aGlua2luZy1zaWduYXR1cmU="
+
+func (s *Server) countTokens(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	if _, msg := validate(body); msg != "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", msg)
+		return
+	}
+	var n int
+	for _, seg := range segments(body) {
+		n += tokens(string(seg))
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"input_tokens": max(n, 1)})
+}
+
+type model struct {
+	Type        string    `json:"type"`
+	ID          string    `json:"id"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+var models = []model{
+	{"model", "claude-opus-4-5-20251101", "Claude Opus 4.5", time.Date(2025, 11, 24, 0, 0, 0, 0, time.UTC)},
+	{"model", "claude-haiku-4-5-20251001", "Claude Haiku 4.5", time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC)},
+	{"model", "claude-sonnet-4-5-20250929", "Claude Sonnet 4.5", time.Date(2025, 9, 29, 0, 0, 0, 0, time.UTC)},
+	{"model", "claude-opus-4-1-20250805", "Claude Opus 4.1", time.Date(2025, 8, 5, 0, 0, 0, 0, time.UTC)},
+	{"model", "claude-sonnet-4-20250514", "Claude Sonnet 4", time.Date(2025, 5, 22, 0, 0, 0, 0, time.UTC)},
+	{"model", "claude-3-5-haiku-20241022", "Claude Haiku 3.5", time.Date(2024, 10, 22, 0, 0, 0, 0, time.UTC)},
+}
+
+func (s *Server) listModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":     models,
+		"has_more": false,
+		"first_id": models[0].ID,
+		"last_id":  models[len(models)-1].ID,
+	})
+}
+
+func (s *Server) getModel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	for _, m := range models {
+		if m.ID == id {
+			writeJSON(w, http.StatusOK, m)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "not_found_error", "model: "+id)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, e *Error) {
+	if e.RetryAfterSec > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(e.RetryAfterSec))
+	}
+	writeError(w, e.Status, e.Type, e.Message)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, errorBody(errType, message))
+}
+
+func errorBody(errType, message string) map[string]any {
+	return map[string]any{
+		"type":  "error",
+		"error": map[string]string{"type": errType, "message": message},
+	}
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// sleep waits for d, reporting false when the request went away first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
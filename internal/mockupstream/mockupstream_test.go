@@ -0,0 +1,195 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/stream"
+)
+
+func newTestServer(t *testing.T, rules []Rule) string {
+	t.Helper()
+	srv := httptest.NewServer(NewServer(rules, 0, 0))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func request(model, text string, streamed bool) string {
+	body, _ := json.Marshal(map[string]any{
+		"model":      model,
+		"max_tokens": 1024,
+		"stream":     streamed,
+		"messages":   []map[string]string{{"role": "user", "content": text}},
+	})
+	return string(body)
+}
+
+func post(t *testing.T, url, body string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Post(url+"/v1/messages", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, raw
+}
+
+func TestRules(t *testing.T) {
+	url := newTestServer(t, []Rule{
+		{Match: "retry", Times: 1, Error: &Error{Status: 429, Type: "rate_limit_error", Message: "slow down"}},
+		{Match: "weather", Model: "claude-haiku", ToolUse: []ToolUse{{Name: "get_weather", Input: json.RawMessage(`{"city":"Oslo"}`)}}},
+		{Match: "", Text: "you said: {input}"},
+	})
+	tests := []struct {
+		name       string
+		model      string
+		text       string
+		wantStatus int
+		wantStop   string
+		wantBlock  string // type of the last content block
+		wantText   string
+	}{
+		{"first match wins", "claude-sonnet-4-5", "retry please", 429, "", "", ""},
+		{"times used up", "claude-sonnet-4-5", "retry please", 200, "end_turn", "text", "you said: retry please"},
+		{"model prefix", "claude-haiku-4-5", "weather?", 200, "tool_use", "tool_use", ""},
+		{"model prefix mismatch", "claude-sonnet-4-5", "weather?", 200, "end_turn", "text", "you said: weather?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := post(t, url, request(tt.model, tt.text, false))
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d; want %d: %s", status, tt.wantStatus, body)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			var msg processor.AnthropicResponse
+			if err := json.Unmarshal(body, &msg); err != nil {
+				t.Fatal(err)
+			}
+			last := msg.Content[len(msg.Content)-1]
+			if msg.StopReason != tt.wantStop || last.Type != tt.wantBlock || last.Text != tt.wantText {
+				t.Errorf("stop %q, last block %s %q", msg.StopReason, last.Type, last.Text)
+			}
+		})
+	}
+}
+
+func TestEchoWithoutRules(t *testing.T) {
+	_, body := post(t, newTestServer(t, nil), request("claude-sonnet-4-5", "ping", false))
+	var msg processor.AnthropicResponse
+	json.Unmarshal(body, &msg)
+	if len(msg.Content) != 1 || msg.Content[0].Text != "ping" || msg.Usage.InputTokens == 0 {
+		t.Errorf("response = %s", body)
+	}
+}
+
+func TestMidStreamError(t *testing.T) {
+	url := newTestServer(t, []Rule{{
+		Text:  "one two three four five six seven eight",
+		Error: &Error{Status: 529, Type: "overloaded_error", Message: "Overloaded", MidStream: true},
+	}})
+
+	status, body := post(t, url, request("claude-sonnet-4-5", "hi", true))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d; want 200 with the error in the stream", status)
+	}
+	var types []string
+	for _, ev := range stream.NewParser().ParseChunk(body) {
+		types = append(types, ev.EventType)
+	}
+	want := "message_start ping content_block_start content_block_delta error"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("events = %s; want %s", got, want)
+	}
+
+	// Unstreamed requests get the error as the response.
+	if status, _ := post(t, url, request("claude-sonnet-4-5", "hi", false)); status != 529 {
+		t.Errorf("unstreamed status = %d; want 529", status)
+	}
+}
+
+func TestPromptCaching(t *testing.T) {
+	url := newTestServer(t, nil)
+	cached := func(system string) string {
+		body, _ := json.Marshal(map[string]any{
+			"model":      "claude-sonnet-4-5",
+			"max_tokens": 1024,
+			"system":     []map[string]any{{"type": "text", "text": system, "cache_control": map[string]string{"type": "ephemeral"}}},
+			"messages":   []map[string]string{{"role": "user", "content": "hi"}},
+		})
+		return string(body)
+	}
+	usage := func(body string) processor.UsageInfo {
+		t.Helper()
+		_, raw := post(t, url, body)
+		var msg processor.AnthropicResponse
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg.Usage
+	}
+
+	long := strings.Repeat("x", 4*minCacheTokens)
+	first, second := usage(cached(long)), usage(cached(long))
+	if first.CacheCreationInputTokens < minCacheTokens || first.CacheReadInputTokens != 0 {
+		t.Errorf("first usage = %+v; want the prefix written", first)
+	}
+	if second.CacheReadInputTokens != first.CacheCreationInputTokens || second.CacheCreationInputTokens != 0 {
+		t.Errorf("second usage = %+v; want the prefix read", second)
+	}
+	if second.InputTokens != first.InputTokens || second.InputTokens >= minCacheTokens {
+		t.Errorf("uncached input = %d, %d; want only what follows the breakpoint", first.InputTokens, second.InputTokens)
+	}
+
+	short := usage(cached("short"))
+	if short.CacheCreationInputTokens != 0 || short.CacheReadInputTokens != 0 {
+		t.Errorf("short prefix usage = %+v; want no caching", short)
+	}
+}
+
+func TestLoadScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"defaults", `[{"error":{"status":529}},{"tool_use":[{"name":"ls"}]}]`, ""},
+		{"bad status", `[{"error":{"status":200}}]`, "4xx or 5xx"},
+		{"nameless tool", `[{"tool_use":[{"input":{}}]}]`, "no name"},
+		{"not JSON", `[{`, "parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "script.json")
+			os.WriteFile(path, []byte(tt.script), 0o644)
+			rules, err := LoadScript(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e := rules[0].Error; e.Type != "overloaded_error" || e.Message != "overloaded error" {
+				t.Errorf("error defaults = %+v", e)
+			}
+			if in := string(rules[1].ToolUse[0].Input); in != "{}" {
+				t.Errorf("tool input default = %s", in)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Rule scripts the response to the requests it matches. Rules are tried in
+// order and the first match wins; without a match the request is echoed.
+type Rule struct {
+	// Match is a substring of the new user text of the request (see
+	// processor.ParsedRequest.UserText); empty matches any request.
+	Match string `json:"match"`
+	// Model, when set, restricts the rule to models with this prefix.
+	Model string `json:"model"`
+	// Times limits how often the rule applies, so that a sequence of rules
+	// can script e.g. one 429 followed by a success. 0 is unlimited.
+	Times int `json:"times"`
+
+	// Text of the reply; "{input}" is replaced by the user text.
+	Text       string    `json:"text"`
+	Thinking   string    `json:"thinking"`
+	ToolUse    []ToolUse `json:"tool_use"`
+	StopReason string    `json:"stop_reason"`
+	Error      *Error    `json:"error"`
+	// LatencyMs overrides the time to the response headers.
+	LatencyMs *int `json:"latency_ms"`
+}
+
+type ToolUse struct {
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// Error makes the response an API error. MidStream errors of streamed
+// requests are sent as an error event after part of the reply, with status
+// 200, as the API does when it fails mid-response.
+type Error struct {
+	Status        int    `json:"status"`
+	Type          string `json:"type"`
+	Message       string `json:"message"`
+	MidStream     bool   `json:"mid_stream"`
+	RetryAfterSec int    `json:"retry_after"`
+}
+
+// errorTypes are the API's error types by status.
+var errorTypes = map[int]string{
+	http.StatusBadRequest:            "invalid_request_error",
+	http.StatusUnauthorized:          "authentication_error",
+	http.StatusForbidden:             "permission_error",
+	http.StatusNotFound:              "not_found_error",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusTooManyRequests:       "rate_limit_error",
+	http.StatusInternalServerError:   "api_error",
+	529:                              "overloaded_error",
+}
+
+// LoadScript reads and validates a script: a JSON array of rules.
+func LoadScript(path string) ([]Rule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i := range rules {
+		r := &rules[i]
+		if e := r.Error; e != nil {
+			if e.Status < 400 || e.Status > 599 {
+				return nil, fmt.Errorf("rule %d: error status must be 4xx or 5xx", i+1)
+			}
+			if e.Type == "" {
+				e.Type = errorTypes[e.Status]
+				if e.Type == "" {
+					e.Type = "api_error"
+				}
+			}
+			if e.Message == "" {
+				e.Message = strings.ReplaceAll(e.Type, "_", " ")
+			}
+		}
+		for j := range r.ToolUse {
+			t := &r.ToolUse[j]
+			if t.Name == "" {
+				return nil, fmt.Errorf("rule %d: tool_use %d has no name", i+1, j+1)
+			}
+			if len(t.Input) == 0 {
+				t.Input = json.RawMessage("{}")
+			}
+		}
+	}
+	return rules, nil
+}
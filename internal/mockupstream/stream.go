@@ -0,0 +1,108 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sizes of the deltas streamed replies are split into.
+const (
+	wordsPerDelta = 4
+	jsonPerDelta  = 32 // bytes of tool input
+)
+
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, model string, content []map[string]any, stopReason string, usage apiUsage, midStream *Error) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(event string, data any) bool {
+		raw, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, raw)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return r.Context().Err() == nil
+	}
+
+	start := usage
+	start.OutputTokens = 1
+	send("message_start", map[string]any{"type": "message_start", "message": message{
+		ID: newID("msg_mock_"), Type: "message", Role: "assistant", Model: model,
+		Content: []map[string]any{}, Usage: start,
+	}})
+	if !send("ping", map[string]string{"type": "ping"}) {
+		return
+	}
+
+	for i, block := range content {
+		shell, deltas := blockDeltas(block)
+		send("content_block_start", map[string]any{"type": "content_block_start", "index": i, "content_block": shell})
+		for _, d := range deltas {
+			if !sleep(r.Context(), s.chunkDelay) {
+				return
+			}
+			if !send("content_block_delta", map[string]any{"type": "content_block_delta", "index": i, "delta": d}) {
+				return
+			}
+			if midStream != nil {
+				send("error", errorBody(midStream.Type, midStream.Message))
+				return
+			}
+		}
+		send("content_block_stop", map[string]any{"type": "content_block_stop", "index": i})
+	}
+	if midStream != nil {
+		send("error", errorBody(midStream.Type, midStream.Message))
+		return
+	}
+
+	send("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": stopReason, "stop_sequence": nil},
+		"usage": map[string]int{"output_tokens": usage.OutputTokens},
+	})
+	send("message_stop", map[string]string{"type": "message_stop"})
+}
+
+// blockDeltas returns the empty block a content block's stream starts with
+// and the deltas filling it in.
+func blockDeltas(block map[string]any) (map[string]any, []map[string]any) {
+	var deltas []map[string]any
+	switch block["type"] {
+	case "thinking":
+		for _, part := range splitWords(block["thinking"].(string)) {
+			deltas = append(deltas, map[string]any{"type": "thinking_delta", "thinking": part})
+		}
+		deltas = append(deltas, map[string]any{"type": "signature_delta", "signature": signature})
+		return map[string]any{"type": "thinking", "thinking": "", "signature": ""}, deltas
+	case "tool_use":
+		input := string(block["input"].(json.RawMessage))
+		for len(input) > 0 {
+			n := min(jsonPerDelta, len(input))
+			deltas = append(deltas, map[string]any{"type": "input_json_delta", "partial_json": input[:n]})
+			input = input[n:]
+		}
+		return map[string]any{"type": "tool_use", "id": block["id"], "name": block["name"], "input": map[string]any{}}, deltas
+	default:
+		for _, part := range splitWords(block["text"].(string)) {
+			deltas = append(deltas, map[string]any{"type": "text_delta", "text": part})
+		}
+		return map[string]any{"type": "text", "text": ""}, deltas
+	}
+}
+
+func splitWords(s string) []string {
+	words := strings.SplitAfter(s, " ")
+	var parts []string
+	for len(words) > 0 {
+		n := min(wordsPerDelta, len(words))
+		if part := strings.Join(words[:n], ""); part != "" {
+			parts = append(parts, part)
+		}
+		words = words[n:]
+	}
+	return parts
+}
@@ -0,0 +1,99 @@
+package mockupstream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Token counts are estimated at four characters per token.
+func tokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// Prompt caching as the API does it: the prompt up to the last
+// cache_control breakpoint is written to the cache when it is long enough,
+// and read from it by requests repeating it within the cache lifetime.
+const (
+	minCacheTokens = 1024
+	cacheLifetime  = 5 * time.Minute
+)
+
+type inputUsage struct {
+	input, cacheRead, cacheCreation int
+}
+
+// segments splits a request's prompt in prompt order (tools, system,
+// messages) into pieces that may each carry a cache breakpoint.
+func segments(body []byte) []json.RawMessage {
+	var req struct {
+		Tools    []json.RawMessage `json:"tools"`
+		System   json.RawMessage   `json:"system"`
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(body, &req)
+	segs := append([]json.RawMessage(nil), req.Tools...)
+	segs = append(segs, split(req.System)...)
+	for _, m := range req.Messages {
+		segs = append(segs, split(m.Content)...)
+	}
+	return segs
+}
+
+// split returns the blocks of a block array, or the value itself.
+func split(raw json.RawMessage) []json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var blocks []json.RawMessage
+	if json.Unmarshal(raw, &blocks) == nil {
+		return blocks
+	}
+	return []json.RawMessage{raw}
+}
+
+func hasBreakpoint(seg json.RawMessage) bool {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(seg, &obj) != nil {
+		return false
+	}
+	cc, ok := obj["cache_control"]
+	return ok && string(cc) != "null"
+}
+
+// usage estimates the input usage of a request. Callers hold s.mu.
+func (s *Server) usage(body []byte) inputUsage {
+	segs := segments(body)
+	var total, prefix int
+	sum := sha256.New()
+	var key string
+	for _, seg := range segs {
+		total += tokens(string(seg))
+		sum.Write(seg)
+		if hasBreakpoint(seg) {
+			prefix = total
+			key = hex.EncodeToString(sum.Sum(nil))
+		}
+	}
+	u := inputUsage{input: max(total, 1)}
+	if prefix < minCacheTokens {
+		return u
+	}
+	now := time.Now()
+	for k, exp := range s.cached {
+		if now.After(exp) {
+			delete(s.cached, k)
+		}
+	}
+	if _, ok := s.cached[key]; ok {
+		u.cacheRead = prefix
+	} else {
+		u.cacheCreation = prefix
+	}
+	s.cached[key] = now.Add(cacheLifetime)
+	u.input = max(total-prefix, 1)
+	return u
+}
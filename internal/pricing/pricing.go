@@ -0,0 +1,64 @@
+// Package pricing estimates the cost of a request from its token usage.
+package pricing
+
+import "strings"
+
+// Price is a model's list price in USD per million tokens.
+type Price struct {
+	Input      float64
+	Output     float64
+	CacheWrite float64
+	CacheRead  float64
+}
+
+// Usage is the token usage reported by the API for one request.
+type Usage struct {
+	InputTokens         int `json:"input_tokens"`
+	OutputTokens        int `json:"output_tokens"`
+	CacheReadTokens     int `json:"cache_read_tokens"`
+	CacheCreationTokens int `json:"cache_creation_tokens"`
+}
+
+func (u Usage) Total() int {
+	return u.InputTokens + u.OutputTokens + u.CacheReadTokens + u.CacheCreationTokens
+}
+
+// prices is matched by model ID prefix, most specific first, so dated
+// snapshots (claude-sonnet-4-5-20250929) resolve to their family.
+var prices = []struct {
+	prefix string
+	price  Price
+}{
+	{"claude-opus-4-5", Price{5, 25, 6.25, 0.50}},
+	{"claude-opus-4", Price{15, 75, 18.75, 1.50}},
+	{"claude-sonnet-4", Price{3, 15, 3.75, 0.30}},
+	{"claude-haiku-4", Price{1, 5, 1.25, 0.10}},
+	{"claude-3-7-sonnet", Price{3, 15, 3.75, 0.30}},
+	{"claude-3-5-sonnet", Price{3, 15, 3.75, 0.30}},
+	{"claude-3-5-haiku", Price{0.80, 4, 1, 0.08}},
+	{"claude-3-opus", Price{15, 75, 18.75, 1.50}},
+	{"claude-3-haiku", Price{0.25, 1.25, 0.30, 0.03}},
+}
+
+// Lookup returns the price of model.
+func Lookup(model string) (Price, bool) {
+	for _, p := range prices {
+		if strings.HasPrefix(model, p.prefix) {
+			return p.price, true
+		}
+	}
+	return Price{}, false
+}
+
+// Cost returns the estimated USD cost of usage on model, or 0 for models
+// without a known price.
+func Cost(model string, u Usage) float64 {
+	p, ok := Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheCreationTokens)*p.CacheWrite +
+		float64(u.CacheReadTokens)*p.CacheRead) / 1e6
+}
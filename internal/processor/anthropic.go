@@ -3,6 +3,8 @@ package processor
 import (
 	"encoding/json"
 	"strings"
+
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
 )
 
 type AnthropicRequest struct {
@@ -74,7 +76,21 @@ type UsageInfo struct {
 	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
+// Tokens converts the API usage block to pricing.Usage.
+func (u UsageInfo) Tokens() pricing.Usage {
+	return pricing.Usage{
+		InputTokens:         u.InputTokens,
+		OutputTokens:        u.OutputTokens,
+		CacheReadTokens:     u.CacheReadInputTokens,
+		CacheCreationTokens: u.CacheCreationInputTokens,
+	}
+}
+
 type ParsedRequest struct {
+	Model                string
+	Stream               bool
+	ConversationID       string // Claude Code session, from metadata.user_id
+	AccountID            string // Claude Code account, from metadata.user_id
 	SystemPrompt         string
 	MaxTokens            int
 	Temperature          *float64
@@ -82,6 +98,7 @@ type ParsedRequest struct {
 	MessageCount         int
 	ToolCount            int
 	ThinkingBudgetTokens int
+	UserText             string // text of the trailing user turn, for search
 }
 
 // Returns zero-value ParsedRequest on parse failure.
@@ -97,6 +114,10 @@ func ParseRequest(body []byte) ParsedRequest {
 	}
 
 	return ParsedRequest{
+		Model:                req.Model,
+		Stream:               req.Stream,
+		ConversationID:       extractConversationID(req.Metadata),
+		AccountID:            extractAccountID(req.Metadata),
 		SystemPrompt:         extractSystemPrompt(req.System),
 		MaxTokens:            req.MaxTokens,
 		Temperature:          req.Temperature,
@@ -104,7 +125,46 @@ func ParseRequest(body []byte) ParsedRequest {
 		MessageCount:         len(req.Messages),
 		ToolCount:            len(req.Tools),
 		ThinkingBudgetTokens: budget,
+		UserText:             userText(req.Messages),
+	}
+}
+
+// extractConversationID returns the session ID Claude Code embeds in
+// metadata.user_id ("user_<hash>_account_<uuid>_session_<uuid>").
+func extractConversationID(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var meta struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return ""
+	}
+	_, session, ok := strings.Cut(meta.UserID, "_session_")
+	if !ok {
+		return ""
+	}
+	return session
+}
+
+// extractAccountID returns the account ID from the same metadata.user_id.
+func extractAccountID(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var meta struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return ""
+	}
+	_, rest, ok := strings.Cut(meta.UserID, "_account_")
+	if !ok {
+		return ""
 	}
+	account, _, _ := strings.Cut(rest, "_session_")
+	return account
 }
 
 // extractSystemPrompt handles both string and []SystemBlock forms.
@@ -0,0 +1,400 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/cluster"
+	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const fetchBatch = 256
+
+// ConsumerOptions tunes StartConsumer.
+type ConsumerOptions struct {
+	// StreamTTL is how long a stream may go without a new chunk before it is
+	// treated as abandoned: what arrived is processed and the request is
+	// marked incomplete.
+	StreamTTL time.Duration
+	// Sweep is the lease of the replica that gives up on streams whose
+	// proxy died. Nil disables the sweep.
+	Sweep *cluster.Lease
+}
+
+// sweepInterval is how often the sweep lease is renewed and swept under.
+const sweepInterval = cluster.LeaseTTL / 3
+
+// ConsumerStats is a snapshot of the consumer's work on this replica.
+// Open streams are those this replica's proxy is publishing, with the bytes
+// of their chunks.
+type ConsumerStats struct {
+	InFlight        int   `json:"in_flight"`
+	Evicted         int64 `json:"evicted_total"`
+	OpenStreams     int   `json:"open_streams"`
+	OpenStreamBytes int64 `json:"open_stream_bytes"`
+}
+
+type consumerStats struct {
+	inFlight        atomic.Int64
+	evicted         atomic.Int64
+	openStreams     atomic.Int64
+	openStreamBytes atomic.Int64
+}
+
+// Stats reports requests being written and streams given up on by this
+// replica, and the streams still open.
+func (p *Processor) Stats() ConsumerStats {
+	return ConsumerStats{
+		InFlight:        int(p.stats.inFlight.Load()),
+		Evicted:         p.stats.evicted.Load(),
+		OpenStreams:     int(p.stats.openStreams.Load()),
+		OpenStreamBytes: p.stats.openStreamBytes.Load(),
+	}
+}
+
+// consumer rebuilds streamed responses. The shared durable consumer only
+// delivers end-of-stream markers; whichever replica receives one reads the
+// request's chunks from the stream, so no replica keeps per-request state
+// between messages. Chunks are purged and the marker acked only after the
+// request's write jobs have settled, so a crash at any point leaves both in
+// JetStream and the redelivered marker goes to a surviving replica. Writes
+// are idempotent upserts, so reprocessing is safe.
+type consumer struct {
+	p      *Processor
+	js     nats.JetStreamContext
+	chunks *jetstream.ChunkReader
+	opts   ConsumerOptions
+
+	mu sync.Mutex
+	// inFlight holds the markers of requests whose jobs are queued but not
+	// yet settled. Redeliveries for them are dropped; the pending ack covers
+	// them.
+	inFlight map[uuid.UUID]*nats.Msg
+}
+
+type openStream struct {
+	lastChunk time.Time
+	chunks    int
+	bytes     int64
+}
+
+// StreamOpened starts tracking a stream the proxy is about to publish, until
+// StreamClosed. A stream without a chunk for StreamTTL is given up on.
+func (p *Processor) StreamOpened(requestID string) {
+	p.openMu.Lock()
+	defer p.openMu.Unlock()
+	p.open[requestID] = &openStream{lastChunk: time.Now()}
+	p.stats.openStreams.Store(int64(len(p.open)))
+}
+
+// StreamChunk records a published chunk of an open stream.
+func (p *Processor) StreamChunk(requestID string, n int) {
+	p.openMu.Lock()
+	defer p.openMu.Unlock()
+	st, ok := p.open[requestID]
+	if !ok {
+		// Already given up on.
+		return
+	}
+	st.lastChunk = time.Now()
+	st.chunks++
+	st.bytes += int64(n)
+	p.stats.openStreamBytes.Add(int64(n))
+}
+
+// StreamClosed stops tracking a stream once its end-of-stream marker is
+// published.
+func (p *Processor) StreamClosed(requestID string) {
+	p.openMu.Lock()
+	defer p.openMu.Unlock()
+	if st, ok := p.open[requestID]; ok {
+		delete(p.open, requestID)
+		p.stats.openStreamBytes.Add(-st.bytes)
+		p.stats.openStreams.Store(int64(len(p.open)))
+	}
+}
+
+// StartConsumer reads end-of-stream markers through the durable processor
+// consumer until ctx is cancelled. EnsureConsumer must have been called
+// first.
+func (p *Processor) StartConsumer(ctx context.Context, nc *nats.Conn, opts ConsumerOptions) {
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to get JetStream context")
+	}
+	chunks, err := jetstream.NewChunkReader(ctx, nc)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open JetStream stream")
+	}
+	sub, err := js.PullSubscribe(jetstream.SubjectPrefix+"*.done", jetstream.ConsumerName, nats.Bind(jetstream.StreamName, jetstream.ConsumerName))
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to bind JetStream consumer")
+	}
+	// Bound subscriptions never delete the durable consumer.
+	defer sub.Unsubscribe()
+
+	ackWait := 30 * time.Second
+	if info, err := sub.ConsumerInfo(); err == nil && info.Config.AckWait > 0 {
+		ackWait = info.Config.AckWait
+	}
+	// Held markers are touched well within AckWait so JetStream only
+	// redelivers work whose holder has died.
+	touch := time.NewTicker(ackWait / 3)
+	defer touch.Stop()
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+	if opts.Sweep != nil {
+		defer opts.Sweep.Release()
+	}
+
+	c := &consumer{
+		p:        p,
+		js:       js,
+		chunks:   chunks,
+		opts:     opts,
+		inFlight: make(map[uuid.UUID]*nats.Msg),
+	}
+	for ctx.Err() == nil {
+		select {
+		case <-touch.C:
+			c.touch()
+			c.evictAbandoned()
+		case <-sweep.C:
+			c.sweepOrphans()
+		default:
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		msgs, err := sub.Fetch(fetchBatch, nats.Context(fetchCtx))
+		cancel()
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) && !errors.Is(err, nats.ErrTimeout) {
+			log.Warn().Err(err).Msg("JetStream fetch failed")
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			c.handle(ctx, msg)
+		}
+	}
+}
+
+func (c *consumer) handle(ctx context.Context, done *nats.Msg) {
+	requestID := extractRequestID(done.Subject)
+	if requestID == uuid.Nil {
+		done.Term()
+		return
+	}
+
+	c.mu.Lock()
+	_, inFlight := c.inFlight[requestID]
+	c.mu.Unlock()
+	if inFlight {
+		return
+	}
+
+	chunks, err := c.chunks.Read(ctx, requestID.String())
+	if err != nil {
+		log.Warn().Err(err).Str("request_id", requestID.String()).Msg("failed to read stream chunks")
+		done.NakWithDelay(5 * time.Second)
+		return
+	}
+	if len(chunks) == 0 {
+		// Already processed and purged, e.g. a duplicate marker.
+		done.Ack()
+		return
+	}
+
+	var ts time.Time
+	var tsKnown bool
+	var meta struct {
+		TS      int64  `json:"ts"`
+		Key     string `json:"key"`
+		Account string `json:"account"`
+	}
+	if err := json.Unmarshal(done.Data, &meta); err == nil && meta.TS != 0 {
+		ts, tsKnown = time.Unix(0, meta.TS), true
+	} else if nanos, err := strconv.ParseInt(chunks[0].Header.Get(jetstream.TSHeader), 10, 64); err == nil {
+		ts, tsKnown = time.Unix(0, nanos), true
+	} else {
+		ts = time.Now()
+	}
+
+	// JetStream's receive time stands in for when the proxy got each chunk.
+	data := make([]chunk, len(chunks))
+	for i, m := range chunks {
+		data[i] = chunk{data: m.Data, at: m.Time}
+	}
+
+	var extra []storage.WriteJob
+	abandoned := done.Header.Get(jetstream.AbandonedHeader) != ""
+	reason := fmt.Sprintf("stream incomplete: no end of stream after %s idle", c.opts.StreamTTL)
+	if abandoned {
+		if tsKnown {
+			extra = append(extra, storage.MarkRequestIncompleteJob(requestID, ts, reason))
+		} else {
+			// Without the proxy's timestamp the request row cannot be
+			// addressed; keep only what the chunks themselves carry.
+			data = nil
+		}
+	}
+
+	c.mu.Lock()
+	c.inFlight[requestID] = done
+	c.p.stats.inFlight.Store(int64(len(c.inFlight)))
+	c.mu.Unlock()
+
+	jobs, o := c.p.streamJobs(requestID, ts, data)
+	o.account, o.key = meta.Account, meta.Key
+	jobs = append(jobs, extra...)
+	if abandoned && o.errType == "" {
+		o.errType, o.errMessage = "incomplete_stream", reason
+	}
+	c.p.writer.EnqueueAll(jobs, func(durable bool) {
+		if durable {
+			c.p.announce(requestID, ts, true, o)
+		}
+		c.settle(requestID, done, durable)
+	})
+}
+
+// settle drops a processed request's chunks and acks its marker. If any of
+// its writes was lost, or the purge fails, the marker is left for
+// redelivery so that the stream is processed again and its chunks are not
+// mistaken for an abandoned stream later.
+func (c *consumer) settle(requestID uuid.UUID, done *nats.Msg, durable bool) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.inFlight, requestID)
+		c.p.stats.inFlight.Store(int64(len(c.inFlight)))
+		c.mu.Unlock()
+	}()
+
+	logger := log.With().Str("request_id", requestID.String()).Logger()
+	if !durable {
+		logger.Warn().Msg("writes of processed stream lost, leaving it for redelivery")
+		done.NakWithDelay(5 * time.Second)
+		return
+	}
+	err := c.js.PurgeStream(jetstream.StreamName, &nats.StreamPurgeRequest{
+		Subject: jetstream.ChunkSubject(requestID.String()),
+	})
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to purge stream chunks")
+		done.Nak()
+	} else if err := done.Ack(); err != nil {
+		logger.Warn().Err(err).Msg("failed to ack end of stream")
+	}
+}
+
+// touch resets the AckWait timer of every marker still held.
+func (c *consumer) touch() {
+	c.mu.Lock()
+	held := make([]*nats.Msg, 0, len(c.inFlight))
+	for _, m := range c.inFlight {
+		held = append(held, m)
+	}
+	c.mu.Unlock()
+	for _, m := range held {
+		m.InProgress()
+	}
+}
+
+// evictAbandoned gives up on streams of this replica's proxy that stopped
+// receiving chunks without an end-of-stream marker, e.g. because the
+// upstream stalled mid-response.
+func (c *consumer) evictAbandoned() {
+	type idleStream struct {
+		requestID string
+		idle      time.Duration
+		chunks    int
+	}
+	var idle []idleStream
+	c.p.openMu.Lock()
+	for id, st := range c.p.open {
+		if d := time.Since(st.lastChunk); d >= c.opts.StreamTTL {
+			idle = append(idle, idleStream{id, d, st.chunks})
+		}
+	}
+	c.p.openMu.Unlock()
+
+	for _, st := range idle {
+		if c.abandon(st.requestID, st.idle, st.chunks) {
+			c.p.StreamClosed(st.requestID)
+		}
+	}
+}
+
+// sweepOrphans gives up on streams whose proxy died mid-response, which no
+// replica tracks. Only the holder of the sweep lease runs it: it lists the
+// streams with chunks and no end-of-stream marker, and checks when each got
+// its last chunk.
+func (c *consumer) sweepOrphans() {
+	if c.opts.Sweep == nil || !c.opts.Sweep.Acquire() {
+		return
+	}
+	info, err := c.js.StreamInfo(jetstream.StreamName, &nats.StreamInfoRequest{
+		SubjectsFilter: jetstream.SubjectPrefix + ">",
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to list open streams")
+		return
+	}
+	subjects := info.State.Subjects
+	for subject, n := range subjects {
+		if strings.HasSuffix(subject, ".done") {
+			continue
+		}
+		if _, ok := subjects[subject+".done"]; ok {
+			continue
+		}
+		last, err := c.js.GetLastMsg(jetstream.StreamName, subject)
+		if err != nil {
+			// Purged since it was listed.
+			continue
+		}
+		if idle := time.Since(last.Time); idle >= c.opts.StreamTTL {
+			c.abandon(strings.TrimPrefix(subject, jetstream.SubjectPrefix), idle, int(n))
+		}
+	}
+}
+
+// abandon publishes the end-of-stream marker of an abandoned stream on its
+// proxy's behalf; the normal path then processes whatever arrived and
+// records the request as incomplete. JetStream deduplicates the markers of
+// an owner and the sweep giving up on the same stream.
+func (c *consumer) abandon(requestID string, idle time.Duration, chunks int) bool {
+	log.Warn().
+		Str("request_id", requestID).
+		Int("chunks", chunks).
+		Dur("idle", idle).
+		Msg("evicting abandoned stream")
+	if _, err := c.js.PublishMsg(jetstream.AbandonedMsg(requestID)); err != nil {
+		log.Warn().Err(err).Str("request_id", requestID).Msg("failed to publish end of abandoned stream")
+		return false
+	}
+	c.p.stats.evicted.Add(1)
+	return true
+}
+
+func extractRequestID(subject string) uuid.UUID {
+	s := strings.TrimPrefix(subject, jetstream.SubjectPrefix)
+	id, err := uuid.Parse(strings.TrimSuffix(s, ".done"))
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
@@ -1,28 +1,53 @@
 package processor
 
 import (
-	"bytes"
-	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"sort"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/budget"
+	"github.com/namikmesic/claude-sidekick/internal/events"
+	"github.com/namikmesic/claude-sidekick/internal/metrics"
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
 	"github.com/namikmesic/claude-sidekick/internal/storage"
 	"github.com/namikmesic/claude-sidekick/internal/stream"
-	nats "github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 )
 
 // Processor handles background analytics for proxied requests.
 type Processor struct {
-	writer *storage.BatchWriter
+	writer  *storage.BatchWriter
+	events  *events.Publisher
+	budgets *budget.Tracker
+	stats   consumerStats
+
+	// open tracks the streams this replica's proxy is publishing, by
+	// request ID.
+	openMu sync.Mutex
+	open   map[string]*openStream
 }
 
-func New(writer *storage.BatchWriter) *Processor {
-	return &Processor{writer: writer}
+// New returns a Processor. events and budgets may be nil.
+func New(writer *storage.BatchWriter, pub *events.Publisher, budgets *budget.Tracker) *Processor {
+	return &Processor{writer: writer, events: pub, budgets: budgets, open: make(map[string]*openStream)}
+}
+
+// outcome summarises a processed response for its domain events.
+type outcome struct {
+	model      string
+	messageID  string
+	stopReason string
+	usage      pricing.Usage
+	cost       float64
+	tools      []RespBlock // tool_use blocks
+	errType    string      // set when the stream carried an error event
+	errMessage string
+	account    string // Claude Code account, for metrics
+	key        string // API key fingerprint, for metrics
 }
 
 type streamBlock struct {
@@ -33,111 +58,72 @@ type streamBlock struct {
 	inputJSON string // accumulated partial_json fragments for tool_use
 }
 
-type reqAccumulator struct {
-	ts  time.Time
-	buf bytes.Buffer
-}
-
-func (p *Processor) StartConsumer(ctx context.Context, js nats.JetStreamContext) {
-	accumulators := make(map[uuid.UUID]*reqAccumulator)
-
-	sub, err := js.Subscribe("sidekick.req.>", func(msg *nats.Msg) {
-		subject := msg.Subject
-		msg.Ack()
-
-		if strings.HasSuffix(subject, ".done") {
-			requestID := extractRequestID(subject, true)
-			if requestID == uuid.Nil {
-				return
-			}
-			acc, ok := accumulators[requestID]
-			if !ok {
-				return
-			}
-			delete(accumulators, requestID)
-
-			var meta struct {
-				TS int64 `json:"ts"`
-			}
-			if err := json.Unmarshal(msg.Data, &meta); err == nil && meta.TS != 0 {
-				acc.ts = time.Unix(0, meta.TS)
-			}
-
-			p.processReader(requestID, acc.ts, bytes.NewReader(acc.buf.Bytes()))
-		} else {
-			requestID := extractRequestID(subject, false)
-			if requestID == uuid.Nil {
-				return
-			}
-			if _, ok := accumulators[requestID]; !ok {
-				accumulators[requestID] = &reqAccumulator{ts: time.Now()}
-			}
-			accumulators[requestID].buf.Write(msg.Data)
-		}
-	})
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to subscribe to JetStream")
-	}
-
-	<-ctx.Done()
-	sub.Drain()
-}
-
-func extractRequestID(subject string, done bool) uuid.UUID {
-	const prefix = "sidekick.req."
-	s := strings.TrimPrefix(subject, prefix)
-	if done {
-		s = strings.TrimSuffix(s, ".done")
-	}
-	id, err := uuid.Parse(s)
-	if err != nil {
-		return uuid.Nil
-	}
-	return id
+// chunk is a piece of a streamed response and when the proxy received it.
+type chunk struct {
+	data []byte
+	at   time.Time
 }
 
-func (p *Processor) processReader(requestID uuid.UUID, ts time.Time, reader io.Reader) {
+// streamJobs parses a complete SSE stream and returns the write jobs that
+// record it.
+func (p *Processor) streamJobs(requestID uuid.UUID, ts time.Time, chunks []chunk) ([]storage.WriteJob, *outcome) {
 	parser := stream.NewParser()
-	buf := make([]byte, 32*1024)
 
 	var allEvents []stream.SSEEvent
 	var model, messageID, stopReason string
 	var stopSequence *string
 	var inputTokens, outputTokens, cacheRead, cacheCreation int
 	blocks := make(map[int]*streamBlock)
+	o := &outcome{}
 
-	for {
-		n, err := reader.Read(buf)
-		if n > 0 {
-			events := parser.ParseChunk(buf[:n])
-			allEvents = append(allEvents, events...)
-
-			for _, ev := range events {
-				p.extractStreamFields(ev, &model, &messageID, &stopReason, &stopSequence, &inputTokens, &outputTokens, &cacheRead, &cacheCreation)
-				p.accumulateBlock(ev, blocks)
+	for _, c := range chunks {
+		events := parser.ParseChunk(c.data)
+		for i, ev := range events {
+			if c.at.After(ts) {
+				events[i].OffsetMs = int(c.at.Sub(ts).Milliseconds())
+			}
+			extractStreamFields(ev, &model, &messageID, &stopReason, &stopSequence, &inputTokens, &outputTokens, &cacheRead, &cacheCreation)
+			accumulateBlock(ev, blocks)
+			if ev.EventType == "error" {
+				o.errType, o.errMessage = parseError([]byte(ev.RawData))
 			}
 		}
-		if err != nil {
-			break
-		}
+		allEvents = append(allEvents, events...)
 	}
 
+	var jobs []storage.WriteJob
 	if len(allEvents) > 0 {
-		p.writer.Enqueue(storage.InsertSSEEventsJob(requestID, ts, allEvents))
+		jobs = append(jobs, storage.InsertSSEEventsJob(requestID, ts, allEvents))
 	}
 
-	totalTokens := inputTokens + outputTokens + cacheRead + cacheCreation
+	o.model, o.messageID, o.stopReason = model, messageID, stopReason
+	o.usage = pricing.Usage{
+		InputTokens:         inputTokens,
+		OutputTokens:        outputTokens,
+		CacheReadTokens:     cacheRead,
+		CacheCreationTokens: cacheCreation,
+	}
+	totalTokens := o.usage.Total()
 	if model != "" || totalTokens > 0 {
-		p.writer.Enqueue(storage.UpdateRequestUsageJob(
+		o.cost = pricing.Cost(model, o.usage)
+		jobs = append(jobs, storage.UpdateRequestUsageJob(
 			requestID, ts, model,
 			inputTokens, outputTokens, cacheRead, cacheCreation, totalTokens,
-			0, 0,
+			o.cost, 0,
 			stopReason, messageID,
 		))
 	}
 
-	if respBody := reconstructResponse(messageID, model, stopReason, stopSequence, blocks, inputTokens, outputTokens, cacheRead, cacheCreation); respBody != nil {
-		p.writer.Enqueue(storage.UpdatePayloadResponseJob(requestID, ts, respBody, stopSequence))
+	resp := reconstructResponse(messageID, model, stopReason, stopSequence, blocks, inputTokens, outputTokens, cacheRead, cacheCreation)
+	if resp != nil {
+		for _, b := range resp.Content {
+			if b.Type == "tool_use" {
+				o.tools = append(o.tools, b)
+			}
+		}
+		if respBody, err := json.Marshal(resp); err == nil {
+			jobs = append(jobs, storage.UpdatePayloadResponseJob(requestID, ts, respBody, stopSequence, resp.SearchText()))
+		}
 	}
 
 	log.Debug().
@@ -148,10 +134,100 @@ func (p *Processor) processReader(requestID uuid.UUID, ts time.Time, reader io.R
 		Int("input_tokens", inputTokens).
 		Int("output_tokens", outputTokens).
 		Msg("stream processing complete")
+	return jobs, o
+}
+
+// ReadStream reassembles the message carried by a complete SSE stream, as
+// the processor stores it. Returns nil when the stream carried no message,
+// and an error when it carried an error event.
+func ReadStream(r io.Reader) (*AnthropicResponse, error) {
+	parser := stream.NewParser()
+	buf := make([]byte, 32*1024)
+
+	var model, messageID, stopReason string
+	var stopSequence *string
+	var inputTokens, outputTokens, cacheRead, cacheCreation int
+	blocks := make(map[int]*streamBlock)
+	for {
+		n, err := r.Read(buf)
+		for _, ev := range parser.ParseChunk(buf[:n]) {
+			extractStreamFields(ev, &model, &messageID, &stopReason, &stopSequence, &inputTokens, &outputTokens, &cacheRead, &cacheCreation)
+			accumulateBlock(ev, blocks)
+			if ev.EventType == "error" {
+				errType, message := parseError([]byte(ev.RawData))
+				return nil, fmt.Errorf("%s: %s", errType, message)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reconstructResponse(messageID, model, stopReason, stopSequence, blocks, inputTokens, outputTokens, cacheRead, cacheCreation), nil
+}
+
+// StreamEvents returns the SSE events of a stream carrying msg, the inverse
+// of ReadStream. Each content block is sent as a single delta.
+func StreamEvents(msg *AnthropicResponse) []stream.SSEEvent {
+	var evs []stream.SSEEvent
+	add := func(eventType string, data any) {
+		raw, _ := json.Marshal(data)
+		evs = append(evs, stream.SSEEvent{Index: len(evs) + 1, EventType: eventType, RawData: string(raw)})
+	}
+	type obj = map[string]any
+
+	usage := msg.Usage
+	usage.OutputTokens = 0 // reported by message_delta
+	add("message_start", obj{"type": "message_start", "message": obj{
+		"id": msg.ID, "type": "message", "role": "assistant", "model": msg.Model,
+		"content": []RespBlock{}, "stop_reason": nil, "stop_sequence": nil, "usage": usage,
+	}})
+	for i, b := range msg.Content {
+		var block, delta obj
+		switch b.Type {
+		case "text":
+			block = obj{"type": "text", "text": ""}
+			delta = obj{"type": "text_delta", "text": b.Text}
+		case "thinking":
+			block = obj{"type": "thinking", "thinking": ""}
+			delta = obj{"type": "thinking_delta", "thinking": b.Thinking}
+		case "tool_use":
+			block = obj{"type": "tool_use", "id": b.ID, "name": b.Name, "input": obj{}}
+			delta = obj{"type": "input_json_delta", "partial_json": string(b.Input)}
+		default:
+			continue
+		}
+		add("content_block_start", obj{"type": "content_block_start", "index": i, "content_block": block})
+		add("content_block_delta", obj{"type": "content_block_delta", "index": i, "delta": delta})
+		add("content_block_stop", obj{"type": "content_block_stop", "index": i})
+	}
+	add("message_delta", obj{
+		"type":  "message_delta",
+		"delta": obj{"stop_reason": msg.StopReason, "stop_sequence": msg.StopSequence},
+		"usage": obj{"output_tokens": msg.Usage.OutputTokens},
+	})
+	add("message_stop", obj{"type": "message_stop"})
+	return evs
 }
 
 // ProcessNonStream handles a non-streaming response body.
-func (p *Processor) ProcessNonStream(requestID uuid.UUID, ts time.Time, body []byte) {
+func (p *Processor) ProcessNonStream(requestID uuid.UUID, ts time.Time, req ParsedRequest, key string, statusCode int, body []byte) {
+	if statusCode >= 400 {
+		errType, message := parseError(body)
+		p.events.RequestFailed(events.RequestFailed{
+			RequestID:  requestID.String(),
+			Timestamp:  ts,
+			Model:      req.Model,
+			Stream:     req.Stream,
+			StatusCode: statusCode,
+			ErrorType:  errType,
+			Message:    message,
+		})
+		return
+	}
+
 	var parsed AnthropicResponse
 	if err := json.Unmarshal(body, &parsed); err != nil {
 		return
@@ -161,19 +237,107 @@ func (p *Processor) ProcessNonStream(requestID uuid.UUID, ts time.Time, body []b
 		return
 	}
 
-	totalTokens := parsed.Usage.InputTokens + parsed.Usage.OutputTokens +
-		parsed.Usage.CacheReadInputTokens + parsed.Usage.CacheCreationInputTokens
+	o := &outcome{
+		model:      parsed.Model,
+		messageID:  parsed.ID,
+		stopReason: parsed.StopReason,
+		usage:      parsed.Usage.Tokens(),
+		account:    req.AccountID,
+		key:        key,
+	}
+	o.cost = pricing.Cost(o.model, o.usage)
+	for _, b := range parsed.Content {
+		if b.Type == "tool_use" {
+			o.tools = append(o.tools, b)
+		}
+	}
 
-	p.writer.Enqueue(storage.UpdateRequestUsageJob(
+	job := storage.UpdateRequestUsageJob(
 		requestID, ts, parsed.Model,
 		parsed.Usage.InputTokens, parsed.Usage.OutputTokens,
 		parsed.Usage.CacheReadInputTokens, parsed.Usage.CacheCreationInputTokens,
-		totalTokens, 0, 0,
+		o.usage.Total(), o.cost, 0,
 		parsed.StopReason, parsed.ID,
-	))
+	)
+	p.writer.EnqueueAll([]storage.WriteJob{job}, func(bool) {
+		p.announce(requestID, ts, false, o)
+	})
+}
+
+// UpstreamFailed reports a request that got no response from upstream.
+func (p *Processor) UpstreamFailed(requestID uuid.UUID, ts time.Time, model string, stream bool, err error) {
+	p.events.RequestFailed(events.RequestFailed{
+		RequestID: requestID.String(),
+		Timestamp: ts,
+		Model:     model,
+		Stream:    stream,
+		ErrorType: "upstream_error",
+		Message:   err.Error(),
+	})
+}
+
+// announce publishes the domain events of a recorded response and counts
+// its usage and cost against the budgets and metrics.
+func (p *Processor) announce(requestID uuid.UUID, ts time.Time, stream bool, o *outcome) {
+	p.budgets.Add(o.cost, ts)
+	if o.model != "" {
+		u := o.usage
+		metrics.Usage(o.model, o.account, o.key, u.InputTokens, u.OutputTokens, u.CacheReadTokens, u.CacheCreationTokens, o.cost)
+	}
+
+	id := requestID.String()
+	if o.errType != "" {
+		p.events.RequestFailed(events.RequestFailed{
+			RequestID: id,
+			Timestamp: ts,
+			Model:     o.model,
+			Stream:    stream,
+			ErrorType: o.errType,
+			Message:   o.errMessage,
+		})
+		return
+	}
+	if o.model == "" {
+		return
+	}
+	for _, t := range o.tools {
+		p.events.ToolCalled(events.ToolCalled{
+			RequestID: id,
+			Timestamp: ts,
+			Model:     o.model,
+			ToolUseID: t.ID,
+			Name:      t.Name,
+			Input:     t.Input,
+		})
+	}
+	p.events.RequestCompleted(events.RequestCompleted{
+		RequestID:  id,
+		Timestamp:  ts,
+		Model:      o.model,
+		MessageID:  o.messageID,
+		Stream:     stream,
+		StopReason: o.stopReason,
+		Usage:      o.usage,
+		CostUSD:    o.cost,
+		ToolCalls:  len(o.tools),
+	})
 }
 
-func (p *Processor) extractStreamFields(ev stream.SSEEvent, model, messageID, stopReason *string, stopSequence **string, input, output, cacheRead, cacheCreation *int) {
+// parseError extracts the type and message of an Anthropic error body.
+func parseError(body []byte) (errType, message string) {
+	var e struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return "", ""
+	}
+	return e.Error.Type, e.Error.Message
+}
+
+func extractStreamFields(ev stream.SSEEvent, model, messageID, stopReason *string, stopSequence **string, input, output, cacheRead, cacheCreation *int) {
 	switch ev.EventType {
 	case "message_start":
 		var msg stream.MessageStart
@@ -201,7 +365,7 @@ func (p *Processor) extractStreamFields(ev stream.SSEEvent, model, messageID, st
 	}
 }
 
-func (p *Processor) accumulateBlock(ev stream.SSEEvent, blocks map[int]*streamBlock) {
+func accumulateBlock(ev stream.SSEEvent, blocks map[int]*streamBlock) {
 	switch ev.EventType {
 	case "content_block_start":
 		var msg stream.ContentBlockStart
@@ -231,7 +395,7 @@ func (p *Processor) accumulateBlock(ev stream.SSEEvent, blocks map[int]*streamBl
 	}
 }
 
-func reconstructResponse(messageID, model, stopReason string, stopSequence *string, blocks map[int]*streamBlock, inputTokens, outputTokens, cacheRead, cacheCreation int) []byte {
+func reconstructResponse(messageID, model, stopReason string, stopSequence *string, blocks map[int]*streamBlock, inputTokens, outputTokens, cacheRead, cacheCreation int) *AnthropicResponse {
 	if messageID == "" && model == "" {
 		return nil
 	}
@@ -255,7 +419,7 @@ func reconstructResponse(messageID, model, stopReason string, stopSequence *stri
 		}
 	}
 
-	resp := AnthropicResponse{
+	return &AnthropicResponse{
 		ID:           messageID,
 		Type:         "message",
 		Role:         "assistant",
@@ -270,12 +434,6 @@ func reconstructResponse(messageID, model, stopReason string, stopSequence *stri
 			CacheReadInputTokens:     cacheRead,
 		},
 	}
-
-	out, err := json.Marshal(resp)
-	if err != nil {
-		return nil
-	}
-	return out
 }
 
 func validJSON(s string) json.RawMessage {
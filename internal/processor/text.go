@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// userText returns the text of the user messages after the last assistant
+// message: what is new in this request. Earlier turns are repeated in every
+// request of a conversation and were indexed with the request that added
+// them. Tool results are left out.
+func userText(msgs []ReqMessage) string {
+	start := 0
+	for i, m := range msgs {
+		if m.Role == "assistant" {
+			start = i + 1
+		}
+	}
+	var texts []string
+	for _, m := range msgs[start:] {
+		if m.Role != "user" {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(m.Content, &s); err == nil {
+			texts = append(texts, s)
+			continue
+		}
+		var blocks []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(m.Content, &blocks); err != nil {
+			continue
+		}
+		for _, b := range blocks {
+			if b.Type == "text" && b.Text != "" {
+				texts = append(texts, b.Text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// SearchText returns the response's text, thinking and tool calls as plain
+// text for full-text search.
+func (r *AnthropicResponse) SearchText() string {
+	var texts []string
+	for _, b := range r.Content {
+		switch b.Type {
+		case "text":
+			texts = append(texts, b.Text)
+		case "thinking":
+			texts = append(texts, b.Thinking)
+		case "tool_use":
+			texts = append(texts, b.Name+" "+string(b.Input))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
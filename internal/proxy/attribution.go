@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+)
+
+// Clients may label their traffic explicitly. The headers are consumed by
+// the proxy and not forwarded upstream.
+const (
+	agentHeader        = "X-Sidekick-Agent"
+	conversationHeader = "X-Sidekick-Conversation"
+)
+
+// attribution identifies who sent a request.
+type attribution struct {
+	Key          string // fingerprint of the client's credential
+	Agent        string
+	Conversation string
+}
+
+func attribute(r *http.Request, parsed processor.ParsedRequest) attribution {
+	a := attribution{
+		Key:          keyFingerprint(r.Header),
+		Agent:        r.Header.Get(agentHeader),
+		Conversation: r.Header.Get(conversationHeader),
+	}
+	if a.Agent == "" {
+		// "claude-cli/2.0.14 (external, cli)" -> "claude-cli"
+		product, _, _ := strings.Cut(r.Header.Get("User-Agent"), " ")
+		a.Agent, _, _ = strings.Cut(product, "/")
+	}
+	if a.Conversation == "" {
+		a.Conversation = parsed.ConversationID
+	}
+	return a
+}
+
+// keyFingerprint returns a short, stable hash of the client's API key or
+// bearer token, or "" when the request carries none.
+func keyFingerprint(h http.Header) string {
+	key := h.Get("X-Api-Key")
+	if key == "" {
+		key = strings.TrimPrefix(h.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/cache"
+	"github.com/namikmesic/claude-sidekick/internal/live"
+	"github.com/namikmesic/claude-sidekick/internal/metrics"
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// cacheHeader tells clients of cacheable requests whether the response
+// came from the response cache ("hit") or upstream ("miss"). On requests,
+// "bypass" skips the cache (see cache.Bypass); it is not sent upstream.
+const cacheHeader = cache.BypassHeader
+
+// serveCached answers a request with a cached response body, synthesizing
+// an SSE stream from it for streamed requests. The request is recorded at
+// zero cost and bypasses the processor, so it counts towards no budget.
+func (h *Handler) serveCached(w http.ResponseWriter, r *http.Request, requestID uuid.UUID, ts time.Time, reqBody []byte, reqParsed processor.ParsedRequest, attr attribution, reqHash string, body []byte, liveEv live.Event) {
+	var msg processor.AnthropicResponse
+	json.Unmarshal(body, &msg)
+
+	w.Header().Set(cacheHeader, "hit")
+	if reqParsed.Stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		for _, ev := range processor.StreamEvents(&msg) {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.EventType, ev.RawData)
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+	elapsed := time.Since(ts)
+
+	model := msg.Model
+	if model == "" {
+		model = reqParsed.Model
+	}
+	h.writer.Enqueue(storage.InsertRequestJob(&storage.RequestRecord{
+		ID:                   requestID,
+		Timestamp:            ts,
+		Method:               r.Method,
+		Path:                 r.URL.Path,
+		StatusCode:           http.StatusOK,
+		Success:              true,
+		ResponseTimeMs:       int(elapsed.Milliseconds()),
+		Model:                model,
+		IsStream:             reqParsed.Stream,
+		ToolCount:            reqParsed.ToolCount,
+		ThinkingBudgetTokens: reqParsed.ThinkingBudgetTokens,
+		AgentUsed:            attr.Agent,
+		KeyFingerprint:       attr.Key,
+		ConversationID:       attr.Conversation,
+		RequestHash:          reqHash,
+		CacheHit:             true,
+	}))
+	h.writer.Enqueue(storage.UpdateRequestUsageJob(requestID, ts, model, 0, 0, 0, 0, 0, 0, 0, msg.StopReason, msg.ID))
+	h.storePayload(requestID, ts, r, reqBody, w.Header(), body, reqParsed, msg.StopSequence, msg.SearchText())
+
+	liveEv.Model = model
+	liveEv.StatusCode = http.StatusOK
+	liveEv.DurationMs = elapsed.Milliseconds()
+	liveEv.StopReason = msg.StopReason
+	liveEv.Usage = &pricing.Usage{}
+	h.live.End(liveEv)
+	metrics.Request(model, http.StatusOK, reqParsed.Stream, elapsed.Seconds())
+
+	log.Info().
+		Str("request_id", requestID.String()).
+		Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Bool("stream", reqParsed.Stream).
+		Dur("duration", elapsed).
+		Msg("served cached response")
+}
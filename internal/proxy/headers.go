@@ -34,6 +34,9 @@ func prepareUpstreamHeaders(original http.Header, apiKey string) http.Header {
 	stripHopByHop(h)
 
 	h.Del("Host")
+	h.Del(agentHeader)
+	h.Del(conversationHeader)
+	h.Del(cacheHeader)
 
 	// Inject auth if API key provided and no existing auth
 	if apiKey != "" && h.Get("Authorization") == "" {
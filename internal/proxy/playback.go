@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// playbackHeader carries the ID of the recorded request a playback was
+// served from. Playbacks are not stored themselves.
+const playbackHeader = "X-Sidekick-Playback"
+
+// playback answers r from a recording. Reports whether it did, or answered
+// with an error; false means the request should be proxied.
+func (h *Handler) playback(w http.ResponseWriter, r *http.Request, hash string) bool {
+	logger := log.With().Str("method", r.Method).Str("path", r.URL.Path).Str("request_hash", hash).Logger()
+	rec, err := h.player.Find(r.Context(), hash)
+	if err != nil {
+		if h.player.RecordMisses() {
+			if !errors.Is(err, storage.ErrNotFound) {
+				logger.Warn().Err(err).Msg("recording lookup failed, proxying")
+			}
+			return false
+		}
+		w.Header().Del(requestIDHeader)
+		if errors.Is(err, storage.ErrNotFound) {
+			logger.Warn().Msg("no recording matches request")
+			writeError(w, http.StatusNotFound, "not_found_error",
+				fmt.Sprintf("sidekick playback: no recording matches this request (hash %s)", hash))
+		} else {
+			logger.Error().Err(err).Msg("recording lookup failed")
+			writeError(w, http.StatusBadGateway, "api_error", "sidekick playback: recording lookup failed")
+		}
+		return true
+	}
+
+	start := time.Now()
+	for k, vv := range prepareClientHeaders(rec.Payload.RespHeaders) {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Del(requestIDHeader)
+	w.Header().Set(playbackHeader, rec.Request.ID.String())
+
+	if rec.Request.IsStream {
+		w.WriteHeader(rec.Request.StatusCode)
+		flusher, canFlush := w.(http.Flusher)
+		for _, ev := range rec.Events {
+			if h.player.Wait(r.Context(), start, ev.OffsetMs) != nil {
+				return true
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.EventType, ev.RawData)
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+	} else {
+		if h.player.Wait(r.Context(), start, rec.Request.ResponseTimeMs) != nil {
+			return true
+		}
+		w.WriteHeader(rec.Request.StatusCode)
+		w.Write(rec.Payload.RespBody)
+	}
+
+	logger.Info().
+		Str("recording", rec.Request.ID.String()).
+		Bool("stream", rec.Request.IsStream).
+		Dur("duration", time.Since(start)).
+		Msg("played back request")
+	return true
+}
+
+// writeError answers with an error in the API's format, so clients report
+// it like any other API error.
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	var body struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	body.Type = "error"
+	body.Error.Type, body.Error.Message = errType, message
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -9,14 +9,22 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/cache"
 	"github.com/namikmesic/claude-sidekick/internal/config"
 	"github.com/namikmesic/claude-sidekick/internal/jetstream"
+	"github.com/namikmesic/claude-sidekick/internal/live"
+	"github.com/namikmesic/claude-sidekick/internal/metrics"
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
 	"github.com/namikmesic/claude-sidekick/internal/processor"
 	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/vcr"
 	nats "github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 )
 
+// requestIDHeader tells clients the ID their request is stored under.
+const requestIDHeader = "X-Sidekick-Request-Id"
+
 // Handler is the core reverse proxy.
 type Handler struct {
 	cfg       *config.Config
@@ -24,9 +32,21 @@ type Handler struct {
 	writer    *storage.BatchWriter
 	processor *processor.Processor
 	js        nats.JetStreamContext
+	live      *live.Publisher
+	hasher    *vcr.Hasher  // nil unless VCR recording or playback is on
+	player    *vcr.Player  // nil unless VCR playback is on
+	cache     *cache.Cache // nil unless the response cache is on
 }
 
-func NewHandler(cfg *config.Config, writer *storage.BatchWriter, proc *processor.Processor, js nats.JetStreamContext) *Handler {
+func NewHandler(cfg *config.Config, writer *storage.BatchWriter, proc *processor.Processor, js nats.JetStreamContext, pub *live.Publisher, player *vcr.Player) *Handler {
+	var respCache *cache.Cache
+	if cfg.ResponseCacheTTLSec > 0 {
+		respCache = cache.New(time.Duration(cfg.ResponseCacheTTLSec)*time.Second, cfg.ResponseCacheMaxBytes)
+	}
+	var hasher *vcr.Hasher
+	if cfg.VCRMode == vcr.ModeRecord || player != nil {
+		hasher = vcr.NewHasher(cfg.VCRIgnoreFields)
+	}
 	return &Handler{
 		cfg: cfg,
 		client: &http.Client{
@@ -40,6 +60,10 @@ func NewHandler(cfg *config.Config, writer *storage.BatchWriter, proc *processor
 		writer:    writer,
 		processor: proc,
 		js:        js,
+		live:      pub,
+		hasher:    hasher,
+		player:    player,
+		cache:     respCache,
 	}
 }
 
@@ -47,6 +71,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	requestID := uuid.New()
 	ts := time.Now()
 	start := ts
+	w.Header().Set(requestIDHeader, requestID.String())
 
 	var reqBody []byte
 	if r.Body != nil {
@@ -60,7 +85,39 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var reqHash string
+	if h.hasher != nil {
+		reqHash = h.hasher.Hash(r.Method, r.URL.Path, reqBody)
+	}
+	if h.player != nil && !cache.Bypass(r) && h.playback(w, r, reqHash) {
+		return
+	}
+
 	reqParsed := processor.ParseRequest(reqBody)
+	attr := attribute(r, reqParsed)
+	liveEv := live.Event{
+		RequestID:    requestID.String(),
+		TS:           ts,
+		Model:        reqParsed.Model,
+		Key:          attr.Key,
+		Agent:        attr.Agent,
+		Conversation: attr.Conversation,
+		Stream:       reqParsed.Stream,
+		Path:         r.URL.Path,
+	}
+	h.live.Start(liveEv)
+
+	var cacheKey string
+	if h.cache != nil {
+		cacheKey = h.cache.Key(r, reqBody, reqParsed, attr.Key)
+	}
+	if cacheKey != "" {
+		if body, ok := h.cache.Get(cacheKey); ok {
+			h.serveCached(w, r, requestID, ts, reqBody, reqParsed, attr, reqHash, body, liveEv)
+			return
+		}
+		w.Header().Set(cacheHeader, "miss")
+	}
 
 	targetURL := buildTargetURL(h.cfg.AnthropicBaseURL, r.URL.Path, r.URL.RawQuery)
 	upstreamReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, bytes.NewReader(reqBody))
@@ -86,12 +143,27 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Success:        false,
 			ErrorMessage:   err.Error(),
 			ResponseTimeMs: int(time.Since(start).Milliseconds()),
+			Model:          reqParsed.Model,
+			AgentUsed:      attr.Agent,
+			KeyFingerprint: attr.Key,
+			ConversationID: attr.Conversation,
+			RequestHash:    reqHash,
 		}))
+
+		liveEv.StatusCode = http.StatusBadGateway
+		liveEv.DurationMs = time.Since(start).Milliseconds()
+		liveEv.Error = err.Error()
+		h.live.End(liveEv)
+		h.processor.UpstreamFailed(requestID, ts, reqParsed.Model, reqParsed.Stream, err)
+		metrics.Request(reqParsed.Model, http.StatusBadGateway, reqParsed.Stream, time.Since(start).Seconds())
 		return
 	}
 	defer resp.Body.Close()
 
 	isStreaming := isStreamingResponse(resp)
+	if !isStreaming {
+		metrics.UpstreamTTFT(reqParsed.Model, false, time.Since(start).Seconds())
+	}
 
 	h.writer.Enqueue(storage.InsertRequestJob(&storage.RequestRecord{
 		ID:                   requestID,
@@ -101,9 +173,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		StatusCode:           resp.StatusCode,
 		Success:              resp.StatusCode >= 200 && resp.StatusCode < 400,
 		ResponseTimeMs:       int(time.Since(start).Milliseconds()),
+		Model:                reqParsed.Model,
 		IsStream:             isStreaming,
 		ToolCount:            reqParsed.ToolCount,
 		ThinkingBudgetTokens: reqParsed.ThinkingBudgetTokens,
+		AgentUsed:            attr.Agent,
+		KeyFingerprint:       attr.Key,
+		ConversationID:       attr.Conversation,
+		RequestHash:          reqHash,
 	}))
 
 	clientHeaders := prepareClientHeaders(resp.Header)
@@ -114,10 +191,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if isStreaming {
-		h.handleStreaming(w, resp, requestID, ts, r, reqBody, reqParsed)
+		h.handleStreaming(w, resp, requestID, ts, r, reqBody, reqParsed, attr.Key, cacheKey)
 	} else {
-		h.handleNonStreaming(w, resp, requestID, ts, r, reqBody, reqParsed)
+		h.handleNonStreaming(w, resp, requestID, ts, r, reqBody, reqParsed, liveEv, cacheKey)
 	}
+	metrics.Request(reqParsed.Model, resp.StatusCode, isStreaming, time.Since(start).Seconds())
 
 	log.Info().
 		Str("request_id", requestID.String()).
@@ -129,19 +207,50 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Msg("proxied request")
 }
 
-func (h *Handler) handleStreaming(w http.ResponseWriter, resp *http.Response, requestID uuid.UUID, ts time.Time, origReq *http.Request, reqBody []byte, reqParsed processor.ParsedRequest) {
-	h.storePayload(requestID, ts, origReq, reqBody, resp, nil, reqParsed, nil)
+func (h *Handler) handleStreaming(w http.ResponseWriter, resp *http.Response, requestID uuid.UUID, ts time.Time, origReq *http.Request, reqBody []byte, reqParsed processor.ParsedRequest, key, cacheKey string) {
+	h.storePayload(requestID, ts, origReq, reqBody, resp.Header, nil, reqParsed, nil, "")
 
 	w.WriteHeader(resp.StatusCode)
 	flusher, canFlush := w.(http.Flusher)
 	buf := make([]byte, 32*1024)
-	subject := jetstream.ChunkSubject(requestID.String())
+	// Cacheable streams are kept whole to cache the message they carry.
+	var whole *bytes.Buffer
+	if cacheKey != "" && resp.StatusCode == http.StatusOK {
+		whole = &bytes.Buffer{}
+	}
 
+	// A full stream rejects chunks; the client is still served, but the
+	// request's analytics will be incomplete. Report it once per request.
+	var publishFailed bool
+	publish := func(msg *nats.Msg) {
+		if _, err := h.js.PublishMsg(msg); err != nil {
+			metrics.PublishError()
+			if !publishFailed {
+				publishFailed = true
+				log.Warn().Err(err).Str("request_id", requestID.String()).Msg("failed to publish stream chunk")
+			}
+		}
+	}
+
+	// Until its end is published, this replica gives up on the stream if
+	// the upstream stalls.
+	h.processor.StreamOpened(requestID.String())
+	defer h.processor.StreamClosed(requestID.String())
+
+	var gotFirst bool
 	for {
 		n, err := resp.Body.Read(buf)
 		if n > 0 {
-			h.js.Publish(subject, buf[:n])
+			if !gotFirst {
+				gotFirst = true
+				metrics.UpstreamTTFT(reqParsed.Model, true, time.Since(ts).Seconds())
+			}
+			publish(jetstream.ChunkMsg(requestID.String(), ts, buf[:n]))
+			h.processor.StreamChunk(requestID.String(), n)
 			w.Write(buf[:n])
+			if whole != nil {
+				whole.Write(buf[:n])
+			}
 			if canFlush {
 				flusher.Flush()
 			}
@@ -151,15 +260,34 @@ func (h *Handler) handleStreaming(w http.ResponseWriter, resp *http.Response, re
 		}
 	}
 
-	done, _ := json.Marshal(map[string]int64{"ts": ts.UnixNano()})
-	h.js.Publish(jetstream.DoneSubject(requestID.String()), done)
+	// The key and account attribute the stream's usage in the metrics.
+	done, _ := json.Marshal(map[string]any{
+		"ts":      ts.UnixNano(),
+		"status":  resp.StatusCode,
+		"key":     key,
+		"account": reqParsed.AccountID,
+	})
+	publish(&nats.Msg{Subject: jetstream.DoneSubject(requestID.String()), Data: done})
+
+	if whole != nil {
+		if msg, err := processor.ReadStream(whole); err == nil && msg != nil && msg.StopReason != "" {
+			if body, err := json.Marshal(msg); err == nil {
+				h.cache.Put(cacheKey, body)
+			}
+		}
+	}
 }
 
-func (h *Handler) handleNonStreaming(w http.ResponseWriter, resp *http.Response, requestID uuid.UUID, ts time.Time, origReq *http.Request, reqBody []byte, reqParsed processor.ParsedRequest) {
+func (h *Handler) handleNonStreaming(w http.ResponseWriter, resp *http.Response, requestID uuid.UUID, ts time.Time, origReq *http.Request, reqBody []byte, reqParsed processor.ParsedRequest, liveEv live.Event, cacheKey string) {
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to read response body")
 		w.WriteHeader(http.StatusBadGateway)
+		liveEv.StatusCode = http.StatusBadGateway
+		liveEv.DurationMs = time.Since(ts).Milliseconds()
+		liveEv.Error = err.Error()
+		h.live.End(liveEv)
+		h.processor.UpstreamFailed(requestID, ts, reqParsed.Model, false, err)
 		return
 	}
 
@@ -167,18 +295,33 @@ func (h *Handler) handleNonStreaming(w http.ResponseWriter, resp *http.Response,
 	w.Write(respBody)
 
 	var stopSequence *string
+	var respText string
 	var respParsed processor.AnthropicResponse
 	if jsonErr := json.Unmarshal(respBody, &respParsed); jsonErr == nil {
+		if cacheKey != "" && resp.StatusCode == http.StatusOK {
+			h.cache.Put(cacheKey, respBody)
+		}
 		stopSequence = respParsed.StopSequence
+		respText = respParsed.SearchText()
+		usage := respParsed.Usage.Tokens()
+		if respParsed.Model != "" {
+			liveEv.Model = respParsed.Model
+		}
+		liveEv.StopReason = respParsed.StopReason
+		liveEv.Usage = &usage
+		liveEv.CostUSD = pricing.Cost(liveEv.Model, usage)
 	}
+	liveEv.StatusCode = resp.StatusCode
+	liveEv.DurationMs = time.Since(ts).Milliseconds()
+	h.live.End(liveEv)
 
-	go h.processor.ProcessNonStream(requestID, ts, respBody)
-	h.storePayload(requestID, ts, origReq, reqBody, resp, respBody, reqParsed, stopSequence)
+	go h.processor.ProcessNonStream(requestID, ts, reqParsed, liveEv.Key, resp.StatusCode, respBody)
+	h.storePayload(requestID, ts, origReq, reqBody, resp.Header, respBody, reqParsed, stopSequence, respText)
 }
 
-func (h *Handler) storePayload(requestID uuid.UUID, ts time.Time, req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, reqParsed processor.ParsedRequest, stopSequence *string) {
+func (h *Handler) storePayload(requestID uuid.UUID, ts time.Time, req *http.Request, reqBody []byte, respHeader http.Header, respBody []byte, reqParsed processor.ParsedRequest, stopSequence *string, respText string) {
 	reqHeaders := headerMap(req.Header)
-	respHeaders := headerMap(resp.Header)
+	respHeaders := headerMap(respHeader)
 	extras := storage.PayloadExtras{
 		SystemPrompt: reqParsed.SystemPrompt,
 		MaxTokens:    reqParsed.MaxTokens,
@@ -186,6 +329,8 @@ func (h *Handler) storePayload(requestID uuid.UUID, ts time.Time, req *http.Requ
 		TopP:         reqParsed.TopP,
 		MessageCount: reqParsed.MessageCount,
 		StopSequence: stopSequence,
+		UserText:     reqParsed.UserText,
+		ResponseText: respText,
 	}
 	h.writer.Enqueue(storage.InsertPayloadJob(requestID, ts, reqHeaders, respHeaders, reqBody, respBody, extras))
 }
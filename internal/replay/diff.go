@@ -0,0 +1,208 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/namikmesic/claude-sidekick/internal/pricing"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// Result compares a replay with the stored request.
+type Result struct {
+	RequestID       string    `json:"request_id"`
+	ReplayRequestID string    `json:"replay_request_id,omitempty"`
+	Overrides       Overrides `json:"overrides"`
+	// Imported requests were rebuilt from a client transcript without the
+	// system prompt and tool definitions, so replays of them differ anyway.
+	Imported   bool            `json:"imported,omitempty"`
+	Model      Change[string]  `json:"model"`
+	StopReason Change[string]  `json:"stop_reason"`
+	Text       TextDiff        `json:"text"`
+	ToolCalls  []ToolCallDiff  `json:"tool_calls"`
+	Usage      UsageDiff       `json:"usage"`
+	LatencyMs  Change[int]     `json:"latency_ms"` // until the response headers
+	Response   json.RawMessage `json:"response"`   // the replay's message
+}
+
+// Change is a value of the stored response next to the replay's.
+type Change[T comparable] struct {
+	Original T    `json:"original"`
+	Replay   T    `json:"replay"`
+	Changed  bool `json:"changed"`
+}
+
+func change[T comparable](original, replay T) Change[T] {
+	return Change[T]{Original: original, Replay: replay, Changed: original != replay}
+}
+
+// TextDiff compares the text blocks of both responses. Diff holds the
+// lines of both, prefixed "  " when unchanged, "- " when only in the
+// original and "+ " when only in the replay.
+type TextDiff struct {
+	Changed bool     `json:"changed"`
+	Diff    []string `json:"diff,omitempty"`
+}
+
+// Tool call diff statuses.
+const (
+	ToolSame    = "same"
+	ToolChanged = "changed"
+	ToolAdded   = "added"
+	ToolRemoved = "removed"
+)
+
+// ToolCallDiff compares the tool calls at one position of both responses.
+type ToolCallDiff struct {
+	Status   string    `json:"status"`
+	Original *ToolCall `json:"original,omitempty"`
+	Replay   *ToolCall `json:"replay,omitempty"`
+}
+
+type ToolCall struct {
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+type UsageDiff struct {
+	InputTokens         Change[int]     `json:"input_tokens"`
+	OutputTokens        Change[int]     `json:"output_tokens"`
+	CacheReadTokens     Change[int]     `json:"cache_read_tokens"`
+	CacheCreationTokens Change[int]     `json:"cache_creation_tokens"`
+	CostUSD             Change[float64] `json:"cost_usd"`
+}
+
+func diff(req *storage.Request, original, replayed *processor.AnthropicResponse, latencyMs int) *Result {
+	res := &Result{
+		RequestID:  req.ID.String(),
+		Imported:   req.Imported,
+		Model:      change(req.Model, replayed.Model),
+		StopReason: change(req.StopReason, replayed.StopReason),
+		LatencyMs:  change(req.ResponseTimeMs, latencyMs),
+		ToolCalls:  diffToolCalls(toolCalls(original), toolCalls(replayed)),
+	}
+	res.Response, _ = json.Marshal(replayed)
+
+	before, after := text(original), text(replayed)
+	if before != after {
+		res.Text = TextDiff{Changed: true, Diff: diffLines(lines(before), lines(after))}
+	}
+
+	usage := replayed.Usage.Tokens()
+	res.Usage = UsageDiff{
+		InputTokens:         change(req.InputTokens, usage.InputTokens),
+		OutputTokens:        change(req.OutputTokens, usage.OutputTokens),
+		CacheReadTokens:     change(req.CacheReadTokens, usage.CacheReadTokens),
+		CacheCreationTokens: change(req.CacheCreationTokens, usage.CacheCreationTokens),
+		CostUSD:             change(req.CostUSD, pricing.Cost(replayed.Model, usage)),
+	}
+	return res
+}
+
+func text(r *processor.AnthropicResponse) string {
+	var parts []string
+	for _, b := range r.Content {
+		if b.Type == "text" {
+			parts = append(parts, b.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func toolCalls(r *processor.AnthropicResponse) []ToolCall {
+	var out []ToolCall
+	for _, b := range r.Content {
+		if b.Type == "tool_use" {
+			out = append(out, ToolCall{Name: b.Name, Input: b.Input})
+		}
+	}
+	return out
+}
+
+// diffToolCalls pairs tool calls by position.
+func diffToolCalls(original, replayed []ToolCall) []ToolCallDiff {
+	out := []ToolCallDiff{}
+	for i := range max(len(original), len(replayed)) {
+		switch {
+		case i >= len(replayed):
+			out = append(out, ToolCallDiff{Status: ToolRemoved, Original: &original[i]})
+		case i >= len(original):
+			out = append(out, ToolCallDiff{Status: ToolAdded, Replay: &replayed[i]})
+		default:
+			status := ToolSame
+			if original[i].Name != replayed[i].Name || !sameJSON(original[i].Input, replayed[i].Input) {
+				status = ToolChanged
+			}
+			out = append(out, ToolCallDiff{Status: status, Original: &original[i], Replay: &replayed[i]})
+		}
+	}
+	return out
+}
+
+// sameJSON compares two JSON values ignoring formatting and key order.
+func sameJSON(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
+
+// maxDiffCells bounds the LCS table; longer texts are shown as replaced
+// wholesale.
+const maxDiffCells = 4 << 20
+
+// diffLines is a line diff from the longest common subsequence.
+func diffLines(a, b []string) []string {
+	if len(a)*len(b) > maxDiffCells {
+		out := make([]string, 0, len(a)+len(b))
+		for _, l := range a {
+			out = append(out, "- "+l)
+		}
+		for _, l := range b {
+			out = append(out, "+ "+l)
+		}
+		return out
+	}
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, "  "+a[i])
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	return out
+}
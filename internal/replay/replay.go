@@ -0,0 +1,206 @@
+// Package replay resends stored requests through the proxy, optionally with
+// another model or sampling settings, and diffs the new response against the
+// stored one: text, tool calls, usage and latency.
+//
+// Replays are ordinary proxied requests attributed to the agent
+// "sidekick-replay" and the conversation "replay-<original request ID>", so
+// they are recorded like any other traffic and easy to tell apart. They
+// bypass the response cache and VCR playback, which would answer with the
+// stored response again.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+const (
+	Agent = "sidekick-replay"
+
+	agentHeader        = "X-Sidekick-Agent"
+	conversationHeader = "X-Sidekick-Conversation"
+	requestIDHeader    = "X-Sidekick-Request-Id"
+	cacheHeader        = "X-Sidekick-Cache"
+)
+
+// ErrNoRequestBody is returned for requests stored without a body.
+var ErrNoRequestBody = errors.New("request has no stored body")
+
+// UpstreamError is a replay the API answered with an error.
+type UpstreamError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("replay failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("replay failed with status %d: %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// Overrides change the replayed request; zero fields keep the original.
+type Overrides struct {
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+}
+
+type Replayer struct {
+	store    storage.Store
+	proxyURL string
+	apiKey   string
+	client   *http.Client
+}
+
+// NewReplayer sends replays to the proxy at proxyURL, authenticated with
+// apiKey when it is set (stored credentials are redacted).
+func NewReplayer(store storage.Store, proxyURL, apiKey string) *Replayer {
+	return &Replayer{
+		store:    store,
+		proxyURL: strings.TrimRight(proxyURL, "/"),
+		apiKey:   apiKey,
+		client:   &http.Client{},
+	}
+}
+
+// Replay resends a stored request and diffs the responses. Returns
+// storage.ErrNotFound for unknown requests, ErrNoRequestBody, or an
+// *UpstreamError when the replay itself failed.
+func (r *Replayer) Replay(ctx context.Context, requestID uuid.UUID, o Overrides) (*Result, error) {
+	req, err := r.store.GetRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := r.store.GetPayload(ctx, requestID)
+	if errors.Is(err, storage.ErrNotFound) || err == nil && len(p.ReqBody) == 0 {
+		return nil, ErrNoRequestBody
+	}
+	if err != nil {
+		return nil, err
+	}
+	body, err := rebuild(p.ReqBody, o)
+	if err != nil {
+		return nil, err
+	}
+
+	path := req.Path
+	if path == "" {
+		path = "/v1/messages"
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.proxyURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header = replayHeaders(p.ReqHeaders)
+	hreq.Header.Set(agentHeader, Agent)
+	hreq.Header.Set(conversationHeader, "replay-"+requestID.String())
+	hreq.Header.Set(cacheHeader, "bypass")
+	if r.apiKey != "" {
+		hreq.Header.Set("X-Api-Key", r.apiKey)
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(hreq)
+	if err != nil {
+		return nil, fmt.Errorf("send replay: %w", err)
+	}
+	defer resp.Body.Close()
+	// Matches how the proxy measures response_time_ms: until the response
+	// headers arrive.
+	latency := int(time.Since(start).Milliseconds())
+
+	var replayed *processor.AnthropicResponse
+	if resp.StatusCode >= 400 {
+		raw, _ := io.ReadAll(resp.Body)
+		return nil, upstreamError(resp.StatusCode, raw)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		if replayed, err = processor.ReadStream(resp.Body); err != nil {
+			return nil, &UpstreamError{StatusCode: resp.StatusCode, Message: err.Error()}
+		}
+	} else {
+		replayed = &processor.AnthropicResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(replayed); err != nil {
+			return nil, fmt.Errorf("read replay response: %w", err)
+		}
+	}
+	if replayed == nil {
+		return nil, &UpstreamError{StatusCode: resp.StatusCode, Message: "response carried no message"}
+	}
+
+	var original processor.AnthropicResponse
+	json.Unmarshal(p.RespBody, &original)
+	res := diff(req, &original, replayed, latency)
+	res.ReplayRequestID = resp.Header.Get(requestIDHeader)
+	res.Overrides = o
+	return res, nil
+}
+
+// rebuild applies the overrides to a stored request body.
+func rebuild(reqBody []byte, o Overrides) ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(reqBody, &body); err != nil {
+		return nil, fmt.Errorf("stored request body is not a JSON object: %w", err)
+	}
+	set := func(key string, v any) {
+		body[key], _ = json.Marshal(v)
+	}
+	if o.Model != "" {
+		set("model", o.Model)
+	}
+	if o.Temperature != nil {
+		set("temperature", *o.Temperature)
+	}
+	if o.MaxTokens > 0 {
+		set("max_tokens", o.MaxTokens)
+	}
+	return json.Marshal(body)
+}
+
+// Headers of the original request not to replay: credentials (stored
+// redacted), sidekick's own labels and transport headers.
+var droppedHeaders = []string{
+	"Authorization", "X-Api-Key", "Content-Length", "Host", "Accept-Encoding",
+	"Connection", "User-Agent", agentHeader, conversationHeader,
+}
+
+func replayHeaders(stored map[string][]string) http.Header {
+	h := http.Header{}
+	for k, vv := range stored {
+		for _, v := range vv {
+			h.Add(k, v)
+		}
+	}
+	for _, k := range droppedHeaders {
+		h.Del(k)
+	}
+	h.Set("Content-Type", "application/json")
+	if h.Get("Anthropic-Version") == "" {
+		h.Set("Anthropic-Version", "2023-06-01")
+	}
+	return h
+}
+
+func upstreamError(status int, body []byte) *UpstreamError {
+	var e struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &e)
+	return &UpstreamError{StatusCode: status, Type: e.Error.Type, Message: e.Error.Message}
+}
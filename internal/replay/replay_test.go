@@ -0,0 +1,147 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want []string
+	}{
+		{nil, nil, nil},
+		{[]string{"x"}, []string{"x"}, []string{"  x"}},
+		{[]string{"a", "b", "c"}, []string{"a", "c", "d"}, []string{"  a", "- b", "  c", "+ d"}},
+		{nil, []string{"new"}, []string{"+ new"}},
+		{[]string{"old"}, nil, []string{"- old"}},
+	}
+	for _, tt := range tests {
+		if got := diffLines(tt.a, tt.b); !slices.Equal(got, tt.want) {
+			t.Errorf("diffLines(%q, %q) = %q; want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDiffToolCalls(t *testing.T) {
+	call := func(name, input string) ToolCall { return ToolCall{Name: name, Input: json.RawMessage(input)} }
+	got := diffToolCalls(
+		[]ToolCall{call("read", `{"a":1,"b":2}`), call("grep", `{"q":"x"}`), call("ls", `{}`)},
+		[]ToolCall{call("read", `{"b":2, "a":1}`), call("grep", `{"q":"y"}`)},
+	)
+	var statuses []string
+	for _, d := range got {
+		statuses = append(statuses, d.Status)
+	}
+	if want := []string{ToolSame, ToolChanged, ToolRemoved}; !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %v; want %v", statuses, want)
+	}
+	if got := diffToolCalls(nil, []ToolCall{call("ls", `{}`)}); len(got) != 1 || got[0].Status != ToolAdded {
+		t.Errorf("added call = %+v", got)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	temp := 0.5
+	body, err := rebuild([]byte(`{"model":"a","max_tokens":10,"messages":[]}`), Overrides{Model: "b", Temperature: &temp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	json.Unmarshal(body, &got)
+	if got["model"] != "b" || got["temperature"] != 0.5 || got["max_tokens"] != 10.0 {
+		t.Errorf("rebuilt body = %s", body)
+	}
+	if _, err := rebuild([]byte(`[]`), Overrides{}); err == nil {
+		t.Error("non-object body accepted")
+	}
+}
+
+// fakeStore holds one request.
+type fakeStore struct {
+	storage.Store
+	req     *storage.Request
+	payload *storage.PayloadRecord
+}
+
+func (s *fakeStore) GetRequest(context.Context, uuid.UUID) (*storage.Request, error) {
+	return s.req, nil
+}
+
+func (s *fakeStore) GetPayload(context.Context, uuid.UUID) (*storage.PayloadRecord, error) {
+	return s.payload, nil
+}
+
+func TestReplay(t *testing.T) {
+	id := uuid.New()
+	original := processor.AnthropicResponse{
+		Model:      "claude-sonnet-4-5",
+		StopReason: "end_turn",
+		Content:    []processor.RespBlock{{Type: "text", Text: "one\ntwo"}},
+		Usage:      processor.UsageInfo{InputTokens: 10, OutputTokens: 5},
+	}
+	respBody, _ := json.Marshal(original)
+	store := &fakeStore{
+		req: &storage.Request{ID: id, Path: "/v1/messages", Model: "claude-sonnet-4-5",
+			StopReason: "end_turn", InputTokens: 10, OutputTokens: 5},
+		payload: &storage.PayloadRecord{
+			ReqHeaders: map[string][]string{"X-Api-Key": {"redacted"}, "Anthropic-Beta": {"b"}},
+			ReqBody:    []byte(`{"model":"claude-sonnet-4-5","temperature":0,"messages":[]}`),
+			RespBody:   respBody,
+		},
+	}
+
+	var got *http.Request
+	var gotBody []byte
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set(requestIDHeader, "replayed")
+		json.NewEncoder(w).Encode(processor.AnthropicResponse{
+			Model:      "claude-haiku-4-5",
+			StopReason: "end_turn",
+			Content:    []processor.RespBlock{{Type: "text", Text: "one\nthree"}},
+			Usage:      processor.UsageInfo{InputTokens: 10, OutputTokens: 7},
+		})
+	}))
+	defer proxy.Close()
+
+	res, err := NewReplayer(store, proxy.URL, "key").Replay(context.Background(), id, Overrides{Model: "claude-haiku-4-5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Header.Get(cacheHeader) != "bypass" {
+		t.Errorf("%s = %q; want bypass", cacheHeader, got.Header.Get(cacheHeader))
+	}
+	if got.Header.Get("X-Api-Key") != "key" || got.Header.Get("Anthropic-Beta") != "b" {
+		t.Errorf("headers = %v", got.Header)
+	}
+	if got.Header.Get(conversationHeader) != "replay-"+id.String() {
+		t.Errorf("conversation = %q", got.Header.Get(conversationHeader))
+	}
+	var sent map[string]any
+	json.Unmarshal(gotBody, &sent)
+	if sent["model"] != "claude-haiku-4-5" {
+		t.Errorf("sent model %v", sent["model"])
+	}
+
+	if res.ReplayRequestID != "replayed" || !res.Model.Changed || res.StopReason.Changed {
+		t.Errorf("result = %+v", res)
+	}
+	if want := []string{"  one", "- two", "+ three"}; !slices.Equal(res.Text.Diff, want) {
+		t.Errorf("text diff = %q; want %q", res.Text.Diff, want)
+	}
+	if res.Usage.InputTokens.Changed || res.Usage.OutputTokens != (Change[int]{5, 7, true}) {
+		t.Errorf("usage = %+v", res.Usage)
+	}
+}
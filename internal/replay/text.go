@@ -0,0 +1,72 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText writes a human-readable report of a replay.
+func WriteText(w io.Writer, r *Result) {
+	fmt.Fprintf(w, "Replayed %s", r.RequestID)
+	if r.ReplayRequestID != "" {
+		fmt.Fprintf(w, " as %s", r.ReplayRequestID)
+	}
+	fmt.Fprintln(w)
+	if r.Imported {
+		fmt.Fprintln(w, "note: imported request, replayed without its system prompt and tools")
+	}
+
+	row := func(label, original, replay string, changed bool) {
+		if changed {
+			fmt.Fprintf(w, "%-14s %s → %s\n", label, original, replay)
+		} else {
+			fmt.Fprintf(w, "%-14s %s\n", label, original)
+		}
+	}
+	ints := func(label string, c Change[int], unit string) {
+		row(label, fmt.Sprint(c.Original)+unit, fmt.Sprint(c.Replay)+unit, c.Changed)
+	}
+	row("model", r.Model.Original, r.Model.Replay, r.Model.Changed)
+	row("stop reason", r.StopReason.Original, r.StopReason.Replay, r.StopReason.Changed)
+	ints("latency", r.LatencyMs, " ms")
+	ints("input tokens", r.Usage.InputTokens, "")
+	ints("output tokens", r.Usage.OutputTokens, "")
+	ints("cache read", r.Usage.CacheReadTokens, "")
+	ints("cache write", r.Usage.CacheCreationTokens, "")
+	c := r.Usage.CostUSD
+	row("cost", fmt.Sprintf("$%.4f", c.Original), fmt.Sprintf("$%.4f", c.Replay), c.Changed)
+
+	if len(r.ToolCalls) > 0 {
+		fmt.Fprintln(w, "\ntool calls:")
+		for i, t := range r.ToolCalls {
+			switch t.Status {
+			case ToolAdded:
+				fmt.Fprintf(w, "  %d %-8s %s\n", i, t.Status, t.Replay)
+			case ToolChanged:
+				fmt.Fprintf(w, "  %d %-8s %s\n  %*s → %s\n", i, t.Status, t.Original, len(fmt.Sprint(i))+9, "", t.Replay)
+			default:
+				fmt.Fprintf(w, "  %d %-8s %s\n", i, t.Status, t.Original)
+			}
+		}
+	}
+
+	if r.Text.Changed {
+		fmt.Fprintln(w, "\ntext:")
+		for _, l := range r.Text.Diff {
+			fmt.Fprintln(w, "  "+l)
+		}
+	} else {
+		fmt.Fprintln(w, "\ntext: unchanged")
+	}
+}
+
+func (t *ToolCall) String() string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, t.Input) != nil {
+		return t.Name + " " + strings.TrimSpace(string(t.Input))
+	}
+	return t.Name + " " + buf.String()
+}
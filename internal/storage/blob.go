@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by reads for rows or blobs that do not exist.
+var ErrNotFound = errors.New("not found")
+
+// BlobStore holds payload bodies that are too large to keep inline in
+// request_payloads. Keys are content hashes, so Put is idempotent.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns ErrNotFound for unknown keys.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Keys(ctx context.Context) ([]string, error)
+}
+
+// Rotator is implemented by stores that can move encrypted data to the
+// active master key.
+type Rotator interface {
+	Rotate(ctx context.Context) (int, error)
+}
+
+var blobMarker = []byte(`"$blob"`)
+
+// Blob key prefixes: plaintext hashes of bodies stored in the clear, keyed
+// hashes of sealed ones.
+const (
+	plainBlobPrefix  = "sha256:"
+	sealedBlobPrefix = "hmac-sha256:"
+)
+
+// blobRef replaces an offloaded body in its row. It is valid JSON so it fits
+// the JSONB body columns.
+type blobRef struct {
+	Key  string `json:"$blob"`
+	Size int    `json:"size"`
+}
+
+func parseBlobRef(value []byte) (*blobRef, bool) {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, blobMarker) {
+		return nil, false
+	}
+	var ref blobRef
+	if err := json.Unmarshal(trimmed, &ref); err != nil ||
+		!strings.HasPrefix(ref.Key, plainBlobPrefix) && !strings.HasPrefix(ref.Key, sealedBlobPrefix) {
+		return nil, false
+	}
+	return &ref, true
+}
+
+// OffloadStore moves request and response bodies larger than threshold into
+// a BlobStore and keeps only a reference in the row. Reads through
+// GetPayload resolve references transparently. The key is the SHA-256 of
+// the body, so identical bodies are stored once. When a cipher is
+// configured, blobs are sealed with it and keyed by its MAC of the body
+// instead, as a plain hash would let anyone with access to the blobs
+// confirm guesses of their content.
+type OffloadStore struct {
+	Store
+	blobs     BlobStore
+	threshold int
+	cipher    Cipher
+}
+
+func NewOffloadStore(inner Store, blobs BlobStore, threshold int, cipher Cipher) *OffloadStore {
+	return &OffloadStore{Store: inner, blobs: blobs, threshold: threshold, cipher: cipher}
+}
+
+func (s *OffloadStore) UpsertPayload(ctx context.Context, p *PayloadRecord) error {
+	out := *p
+	var err error
+	if out.ReqBody, err = s.offload(ctx, p.ReqBody); err != nil {
+		return err
+	}
+	if out.RespBody, err = s.offload(ctx, p.RespBody); err != nil {
+		return err
+	}
+	return s.Store.UpsertPayload(ctx, &out)
+}
+
+func (s *OffloadStore) UpsertPayloadResponse(ctx context.Context, p *PayloadResponse) error {
+	out := *p
+	var err error
+	if out.RespBody, err = s.offload(ctx, p.RespBody); err != nil {
+		return err
+	}
+	return s.Store.UpsertPayloadResponse(ctx, &out)
+}
+
+func (s *OffloadStore) GetPayload(ctx context.Context, requestID uuid.UUID) (*PayloadRecord, error) {
+	p, err := s.Store.GetPayload(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if p.ReqBody, err = s.resolve(ctx, p.ReqBody); err != nil {
+		return nil, err
+	}
+	if p.RespBody, err = s.resolve(ctx, p.RespBody); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// BackfillSearchText derives search text from the bodies themselves, not
+// the references to offloaded ones.
+func (s *OffloadStore) BackfillSearchText(ctx context.Context, fill func(reqBody, respBody []byte) (string, string, error)) (int, error) {
+	return s.Store.BackfillSearchText(ctx, func(reqBody, respBody []byte) (string, string, error) {
+		var err error
+		if reqBody, err = s.resolve(ctx, reqBody); err != nil {
+			return "", "", err
+		}
+		if respBody, err = s.resolve(ctx, respBody); err != nil {
+			return "", "", err
+		}
+		return fill(reqBody, respBody)
+	})
+}
+
+// Rotate reseals the wrapped store's rows and every sealed blob under the
+// active master key. Blobs offloaded before encryption was enabled stay in
+// the clear: they are named by the hash of their content, which sealing
+// would not hide.
+func (s *OffloadStore) Rotate(ctx context.Context) (int, error) {
+	n := 0
+	if r, ok := s.Store.(Rotator); ok {
+		var err error
+		if n, err = r.Rotate(ctx); err != nil {
+			return n, err
+		}
+	}
+	if s.cipher == nil {
+		return n, nil
+	}
+
+	keys, err := s.blobs.Keys(ctx)
+	if err != nil {
+		return n, fmt.Errorf("list blobs: %w", err)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, sealedBlobPrefix) {
+			continue
+		}
+		data, err := s.blobs.Get(ctx, key)
+		if err != nil {
+			return n, fmt.Errorf("read blob %s: %w", key, err)
+		}
+		resealed, err := s.cipher.Reseal(data, true)
+		if err != nil {
+			return n, fmt.Errorf("reseal blob %s: %w", key, err)
+		}
+		if bytes.Equal(resealed, data) {
+			continue
+		}
+		if err := s.blobs.Put(ctx, key, resealed); err != nil {
+			return n, fmt.Errorf("write blob %s: %w", key, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (s *OffloadStore) offload(ctx context.Context, body []byte) ([]byte, error) {
+	if len(body) <= s.threshold {
+		return body, nil
+	}
+	if _, ok := parseBlobRef(body); ok {
+		return body, nil
+	}
+
+	sum := sha256.Sum256(body)
+	ref := blobRef{Key: plainBlobPrefix + hex.EncodeToString(sum[:]), Size: len(body)}
+	data := body
+	if s.cipher != nil {
+		ref.Key = sealedBlobPrefix + hex.EncodeToString(s.cipher.MAC(body))
+		var err error
+		if data, err = s.cipher.Seal(body); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.blobs.Put(ctx, ref.Key, data); err != nil {
+		return nil, fmt.Errorf("store blob %s: %w", ref.Key, err)
+	}
+	return json.Marshal(ref)
+}
+
+func (s *OffloadStore) resolve(ctx context.Context, body []byte) ([]byte, error) {
+	ref, ok := parseBlobRef(body)
+	if !ok {
+		return body, nil
+	}
+	data, err := s.blobs.Get(ctx, ref.Key)
+	if err != nil {
+		return nil, fmt.Errorf("fetch blob %s: %w", ref.Key, err)
+	}
+	if strings.HasPrefix(ref.Key, sealedBlobPrefix) {
+		if s.cipher == nil {
+			return nil, fmt.Errorf("blob %s is encrypted and no encryption keys are configured", ref.Key)
+		}
+		if data, err = s.cipher.Open(data); err != nil {
+			return nil, fmt.Errorf("decrypt blob %s: %w", ref.Key, err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,95 @@
+// Package blob provides storage.BlobStore implementations for offloaded
+// payload bodies.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// Dir stores blobs as files under a local directory, sharded by the first
+// two hex characters of the hash: <root>/sha256/ab/abcdef..., or
+// <root>/hmac-sha256/ab/abcdef... for sealed blobs.
+type Dir struct {
+	root string
+}
+
+var _ storage.BlobStore = (*Dir)(nil)
+
+func NewDir(root string) (*Dir, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, fmt.Errorf("create blob directory: %w", err)
+	}
+	return &Dir{root: root}, nil
+}
+
+func (d *Dir) Put(ctx context.Context, key string, data []byte) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Write to a temp file and rename so readers never see a partial blob.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *Dir) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, storage.ErrNotFound
+	}
+	return data, err
+}
+
+func (d *Dir) Keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(d.root, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			return err
+		}
+		rel, err := filepath.Rel(d.root, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) == 3 {
+			keys = append(keys, parts[0]+":"+parts[2])
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (d *Dir) path(key string) (string, error) {
+	algo, sum, ok := strings.Cut(key, ":")
+	if !ok || len(sum) < 2 || strings.ContainsAny(key, `/\.`) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(d.root, algo, sum[:2], sum), nil
+}
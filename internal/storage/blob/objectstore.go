@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	nats "github.com/nats-io/nats.go"
+)
+
+// ObjectStore stores blobs in a JetStream Object Store bucket, so they live
+// alongside the rest of sidekick's JetStream data.
+type ObjectStore struct {
+	obs nats.ObjectStore
+}
+
+var _ storage.BlobStore = (*ObjectStore)(nil)
+
+// NewObjectStore binds to bucket, creating it with file storage and the
+// given number of replicas if needed.
+func NewObjectStore(js nats.JetStreamContext, bucket string, replicas int) (*ObjectStore, error) {
+	obs, err := js.ObjectStore(bucket)
+	if errors.Is(err, nats.ErrStreamNotFound) || errors.Is(err, nats.ErrBucketNotFound) {
+		obs, err = js.CreateObjectStore(&nats.ObjectStoreConfig{
+			Bucket:      bucket,
+			Description: "sidekick offloaded request/response bodies",
+			Storage:     nats.FileStorage,
+			Replicas:    max(replicas, 1),
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("object store %s: %w", bucket, err)
+	}
+	return &ObjectStore{obs: obs}, nil
+}
+
+func (o *ObjectStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := o.obs.PutBytes(key, data, nats.Context(ctx))
+	return err
+}
+
+func (o *ObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := o.obs.GetBytes(key, nats.Context(ctx))
+	if errors.Is(err, nats.ErrObjectNotFound) {
+		return nil, storage.ErrNotFound
+	}
+	return data, err
+}
+
+func (o *ObjectStore) Keys(ctx context.Context) ([]string, error) {
+	infos, err := o.obs.List(nats.Context(ctx))
+	if errors.Is(err, nats.ErrNoObjectsFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(infos))
+	for i, info := range infos {
+		keys[i] = info.Name
+	}
+	return keys, nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/envelope"
+)
+
+type memBlobs map[string][]byte
+
+func (m memBlobs) Put(_ context.Context, key string, data []byte) error {
+	m[key] = data
+	return nil
+}
+
+func (m memBlobs) Get(_ context.Context, key string) ([]byte, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (m memBlobs) Keys(context.Context) ([]string, error) {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// payloadStore keeps the last payload written.
+type payloadStore struct {
+	Store
+	p *PayloadRecord
+}
+
+func (s *payloadStore) UpsertPayload(_ context.Context, p *PayloadRecord) error {
+	s.p = p
+	return nil
+}
+
+func (s *payloadStore) GetPayload(context.Context, uuid.UUID) (*PayloadRecord, error) {
+	p := *s.p
+	return &p, nil
+}
+
+func testKeyring(t *testing.T) *envelope.Keyring {
+	t.Helper()
+	key, err := envelope.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := envelope.ParseKeyring("k1:"+key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestOffloadBlobKeys(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"text":"secret"}`), 10)
+	sum := sha256.Sum256(body)
+	plainKey := plainBlobPrefix + hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name   string
+		cipher Cipher
+	}{
+		{"plaintext", nil},
+		{"sealed", testKeyring(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs := memBlobs{}
+			s := NewOffloadStore(&payloadStore{}, blobs, 16, tt.cipher)
+			if err := s.UpsertPayload(context.Background(), &PayloadRecord{ReqBody: body}); err != nil {
+				t.Fatal(err)
+			}
+			if len(blobs) != 1 {
+				t.Fatalf("%d blobs stored; want 1", len(blobs))
+			}
+			for key, data := range blobs {
+				if tt.cipher == nil {
+					if key != plainKey || !bytes.Equal(data, body) {
+						t.Errorf("blob %s = %q", key, data)
+					}
+					continue
+				}
+				if !strings.HasPrefix(key, sealedBlobPrefix) || strings.Contains(key, plainKey[len(plainBlobPrefix):]) {
+					t.Errorf("sealed blob key %s", key)
+				}
+				if bytes.Contains(data, []byte("secret")) {
+					t.Error("blob stored in the clear")
+				}
+			}
+
+			p, err := s.GetPayload(context.Background(), uuid.Nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(p.ReqBody, body) {
+				t.Errorf("resolved body = %q", p.ReqBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeadLetter is a write job that could not be applied, kept for inspection
+// and replay.
+type DeadLetter struct {
+	ID         int64           `json:"id,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Kind       string          `json:"kind"`
+	Payload    json.RawMessage `json:"payload"`
+	Error      string          `json:"error"`
+	Attempts   int             `json:"attempts"`
+	ReplayedAt *time.Time      `json:"replayed_at,omitempty"`
+	KeyID      string          `json:"-"`
+}
+
+// DeadLetterStore persists failed write jobs in the store's dead-letter table.
+// When the store itself is unreachable, entries are appended to a local
+// JSONL spool file instead and can be loaded back with ImportSpool.
+//
+// When a cipher is given, payloads in the spool file are sealed with it.
+type DeadLetterStore struct {
+	store     Store
+	spoolPath string
+	cipher    Cipher
+	mu        sync.Mutex
+}
+
+func NewDeadLetterStore(store Store, spoolPath string, cipher Cipher) *DeadLetterStore {
+	return &DeadLetterStore{store: store, spoolPath: spoolPath, cipher: cipher}
+}
+
+// Put records a failed job, falling back to the spool file. A non-nil error
+// means the job is lost.
+func (s *DeadLetterStore) Put(job WriteJob, jobErr error, attempts int) error {
+	dl, err := newDeadLetter(job, jobErr, attempts)
+	if err != nil {
+		log.Error().Err(err).Str("kind", job.Kind()).Msg("failed to serialize dead letter, job lost")
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.store.InsertDeadLetters(ctx, []DeadLetter{*dl}); err != nil {
+		log.Warn().Err(err).Str("kind", job.Kind()).Msg("failed to store dead letter, spooling to file")
+		return s.appendSpool(dl)
+	}
+	return nil
+}
+
+// Spool records a failed job directly in the spool file without touching
+// the database. A non-nil error means the job is lost.
+func (s *DeadLetterStore) Spool(job WriteJob, jobErr error, attempts int) error {
+	dl, err := newDeadLetter(job, jobErr, attempts)
+	if err != nil {
+		log.Error().Err(err).Str("kind", job.Kind()).Msg("failed to serialize dead letter, job lost")
+		return err
+	}
+	return s.appendSpool(dl)
+}
+
+func newDeadLetter(job WriteJob, jobErr error, attempts int) (*DeadLetter, error) {
+	payload, err := job.Payload()
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetter{
+		CreatedAt: time.Now(),
+		Kind:      job.Kind(),
+		Payload:   payload,
+		Error:     jobErr.Error(),
+		Attempts:  attempts,
+	}, nil
+}
+
+var errNoSpool = errors.New("no dead-letter spool configured")
+
+func (s *DeadLetterStore) appendSpool(dl *DeadLetter) error {
+	entry := *dl
+	if s.cipher != nil {
+		payload, err := s.cipher.Seal(dl.Payload)
+		if err != nil {
+			log.Error().Err(err).Str("kind", dl.Kind).Msg("failed to encrypt dead letter, job lost")
+			return err
+		}
+		entry.Payload = payload
+	}
+
+	if s.spoolPath == "" {
+		log.Error().Str("kind", entry.Kind).RawJSON("payload", entry.Payload).Msg("no dead-letter spool configured, job lost")
+		return errNoSpool
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Error().Err(err).Str("kind", entry.Kind).Msg("failed to encode dead letter, job lost")
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.spoolPath), 0o755); err != nil {
+		log.Error().Err(err).RawJSON("payload", entry.Payload).Msg("failed to create dead-letter spool directory, job lost")
+		return err
+	}
+	f, err := os.OpenFile(s.spoolPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Error().Err(err).RawJSON("payload", entry.Payload).Msg("failed to open dead-letter spool, job lost")
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Error().Err(err).RawJSON("payload", entry.Payload).Msg("failed to write dead-letter spool, job lost")
+		return err
+	}
+	return nil
+}
+
+// List returns dead letters in insertion order. Replayed entries are only
+// included when all is set.
+func (s *DeadLetterStore) List(ctx context.Context, all bool, limit int) ([]DeadLetter, error) {
+	return s.store.ListDeadLetters(ctx, all, limit)
+}
+
+// Replay re-executes a dead-lettered job and marks it replayed on success.
+// On failure the stored error and attempt count are updated.
+func (s *DeadLetterStore) Replay(ctx context.Context, id int64) error {
+	dl, err := s.store.GetDeadLetter(ctx, id)
+	if err != nil {
+		return fmt.Errorf("load dead letter %d: %w", id, err)
+	}
+
+	job, err := DecodeJob(dl.Kind, dl.Payload)
+	if err != nil {
+		return err
+	}
+
+	if execErr := job.Execute(ctx, s.store); execErr != nil {
+		if err := s.store.RecordDeadLetterFailure(ctx, id, execErr.Error()); err != nil {
+			log.Warn().Err(err).Int64("id", id).Msg("failed to record replay error")
+		}
+		return execErr
+	}
+
+	return s.store.MarkDeadLetterReplayed(ctx, id)
+}
+
+// ImportSpool moves every entry of the spool file into the store and
+// truncates the file. Returns the number of entries imported.
+func (s *DeadLetterStore) ImportSpool(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.spoolPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var entries []DeadLetter
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+	for scanner.Scan() {
+		var dl DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &dl); err != nil {
+			return 0, fmt.Errorf("parse spool line %d: %w", len(entries)+1, err)
+		}
+		if s.cipher != nil {
+			payload, err := s.cipher.Open(dl.Payload)
+			if err != nil {
+				return 0, fmt.Errorf("decrypt spool line %d: %w", len(entries)+1, err)
+			}
+			dl.Payload = payload
+		}
+		entries = append(entries, dl)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := s.store.InsertDeadLetters(ctx, entries); err != nil {
+		return 0, err
+	}
+
+	return len(entries), os.Truncate(s.spoolPath, 0)
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/stream"
+)
+
+// Cipher encrypts values at rest. envelope.Keyring is the implementation.
+type Cipher interface {
+	// KeyID identifies the master key new values are sealed with.
+	KeyID() string
+	Seal(plaintext []byte) ([]byte, error)
+	// Open decrypts a sealed value and returns plaintext values unchanged.
+	Open(value []byte) ([]byte, error)
+	// Reseal re-wraps a sealed value under the active key, or seals
+	// plaintext; sealed says which value is.
+	Reseal(value []byte, sealed bool) ([]byte, error)
+	// MAC returns a keyed hash of value under the active key.
+	MAC(value []byte) []byte
+}
+
+// ErrSearchUnavailable is returned for full-text queries while content is
+// encrypted at rest.
+var ErrSearchUnavailable = errors.New("search is unavailable: prompts and responses are encrypted at rest")
+
+// EncryptedStore seals prompt and response content and account secrets
+// before they reach the underlying store and opens them again on the way
+// out. Request metadata and
+// analytics columns stay in plaintext so they remain queryable. Content is
+// not indexed for full-text search, as the index would expose it, so text
+// queries fail with ErrSearchUnavailable rather than match nothing.
+type EncryptedStore struct {
+	Store
+	cipher Cipher
+}
+
+func NewEncryptedStore(inner Store, cipher Cipher) *EncryptedStore {
+	return &EncryptedStore{Store: inner, cipher: cipher}
+}
+
+func (s *EncryptedStore) ListRequests(ctx context.Context, f *RequestFilter) ([]Request, error) {
+	if f.Text != "" {
+		return nil, ErrSearchUnavailable
+	}
+	return s.Store.ListRequests(ctx, f)
+}
+
+func (s *EncryptedStore) UsageOverTime(ctx context.Context, f *RequestFilter, bucket time.Duration) ([]UsageBucket, error) {
+	if f.Text != "" {
+		return nil, ErrSearchUnavailable
+	}
+	return s.Store.UsageOverTime(ctx, f, bucket)
+}
+
+func (s *EncryptedStore) UsageBy(ctx context.Context, f *RequestFilter, dimension string) ([]UsageGroup, error) {
+	if f.Text != "" {
+		return nil, ErrSearchUnavailable
+	}
+	return s.Store.UsageBy(ctx, f, dimension)
+}
+
+// BackfillSearchText fails: search text is never stored for encrypted
+// content.
+func (s *EncryptedStore) BackfillSearchText(context.Context, func(reqBody, respBody []byte) (string, string, error)) (int, error) {
+	return 0, ErrSearchUnavailable
+}
+
+func (s *EncryptedStore) UpsertPayload(ctx context.Context, p *PayloadRecord) error {
+	sealed := *p
+	var err error
+	if sealed.ReqBody, err = s.sealBytes(p.ReqBody); err != nil {
+		return err
+	}
+	if sealed.RespBody, err = s.sealBytes(p.RespBody); err != nil {
+		return err
+	}
+	if sealed.Extras.SystemPrompt, err = s.sealString(p.Extras.SystemPrompt); err != nil {
+		return err
+	}
+	sealed.Extras.UserText, sealed.Extras.ResponseText = "", ""
+	sealed.KeyID = s.cipher.KeyID()
+	return s.Store.UpsertPayload(ctx, &sealed)
+}
+
+func (s *EncryptedStore) UpsertPayloadResponse(ctx context.Context, p *PayloadResponse) error {
+	sealed := *p
+	var err error
+	if sealed.RespBody, err = s.sealBytes(p.RespBody); err != nil {
+		return err
+	}
+	sealed.ResponseText = ""
+	sealed.KeyID = s.cipher.KeyID()
+	return s.Store.UpsertPayloadResponse(ctx, &sealed)
+}
+
+func (s *EncryptedStore) GetPayload(ctx context.Context, requestID uuid.UUID) (*PayloadRecord, error) {
+	p, err := s.Store.GetPayload(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if p.ReqBody, err = s.cipher.Open(p.ReqBody); err != nil {
+		return nil, fmt.Errorf("decrypt request body %s: %w", requestID, err)
+	}
+	if p.RespBody, err = s.cipher.Open(p.RespBody); err != nil {
+		return nil, fmt.Errorf("decrypt response body %s: %w", requestID, err)
+	}
+	if p.Extras.SystemPrompt != "" {
+		prompt, err := s.cipher.Open([]byte(p.Extras.SystemPrompt))
+		if err != nil {
+			return nil, fmt.Errorf("decrypt system prompt %s: %w", requestID, err)
+		}
+		p.Extras.SystemPrompt = string(prompt)
+	}
+	return p, nil
+}
+
+func (s *EncryptedStore) ReplaceSSEEvents(ctx context.Context, b *SSEEventBatch) error {
+	sealed := *b
+	sealed.Events = make([]stream.SSEEvent, len(b.Events))
+	for i, ev := range b.Events {
+		data, err := s.sealString(ev.RawData)
+		if err != nil {
+			return err
+		}
+		ev.RawData = data
+		sealed.Events[i] = ev
+	}
+	sealed.KeyID = s.cipher.KeyID()
+	return s.Store.ReplaceSSEEvents(ctx, &sealed)
+}
+
+func (s *EncryptedStore) ListSSEEvents(ctx context.Context, requestID uuid.UUID) ([]stream.SSEEvent, error) {
+	evs, err := s.Store.ListSSEEvents(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range evs {
+		if evs[i].RawData == "" {
+			continue
+		}
+		data, err := s.cipher.Open([]byte(evs[i].RawData))
+		if err != nil {
+			return nil, fmt.Errorf("decrypt SSE event %s/%d: %w", requestID, evs[i].Index, err)
+		}
+		evs[i].RawData = string(data)
+	}
+	return evs, nil
+}
+
+func (s *EncryptedStore) InsertDeadLetters(ctx context.Context, dls []DeadLetter) error {
+	sealed := make([]DeadLetter, len(dls))
+	for i, dl := range dls {
+		payload, err := s.cipher.Seal(dl.Payload)
+		if err != nil {
+			return err
+		}
+		dl.Payload = payload
+		dl.KeyID = s.cipher.KeyID()
+		sealed[i] = dl
+	}
+	return s.Store.InsertDeadLetters(ctx, sealed)
+}
+
+func (s *EncryptedStore) ListDeadLetters(ctx context.Context, all bool, limit int) ([]DeadLetter, error) {
+	dls, err := s.Store.ListDeadLetters(ctx, all, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range dls {
+		if dls[i].Payload, err = s.cipher.Open(dls[i].Payload); err != nil {
+			return nil, fmt.Errorf("decrypt dead letter %d: %w", dls[i].ID, err)
+		}
+	}
+	return dls, nil
+}
+
+func (s *EncryptedStore) GetDeadLetter(ctx context.Context, id int64) (*DeadLetter, error) {
+	dl, err := s.Store.GetDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if dl.Payload, err = s.cipher.Open(dl.Payload); err != nil {
+		return nil, fmt.Errorf("decrypt dead letter %d: %w", id, err)
+	}
+	return dl, nil
+}
+
+func (s *EncryptedStore) UpsertAccount(ctx context.Context, a *Account) error {
+	sealed := *a
+	var err error
+	for _, secret := range []*string{&sealed.APIKey, &sealed.RefreshToken, &sealed.AccessToken} {
+		if *secret, err = s.sealString(*secret); err != nil {
+			return err
+		}
+	}
+	sealed.KeyID = s.cipher.KeyID()
+	if err := s.Store.UpsertAccount(ctx, &sealed); err != nil {
+		return err
+	}
+	a.ID, a.CreatedAt = sealed.ID, sealed.CreatedAt
+	return nil
+}
+
+func (s *EncryptedStore) GetAccount(ctx context.Context, name string) (*Account, error) {
+	a, err := s.Store.GetAccount(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.openAccount(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *EncryptedStore) ListAccounts(ctx context.Context) ([]Account, error) {
+	accounts, err := s.Store.ListAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		if err := s.openAccount(&accounts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return accounts, nil
+}
+
+func (s *EncryptedStore) openAccount(a *Account) error {
+	for _, secret := range []*string{&a.APIKey, &a.RefreshToken, &a.AccessToken} {
+		if *secret == "" {
+			continue
+		}
+		v, err := s.cipher.Open([]byte(*secret))
+		if err != nil {
+			return fmt.Errorf("decrypt account %s: %w", a.Name, err)
+		}
+		*secret = string(v)
+	}
+	return nil
+}
+
+// Rotate re-wraps every data key not under the active master key and seals
+// any plaintext left from before encryption was enabled.
+func (s *EncryptedStore) Rotate(ctx context.Context) (int, error) {
+	return s.Store.ResealRows(ctx, s.cipher.KeyID(), s.cipher.Reseal)
+}
+
+func (s *EncryptedStore) sealBytes(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return b, nil
+	}
+	return s.cipher.Seal(b)
+}
+
+// sealString seals a text value. The envelope is itself JSON, so sealed
+// strings stay valid in JSON columns.
+func (s *EncryptedStore) sealString(v string) (string, error) {
+	if v == "" {
+		return v, nil
+	}
+	sealed, err := s.cipher.Seal([]byte(v))
+	return string(sealed), err
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// listStore lists no requests.
+type listStore struct {
+	Store
+}
+
+func (listStore) ListRequests(context.Context, *RequestFilter) ([]Request, error) {
+	return nil, nil
+}
+
+func (listStore) UsageBy(context.Context, *RequestFilter, string) ([]UsageGroup, error) {
+	return nil, nil
+}
+
+func (listStore) UsageOverTime(context.Context, *RequestFilter, time.Duration) ([]UsageBucket, error) {
+	return nil, nil
+}
+
+func TestEncryptedStoreRejectsSearch(t *testing.T) {
+	ctx := context.Background()
+	s := NewEncryptedStore(listStore{}, testKeyring(t))
+
+	if _, err := s.ListRequests(ctx, &RequestFilter{Model: "m"}); err != nil {
+		t.Errorf("listing without a query: %v", err)
+	}
+	search := &RequestFilter{Text: "hello"}
+	if _, err := s.ListRequests(ctx, search); !errors.Is(err, ErrSearchUnavailable) {
+		t.Errorf("ListRequests err = %v; want ErrSearchUnavailable", err)
+	}
+	if _, err := s.UsageBy(ctx, search, "model"); !errors.Is(err, ErrSearchUnavailable) {
+		t.Errorf("UsageBy err = %v; want ErrSearchUnavailable", err)
+	}
+	if _, err := s.UsageOverTime(ctx, search, time.Hour); !errors.Is(err, ErrSearchUnavailable) {
+		t.Errorf("UsageOverTime err = %v; want ErrSearchUnavailable", err)
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Request outcomes for RequestFilter.Outcome.
+const (
+	OutcomeSuccess    = "success"
+	OutcomeError      = "error"
+	OutcomeIncomplete = "incomplete"
+)
+
+// RequestFilter selects requests for ListRequests; zero fields match
+// everything. Results are ordered newest first unless Ascending is set.
+type RequestFilter struct {
+	From, To     time.Time // From inclusive, To exclusive
+	Model        string
+	StatusCode   int
+	Outcome      string
+	Key          string // key fingerprint
+	Conversation string
+	Agent        string
+	StopReason   string
+	// Text is a full-text query over system prompts, user messages and
+	// responses in web search syntax: words, "quoted phrases", or and -word.
+	Text string
+	// After continues a listing after the last request of the previous page.
+	After *RequestCursor
+	Limit int
+	// Ascending lists oldest first.
+	Ascending bool
+}
+
+// RequestCursor is a position in the (ts, id) order of requests.
+type RequestCursor struct {
+	TS time.Time `json:"ts"`
+	ID uuid.UUID `json:"id"`
+}
+
+// Request is a stored request row as returned by the read path.
+type Request struct {
+	ID                   uuid.UUID `json:"id"`
+	Timestamp            time.Time `json:"timestamp"`
+	Method               string    `json:"method,omitempty"`
+	Path                 string    `json:"path,omitempty"`
+	StatusCode           int       `json:"status_code,omitempty"`
+	Success              bool      `json:"success"`
+	Incomplete           bool      `json:"incomplete"`
+	ErrorMessage         string    `json:"error_message,omitempty"`
+	ResponseTimeMs       int       `json:"response_time_ms"`
+	Model                string    `json:"model,omitempty"`
+	IsStream             bool      `json:"stream"`
+	InputTokens          int       `json:"input_tokens"`
+	OutputTokens         int       `json:"output_tokens"`
+	CacheReadTokens      int       `json:"cache_read_tokens"`
+	CacheCreationTokens  int       `json:"cache_creation_tokens"`
+	TotalTokens          int       `json:"total_tokens"`
+	CostUSD              float64   `json:"cost_usd"`
+	TokensPerSecond      float32   `json:"tokens_per_second,omitempty"`
+	StopReason           string    `json:"stop_reason,omitempty"`
+	MessageID            string    `json:"message_id,omitempty"`
+	Agent                string    `json:"agent,omitempty"`
+	KeyFingerprint       string    `json:"key_fingerprint,omitempty"`
+	ConversationID       string    `json:"conversation_id,omitempty"`
+	ToolCount            int       `json:"tool_count,omitempty"`
+	ThinkingBudgetTokens int       `json:"thinking_budget_tokens,omitempty"`
+	Imported             bool      `json:"imported,omitempty"`
+	CacheHit             bool      `json:"cache_hit,omitempty"`
+}
+
+// UsageTotals aggregates a set of requests.
+type UsageTotals struct {
+	Requests            int     `json:"requests"`
+	Errors              int     `json:"errors"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CostUSD             float64 `json:"cost_usd"`
+}
+
+// UsageBucket is the usage of requests in [Start, Start+bucket).
+type UsageBucket struct {
+	Start time.Time `json:"start"`
+	UsageTotals
+}
+
+// UsageGroup is the usage of requests sharing one value of a dimension.
+type UsageGroup struct {
+	Key string `json:"key"`
+	UsageTotals
+}
+
+// Dimensions UsageBy can group requests by.
+var UsageDimensions = []string{"model", "agent", "status", "key", "conversation", "stop_reason"}
+
+// Highlight markers delimit matched terms in Highlight snippets. They are
+// private-use characters, so they cannot clash with stored text.
+const (
+	HighlightStart = "\ue000"
+	HighlightEnd   = "\ue001"
+)
+
+// Fields of a request searched by RequestFilter.Text.
+const (
+	FieldSystem   = "system"
+	FieldUser     = "user"
+	FieldResponse = "response"
+)
+
+// Highlight is an excerpt of a searched field around the terms matching a
+// full-text query.
+type Highlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+// MatchingHighlights drops snippets without a highlighted term: excerpts a
+// backend returns for fields that did not match.
+func MatchingHighlights(hs ...Highlight) []Highlight {
+	out := hs[:0]
+	for _, h := range hs {
+		if strings.Contains(h.Snippet, HighlightStart) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
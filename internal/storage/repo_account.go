@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account is an upstream account and its credentials. APIKey, RefreshToken
+// and AccessToken are sealed at rest when encryption is enabled.
+type Account struct {
+	ID           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	Provider     string     `json:"provider"`
+	APIKey       string     `json:"api_key,omitempty"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	AccessToken  string     `json:"access_token,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	KeyID        string     `json:"-"`
+}
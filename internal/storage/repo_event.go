@@ -5,31 +5,22 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/namikmesic/claude-sidekick/internal/stream"
 )
 
-// InsertSSEEventsJob creates a batch insert job for SSE events using COPY protocol.
-func InsertSSEEventsJob(requestID uuid.UUID, ts time.Time, events []stream.SSEEvent) WriteJob {
-	return WriteJobFunc(func(ctx context.Context, pool *pgxpool.Pool) error {
-		rows := make([][]interface{}, len(events))
-		for i, ev := range events {
-			rows[i] = []interface{}{
-				ts,
-				requestID,
-				ev.Index,
-				ev.EventType,
-				ev.RawData,
-				ev.RawBytes,
-			}
-		}
+// SSEEventBatch is every SSE event of one streamed request.
+type SSEEventBatch struct {
+	RequestID uuid.UUID
+	TS        time.Time
+	Events    []stream.SSEEvent
+	KeyID     string `json:"-"`
+}
 
-		_, err := pool.CopyFrom(ctx,
-			pgx.Identifier{"sse_events"},
-			[]string{"ts", "request_id", "event_index", "event_type", "data_json", "raw_bytes"},
-			pgx.CopyFromRows(rows),
-		)
-		return err
-	})
+var insertSSEEvents = registerJob("insert_sse_events", func(ctx context.Context, store Store, b SSEEventBatch) error {
+	return store.ReplaceSSEEvents(ctx, &b)
+})
+
+// InsertSSEEventsJob creates a job that replaces a request's SSE events.
+func InsertSSEEventsJob(requestID uuid.UUID, ts time.Time, events []stream.SSEEvent) WriteJob {
+	return insertSSEEvents(SSEEventBatch{RequestID: requestID, TS: ts, Events: events})
 }
@@ -2,11 +2,9 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type RequestRecord struct {
@@ -30,55 +28,81 @@ type RequestRecord struct {
 	TokensPerSecond      float32
 	IsStream             bool
 	AgentUsed            string
+	KeyFingerprint       string
+	ConversationID       string
 	ToolCount            int
 	ThinkingBudgetTokens int
+	// Imported marks a request loaded from a client's local history rather
+	// than proxied.
+	Imported bool
+	// RequestHash identifies the request's normalized body for playback
+	// (see package vcr).
+	RequestHash string
+	// CacheHit marks a request answered from the response cache.
+	CacheHit bool
 }
 
+var insertRequest = registerJob("insert_request", func(ctx context.Context, store Store, r RequestRecord) error {
+	return store.UpsertRequest(ctx, &r)
+})
+
 func InsertRequestJob(r *RequestRecord) WriteJob {
-	return WriteJobFunc(func(ctx context.Context, pool *pgxpool.Pool) error {
-		_, err := pool.Exec(ctx, `
-			INSERT INTO requests (
-				id, ts, method, path, account_id, status_code, success, error_message,
-				response_time_ms, failover_attempts, model, input_tokens, output_tokens,
-				cache_read_tokens, cache_creation_tokens, total_tokens, cost_usd,
-				tokens_per_second, is_stream, agent_used, tool_count, thinking_budget_tokens
-			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22)`,
-			r.ID, r.Timestamp, r.Method, r.Path, r.AccountID,
-			r.StatusCode, r.Success, nilIfEmpty(r.ErrorMessage),
-			r.ResponseTimeMs, r.FailoverAttempts, nilIfEmpty(r.Model),
-			r.InputTokens, r.OutputTokens, r.CacheReadTokens, r.CacheCreationTokens,
-			r.TotalTokens, r.CostUSD, r.TokensPerSecond, r.IsStream, nilIfEmpty(r.AgentUsed),
-			nilIfZero(r.ToolCount), nilIfZero(r.ThinkingBudgetTokens),
-		)
-		return err
-	})
+	return insertRequest(*r)
 }
 
+// RequestUsage is the analytics half of a request row, filled in once the
+// response has been processed.
+type RequestUsage struct {
+	RequestID     uuid.UUID
+	TS            time.Time
+	Model         string
+	InputTokens   int
+	OutputTokens  int
+	CacheRead     int
+	CacheCreation int
+	TotalTokens   int
+	CostUSD       float64
+	TokensPerSec  float32
+	StopReason    string
+	MessageID     string
+}
+
+var updateRequestUsage = registerJob("update_request_usage", func(ctx context.Context, store Store, u RequestUsage) error {
+	return store.UpsertRequestUsage(ctx, &u)
+})
+
 func UpdateRequestUsageJob(requestID uuid.UUID, ts time.Time, model string, inputTokens, outputTokens, cacheRead, cacheCreation, totalTokens int, costUSD float64, tokensPerSec float32, stopReason, messageID string) WriteJob {
-	return WriteJobFunc(func(ctx context.Context, pool *pgxpool.Pool) error {
-		_, err := pool.Exec(ctx, `
-			UPDATE requests SET
-				model = COALESCE($1, model),
-				input_tokens = $2,
-				output_tokens = $3,
-				cache_read_tokens = $4,
-				cache_creation_tokens = $5,
-				total_tokens = $6,
-				cost_usd = $7,
-				tokens_per_second = $8,
-				stop_reason = COALESCE($9, stop_reason),
-				message_id = COALESCE($10, message_id),
-				success = TRUE
-			WHERE id = $11 AND ts = $12`,
-			nilIfEmpty(model), inputTokens, outputTokens, cacheRead, cacheCreation,
-			totalTokens, costUSD, tokensPerSec,
-			nilIfEmpty(stopReason), nilIfEmpty(messageID),
-			requestID, ts,
-		)
-		return err
+	return updateRequestUsage(RequestUsage{
+		RequestID:     requestID,
+		TS:            ts,
+		Model:         model,
+		InputTokens:   inputTokens,
+		OutputTokens:  outputTokens,
+		CacheRead:     cacheRead,
+		CacheCreation: cacheCreation,
+		TotalTokens:   totalTokens,
+		CostUSD:       costUSD,
+		TokensPerSec:  tokensPerSec,
+		StopReason:    stopReason,
+		MessageID:     messageID,
 	})
 }
 
+// RequestIncomplete flags a streamed request whose response never finished.
+type RequestIncomplete struct {
+	RequestID uuid.UUID
+	TS        time.Time
+	Reason    string
+}
+
+var markRequestIncomplete = registerJob("mark_request_incomplete", func(ctx context.Context, store Store, r RequestIncomplete) error {
+	return store.MarkRequestIncomplete(ctx, &r)
+})
+
+func MarkRequestIncompleteJob(requestID uuid.UUID, ts time.Time, reason string) WriteJob {
+	return markRequestIncomplete(RequestIncomplete{RequestID: requestID, TS: ts, Reason: reason})
+}
+
 type PayloadExtras struct {
 	SystemPrompt string
 	MaxTokens    int
@@ -86,56 +110,61 @@ type PayloadExtras struct {
 	TopP         *float64
 	MessageCount int
 	StopSequence *string
+	// Search text: the new user turn and the response's text, thinking and
+	// tool calls.
+	UserText     string
+	ResponseText string
 }
 
-func InsertPayloadJob(requestID uuid.UUID, ts time.Time, reqHeaders, respHeaders map[string][]string, reqBody, respBody []byte, extras PayloadExtras) WriteJob {
-	return WriteJobFunc(func(ctx context.Context, pool *pgxpool.Pool) error {
-		reqH, _ := json.Marshal(reqHeaders)
-		respH, _ := json.Marshal(respHeaders)
-		_, err := pool.Exec(ctx, `
-			INSERT INTO request_payloads (
-				request_id, ts, request_headers, request_body, response_headers, response_body,
-				system_prompt, max_tokens, temperature, top_p, message_count, stop_sequence
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
-			requestID, ts, reqH, rawJSON(reqBody), respH, rawJSON(respBody),
-			nilIfEmpty(extras.SystemPrompt), nilIfZero(extras.MaxTokens),
-			extras.Temperature, extras.TopP,
-			nilIfZero(extras.MessageCount), extras.StopSequence,
-		)
-		return err
-	})
+// PayloadRecord holds the full request/response bodies of a request.
+type PayloadRecord struct {
+	RequestID   uuid.UUID
+	TS          time.Time
+	ReqHeaders  map[string][]string
+	RespHeaders map[string][]string
+	ReqBody     []byte
+	RespBody    []byte
+	Extras      PayloadExtras
+	KeyID       string `json:"-"` // master key sealing the bodies, set by EncryptedStore
 }
 
-func nilIfEmpty(s string) *string {
-	if s == "" {
-		return nil
-	}
-	return &s
-}
+var insertPayload = registerJob("insert_payload", func(ctx context.Context, store Store, p PayloadRecord) error {
+	return store.UpsertPayload(ctx, &p)
+})
 
-func nilIfZero(i int) *int {
-	if i == 0 {
-		return nil
-	}
-	return &i
+func InsertPayloadJob(requestID uuid.UUID, ts time.Time, reqHeaders, respHeaders map[string][]string, reqBody, respBody []byte, extras PayloadExtras) WriteJob {
+	return insertPayload(PayloadRecord{
+		RequestID:   requestID,
+		TS:          ts,
+		ReqHeaders:  reqHeaders,
+		RespHeaders: respHeaders,
+		ReqBody:     reqBody,
+		RespBody:    respBody,
+		Extras:      extras,
+	})
 }
 
-func rawJSON(b []byte) interface{} {
-	if len(b) == 0 {
-		return nil
-	}
-	return json.RawMessage(b)
+// PayloadResponse is a response body reconstructed after the fact, for
+// streamed requests.
+type PayloadResponse struct {
+	RequestID    uuid.UUID
+	TS           time.Time
+	RespBody     []byte
+	StopSequence *string
+	ResponseText string
+	KeyID        string `json:"-"`
 }
 
-func UpdatePayloadResponseJob(requestID uuid.UUID, ts time.Time, respBody []byte, stopSequence *string) WriteJob {
-	return WriteJobFunc(func(ctx context.Context, pool *pgxpool.Pool) error {
-		_, err := pool.Exec(ctx, `
-			UPDATE request_payloads
-			SET response_body = $1,
-			    stop_sequence = COALESCE($2, stop_sequence)
-			WHERE request_id = $3 AND ts = $4`,
-			rawJSON(respBody), stopSequence, requestID, ts,
-		)
-		return err
+var updatePayloadResponse = registerJob("update_payload_response", func(ctx context.Context, store Store, p PayloadResponse) error {
+	return store.UpsertPayloadResponse(ctx, &p)
+})
+
+func UpdatePayloadResponseJob(requestID uuid.UUID, ts time.Time, respBody []byte, stopSequence *string, responseText string) WriteJob {
+	return updatePayloadResponse(PayloadResponse{
+		RequestID:    requestID,
+		TS:           ts,
+		RespBody:     respBody,
+		StopSequence: stopSequence,
+		ResponseText: responseText,
 	})
 }
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Webhook delivery outcomes.
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryRetrying  = "retrying"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one attempt to deliver an event to a webhook endpoint.
+type WebhookDelivery struct {
+	ID         int64     `json:"id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Endpoint   string    `json:"endpoint"`
+	EventID    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	Attempt    int       `json:"attempt"`
+	Outcome    string    `json:"outcome"`
+	StatusCode int       `json:"status_code,omitempty"` // 0 when no response arrived
+	Error      string    `json:"error,omitempty"`
+	DurationMs int       `json:"duration_ms"`
+}
+
+var insertWebhookDelivery = registerJob("insert_webhook_delivery", func(ctx context.Context, store Store, d WebhookDelivery) error {
+	return store.InsertWebhookDelivery(ctx, &d)
+})
+
+func InsertWebhookDeliveryJob(d *WebhookDelivery) WriteJob {
+	return insertWebhookDelivery(*d)
+}
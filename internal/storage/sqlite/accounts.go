@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func (s *Store) UpsertAccount(ctx context.Context, a *storage.Account) error {
+	id := a.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	var expiresAt *int64
+	if a.ExpiresAt != nil {
+		us := micros(*a.ExpiresAt)
+		expiresAt = &us
+	}
+	var storedID string
+	var createdAt int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO accounts (id, name, provider, api_key, refresh_token, access_token, expires_at, key_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			provider      = excluded.provider,
+			api_key       = excluded.api_key,
+			refresh_token = excluded.refresh_token,
+			access_token  = excluded.access_token,
+			expires_at    = excluded.expires_at,
+			key_id        = excluded.key_id
+		RETURNING id, created_at`,
+		id.String(), a.Name, a.Provider,
+		nilIfEmpty(a.APIKey), nilIfEmpty(a.RefreshToken), nilIfEmpty(a.AccessToken),
+		expiresAt, nilIfEmpty(a.KeyID),
+	).Scan(&storedID, &createdAt)
+	if err != nil {
+		return err
+	}
+	if a.ID, err = uuid.Parse(storedID); err != nil {
+		return err
+	}
+	a.CreatedAt = fromMicros(createdAt)
+	return nil
+}
+
+const selectAccount = `
+	SELECT id, name, provider, api_key, refresh_token, access_token, expires_at, created_at, key_id
+	FROM accounts`
+
+func (s *Store) GetAccount(ctx context.Context, name string) (*storage.Account, error) {
+	a, err := scanAccount(s.db.QueryRowContext(ctx, selectAccount+` WHERE name = ?`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	return a, err
+}
+
+func (s *Store) ListAccounts(ctx context.Context) ([]storage.Account, error) {
+	rows, err := s.db.QueryContext(ctx, selectAccount+` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.Account
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *a)
+	}
+	return out, rows.Err()
+}
+
+func scanAccount(row interface{ Scan(...any) error }) (*storage.Account, error) {
+	var a storage.Account
+	var id string
+	var apiKey, refreshToken, accessToken, keyID sql.NullString
+	var expiresAt sql.NullInt64
+	var createdAt int64
+	if err := row.Scan(&id, &a.Name, &a.Provider, &apiKey, &refreshToken, &accessToken, &expiresAt, &createdAt, &keyID); err != nil {
+		return nil, err
+	}
+	var err error
+	if a.ID, err = uuid.Parse(id); err != nil {
+		return nil, err
+	}
+	a.APIKey, a.RefreshToken, a.AccessToken = apiKey.String, refreshToken.String, accessToken.String
+	if expiresAt.Valid {
+		t := fromMicros(expiresAt.Int64)
+		a.ExpiresAt = &t
+	}
+	a.CreatedAt = fromMicros(createdAt)
+	a.KeyID = keyID.String
+	return &a, nil
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/envelope"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func TestAccountsSealedAtRest(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+	var keys []string
+	for _, id := range []string{"a", "b"} {
+		key, err := envelope.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, id+":"+key)
+	}
+	keyring := func(spec []string, active string) *envelope.Keyring {
+		k, err := envelope.ParseKeyring(strings.Join(spec, ","), active)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	underA := storage.NewEncryptedStore(s, keyring(keys, "a"))
+
+	expires := time.UnixMicro(time.Now().Add(time.Hour).UnixMicro())
+	a := &storage.Account{Name: "team", Provider: "anthropic", APIKey: "sk-ant-secret", RefreshToken: "refresh", ExpiresAt: &expires}
+	if err := underA.UpsertAccount(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	var apiKey, keyID string
+	s.db.QueryRow(`SELECT api_key, key_id FROM accounts WHERE name = 'team'`).Scan(&apiKey, &keyID)
+	if strings.Contains(apiKey, "sk-ant-secret") || keyID != "a" {
+		t.Errorf("stored api_key %q under key %q; want it sealed under a", apiKey, keyID)
+	}
+
+	got, err := underA.GetAccount(ctx, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != a.ID || got.APIKey != "sk-ant-secret" || got.RefreshToken != "refresh" || got.AccessToken != "" || !got.ExpiresAt.Equal(expires) {
+		t.Errorf("account = %+v", got)
+	}
+
+	// Updating keeps the account's identity.
+	if err := underA.UpsertAccount(ctx, &storage.Account{Name: "team", Provider: "anthropic", AccessToken: "access"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.NewEncryptedStore(s, keyring(keys, "b")).Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	list, err := storage.NewEncryptedStore(s, keyring(keys[1:], "")).ListAccounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != a.ID || list[0].AccessToken != "access" || list[0].APIKey != "" {
+		t.Errorf("accounts after rotation = %+v", list)
+	}
+
+	if _, err := underA.GetAccount(ctx, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetAccount(missing) err = %v; want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package sqlite is an embedded, zero-infrastructure storage backend built on
+// the pure-Go modernc.org/sqlite driver.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/storage/sqlite/migrations"
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite"
+)
+
+// Store implements storage.Store on a single SQLite database file.
+type Store struct {
+	db *sql.DB
+}
+
+var _ storage.Store = (*Store)(nil)
+
+func Open(ctx context.Context, path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create database directory: %w", err)
+	}
+
+	dsn := "file:" + path +
+		"?_pragma=journal_mode(WAL)" +
+		"&_pragma=busy_timeout(5000)" +
+		"&_pragma=foreign_keys(1)" +
+		"&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() {
+	s.db.Close()
+}
+
+// migrationFiles lists the schema migrations in order. The number of
+// migrations applied is tracked in PRAGMA user_version because SQLite's
+// ALTER TABLE has no IF NOT EXISTS form.
+var migrationFiles = []string{
+	"001_initial.up.sql",
+	"002_encryption.up.sql",
+	"003_incomplete_requests.up.sql",
+	"004_webhook_deliveries.up.sql",
+	"005_request_attribution.up.sql",
+	"006_search.up.sql",
+	"007_imported_requests.up.sql",
+	"008_vcr.up.sql",
+	"009_cache_hits.up.sql",
+}
+
+func (s *Store) Migrate(ctx context.Context) error {
+	var version int
+	if err := s.db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrationFiles); i++ {
+		name := migrationFiles[i]
+		sqlText, err := migrations.FS.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("read migration %s: %w", name, err)
+		}
+		err = s.tx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, string(sqlText)); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("run migration %s: %w", name, err)
+		}
+	}
+	log.Info().Msg("database migrations applied")
+	return nil
+}
+
+func (s *Store) tx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// micros encodes a timestamp the way every ts column stores it.
+func micros(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+func fromMicros(us int64) time.Time {
+	return time.UnixMicro(us)
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func nilIfZero(i int) *int {
+	if i == 0 {
+		return nil
+	}
+	return &i
+}
+
+func textOrNil(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
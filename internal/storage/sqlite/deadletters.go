@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func (s *Store) InsertDeadLetters(ctx context.Context, dls []storage.DeadLetter) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		for i := range dls {
+			dl := &dls[i]
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO write_dead_letters (created_at, kind, payload, error, attempts, key_id)
+				VALUES (?, ?, ?, ?, ?, ?)`,
+				micros(dl.CreatedAt), dl.Kind, string(dl.Payload), dl.Error, dl.Attempts, nilIfEmpty(dl.KeyID),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) ListDeadLetters(ctx context.Context, all bool, limit int) ([]storage.DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, created_at, kind, payload, error, attempts, replayed_at
+		FROM write_dead_letters
+		WHERE ? OR replayed_at IS NULL
+		ORDER BY id
+		LIMIT ?`, all, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.DeadLetter
+	for rows.Next() {
+		var dl storage.DeadLetter
+		var createdAt int64
+		var payload string
+		var replayedAt sql.NullInt64
+		if err := rows.Scan(&dl.ID, &createdAt, &dl.Kind, &payload, &dl.Error, &dl.Attempts, &replayedAt); err != nil {
+			return nil, err
+		}
+		dl.CreatedAt = fromMicros(createdAt)
+		dl.Payload = []byte(payload)
+		if replayedAt.Valid {
+			t := fromMicros(replayedAt.Int64)
+			dl.ReplayedAt = &t
+		}
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetDeadLetter(ctx context.Context, id int64) (*storage.DeadLetter, error) {
+	dl := &storage.DeadLetter{ID: id}
+	var createdAt int64
+	var payload string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT created_at, kind, payload, error, attempts
+		FROM write_dead_letters
+		WHERE id = ? AND replayed_at IS NULL`, id,
+	).Scan(&createdAt, &dl.Kind, &payload, &dl.Error, &dl.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	dl.CreatedAt = fromMicros(createdAt)
+	dl.Payload = []byte(payload)
+	return dl, nil
+}
+
+func (s *Store) MarkDeadLetterReplayed(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE write_dead_letters SET replayed_at = ? WHERE id = ?`, micros(time.Now()), id)
+	return err
+}
+
+func (s *Store) RecordDeadLetterFailure(ctx context.Context, id int64, errMsg string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE write_dead_letters SET error = ?, attempts = attempts + 1
+		WHERE id = ?`, errMsg, id)
+	return err
+}
@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sidekick.db")
+	s, err := Open(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second handle that gives up on a lock at once.
+	other, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		t.Fatal(err)
+	}
+	_, busy := other.Exec(`INSERT INTO t (id) VALUES (1)`)
+	conn.ExecContext(ctx, `ROLLBACK`)
+	conn.Close()
+
+	if _, err := s.db.Exec(`INSERT INTO t (id) VALUES (1)`); err != nil {
+		t.Fatal(err)
+	}
+	_, constraint := s.db.Exec(`INSERT INTO t (id) VALUES (1)`)
+	if busy == nil || constraint == nil {
+		t.Fatalf("want errors, got busy %v, constraint %v", busy, constraint)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"busy", fmt.Errorf("upsert: %w", busy), true},
+		{"constraint", fmt.Errorf("upsert: %w", constraint), false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := s.IsTransient(tt.err); got != tt.want {
+			t.Errorf("%s: IsTransient(%v) = %v; want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
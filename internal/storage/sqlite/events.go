@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// ReplaceSSEEvents writes a request's SSE events in one transaction, deleting
+// any events already stored for the request first.
+func (s *Store) ReplaceSSEEvents(ctx context.Context, b *storage.SSEEventBatch) error {
+	ts := micros(b.TS)
+	keyID := nilIfEmpty(b.KeyID)
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sse_events WHERE request_id = ? AND ts = ?`, b.RequestID, ts); err != nil {
+			return err
+		}
+		stmt, err := tx.PrepareContext(ctx, `
+			INSERT INTO sse_events (ts, request_id, event_index, event_type, data_json, raw_bytes, key_id, offset_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, ev := range b.Events {
+			if _, err := stmt.ExecContext(ctx, ts, b.RequestID, ev.Index, ev.EventType, ev.RawData, ev.RawBytes, keyID, nilIfZero(ev.OffsetMs)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,94 @@
+-- SQLite schema equivalent to the TimescaleDB migrations up to 004.
+-- Timestamps are INTEGER microseconds since the Unix epoch, UUIDs are TEXT,
+-- JSON columns are TEXT and booleans are 0/1.
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id                    TEXT PRIMARY KEY,
+    name                  TEXT NOT NULL UNIQUE,
+    provider              TEXT NOT NULL DEFAULT 'anthropic',
+    api_key               TEXT,
+    refresh_token         TEXT,
+    access_token          TEXT,
+    expires_at            INTEGER,
+    created_at            INTEGER NOT NULL DEFAULT (unixepoch() * 1000000),
+    last_used             INTEGER,
+    request_count         INTEGER DEFAULT 0,
+    account_tier          INTEGER DEFAULT 1,
+    paused                INTEGER DEFAULT 0,
+    rate_limited_until    INTEGER,
+    session_start         INTEGER,
+    session_request_count INTEGER DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS requests (
+    id                     TEXT NOT NULL,
+    ts                     INTEGER NOT NULL,
+    method                 TEXT,
+    path                   TEXT,
+    account_id             TEXT REFERENCES accounts(id) ON DELETE SET NULL,
+    status_code            INTEGER,
+    success                INTEGER,
+    error_message          TEXT,
+    response_time_ms       INTEGER,
+    failover_attempts      INTEGER DEFAULT 0,
+    model                  TEXT,
+    input_tokens           INTEGER DEFAULT 0,
+    output_tokens          INTEGER DEFAULT 0,
+    cache_read_tokens      INTEGER DEFAULT 0,
+    cache_creation_tokens  INTEGER DEFAULT 0,
+    total_tokens           INTEGER DEFAULT 0,
+    cost_usd               REAL DEFAULT 0,
+    tokens_per_second      REAL,
+    is_stream              INTEGER DEFAULT 0,
+    agent_used             TEXT,
+    stop_reason            TEXT,
+    message_id             TEXT,
+    tool_count             INTEGER,
+    thinking_budget_tokens INTEGER,
+    PRIMARY KEY (id, ts)
+);
+
+CREATE INDEX IF NOT EXISTS idx_requests_ts ON requests (ts DESC);
+CREATE INDEX IF NOT EXISTS idx_requests_account_ts ON requests (account_id, ts DESC);
+CREATE INDEX IF NOT EXISTS idx_requests_model_ts ON requests (model, ts DESC) WHERE model IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS sse_events (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    ts          INTEGER NOT NULL,
+    request_id  TEXT NOT NULL,
+    event_index INTEGER NOT NULL,
+    event_type  TEXT NOT NULL,
+    data_json   TEXT,
+    raw_bytes   INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_sse_events_request ON sse_events (request_id, ts, event_index);
+CREATE INDEX IF NOT EXISTS idx_sse_events_type ON sse_events (event_type, ts DESC);
+
+CREATE TABLE IF NOT EXISTS request_payloads (
+    request_id       TEXT NOT NULL,
+    ts               INTEGER NOT NULL,
+    request_headers  TEXT,
+    request_body     TEXT,
+    response_headers TEXT,
+    response_body    TEXT,
+    system_prompt    TEXT,
+    max_tokens       INTEGER,
+    temperature      REAL,
+    top_p            REAL,
+    message_count    INTEGER,
+    stop_sequence    TEXT,
+    PRIMARY KEY (request_id, ts)
+);
+
+CREATE TABLE IF NOT EXISTS write_dead_letters (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  INTEGER NOT NULL,
+    kind        TEXT NOT NULL,
+    payload     TEXT NOT NULL,
+    error       TEXT NOT NULL,
+    attempts    INTEGER NOT NULL DEFAULT 0,
+    replayed_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_write_dead_letters_pending ON write_dead_letters (id) WHERE replayed_at IS NULL;
@@ -0,0 +1,6 @@
+-- Master key ID for application-level envelope encryption (see the
+-- TimescaleDB migration 005).
+ALTER TABLE request_payloads   ADD COLUMN key_id TEXT;
+ALTER TABLE sse_events         ADD COLUMN key_id TEXT;
+ALTER TABLE accounts           ADD COLUMN key_id TEXT;
+ALTER TABLE write_dead_letters ADD COLUMN key_id TEXT;
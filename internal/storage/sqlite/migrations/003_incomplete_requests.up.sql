@@ -0,0 +1,3 @@
+-- Streamed requests whose response never finished (see the TimescaleDB
+-- migration 006).
+ALTER TABLE requests ADD COLUMN incomplete INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Request attribution (see the TimescaleDB migration 008).
+ALTER TABLE requests ADD COLUMN key_fingerprint TEXT;
+ALTER TABLE requests ADD COLUMN conversation_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_requests_key_ts ON requests (key_fingerprint, ts DESC) WHERE key_fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_requests_conversation_ts ON requests (conversation_id, ts DESC) WHERE conversation_id IS NOT NULL;
@@ -0,0 +1,31 @@
+-- Full-text search (see the TimescaleDB migration 009). request_search is an
+-- FTS5 index of request_payloads kept in sync by triggers; its rowid is the
+-- payload row's rowid. Earlier rows are indexed by `sidekick reindex`.
+ALTER TABLE request_payloads ADD COLUMN user_text TEXT;
+ALTER TABLE request_payloads ADD COLUMN response_text TEXT;
+
+CREATE VIRTUAL TABLE request_search USING fts5(
+    request_id UNINDEXED,
+    system_prompt,
+    user_text,
+    response_text,
+    tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER request_payloads_search_insert AFTER INSERT ON request_payloads BEGIN
+    INSERT INTO request_search (rowid, request_id, system_prompt, user_text, response_text)
+    VALUES (new.rowid, new.request_id, CASE WHEN new.key_id IS NULL THEN new.system_prompt END,
+            new.user_text, new.response_text);
+END;
+
+CREATE TRIGGER request_payloads_search_update
+AFTER UPDATE OF user_text, response_text, system_prompt, key_id ON request_payloads BEGIN
+    DELETE FROM request_search WHERE rowid = old.rowid;
+    INSERT INTO request_search (rowid, request_id, system_prompt, user_text, response_text)
+    VALUES (new.rowid, new.request_id, CASE WHEN new.key_id IS NULL THEN new.system_prompt END,
+            new.user_text, new.response_text);
+END;
+
+CREATE TRIGGER request_payloads_search_delete AFTER DELETE ON request_payloads BEGIN
+    DELETE FROM request_search WHERE rowid = old.rowid;
+END;
@@ -0,0 +1,4 @@
+-- Imported requests (see the TimescaleDB migration 010).
+ALTER TABLE requests ADD COLUMN imported INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_requests_message_id ON requests (message_id) WHERE message_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Record/playback (see the TimescaleDB migration 011).
+ALTER TABLE requests ADD COLUMN request_hash TEXT;
+ALTER TABLE sse_events ADD COLUMN offset_ms INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_requests_hash_ts ON requests (request_hash, ts DESC) WHERE request_hash IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Response cache hits (see the TimescaleDB migration 012).
+ALTER TABLE requests ADD COLUMN cache_hit INTEGER NOT NULL DEFAULT 0;
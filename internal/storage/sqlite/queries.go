@@ -0,0 +1,276 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/stream"
+)
+
+const requestColumns = `
+	id, ts, COALESCE(method, ''), COALESCE(path, ''), COALESCE(status_code, 0),
+	COALESCE(success, 0), incomplete, COALESCE(error_message, ''), COALESCE(response_time_ms, 0),
+	COALESCE(model, ''), COALESCE(is_stream, 0), COALESCE(input_tokens, 0), COALESCE(output_tokens, 0),
+	COALESCE(cache_read_tokens, 0), COALESCE(cache_creation_tokens, 0), COALESCE(total_tokens, 0),
+	COALESCE(cost_usd, 0), COALESCE(tokens_per_second, 0), COALESCE(stop_reason, ''),
+	COALESCE(message_id, ''), COALESCE(agent_used, ''), COALESCE(key_fingerprint, ''),
+	COALESCE(conversation_id, ''), COALESCE(tool_count, 0), COALESCE(thinking_budget_tokens, 0), imported, cache_hit`
+
+func scanRequest(row interface{ Scan(...any) error }) (storage.Request, error) {
+	var r storage.Request
+	var ts int64
+	err := row.Scan(&r.ID, &ts, &r.Method, &r.Path, &r.StatusCode,
+		&r.Success, &r.Incomplete, &r.ErrorMessage, &r.ResponseTimeMs,
+		&r.Model, &r.IsStream, &r.InputTokens, &r.OutputTokens,
+		&r.CacheReadTokens, &r.CacheCreationTokens, &r.TotalTokens,
+		&r.CostUSD, &r.TokensPerSecond, &r.StopReason,
+		&r.MessageID, &r.Agent, &r.KeyFingerprint,
+		&r.ConversationID, &r.ToolCount, &r.ThinkingBudgetTokens, &r.Imported, &r.CacheHit)
+	r.Timestamp = fromMicros(ts)
+	return r, err
+}
+
+// requestWhere renders f's conditions (except its cursor and limit) as a
+// WHERE clause.
+func requestWhere(f *storage.RequestFilter) (string, []any) {
+	var where []string
+	var args []any
+	add := func(cond string, arg ...any) {
+		where = append(where, cond)
+		args = append(args, arg...)
+	}
+	if !f.From.IsZero() {
+		add("ts >= ?", micros(f.From))
+	}
+	if !f.To.IsZero() {
+		add("ts < ?", micros(f.To))
+	}
+	if f.Model != "" {
+		add("model = ?", f.Model)
+	}
+	if f.StatusCode != 0 {
+		add("status_code = ?", f.StatusCode)
+	}
+	switch f.Outcome {
+	case storage.OutcomeSuccess:
+		add("success = 1")
+	case storage.OutcomeError:
+		add("COALESCE(success, 0) = 0 AND NOT incomplete")
+	case storage.OutcomeIncomplete:
+		add("incomplete")
+	}
+	if f.Key != "" {
+		add("key_fingerprint = ?", f.Key)
+	}
+	if f.Conversation != "" {
+		add("conversation_id = ?", f.Conversation)
+	}
+	if f.Agent != "" {
+		add("agent_used = ?", f.Agent)
+	}
+	if f.StopReason != "" {
+		add("stop_reason = ?", f.StopReason)
+	}
+	if f.Text != "" {
+		add("id IN (SELECT request_id FROM request_search WHERE request_search MATCH ?)", ftsQuery(f.Text))
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+func (s *Store) ListRequests(ctx context.Context, f *storage.RequestFilter) ([]storage.Request, error) {
+	where, args := requestWhere(f)
+	cmp, order := "<", "DESC"
+	if f.Ascending {
+		cmp, order = ">", "ASC"
+	}
+	if f.After != nil {
+		cond := "(ts, id) " + cmp + " (?, ?)"
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, micros(f.After.TS), f.After.ID)
+	}
+	args = append(args, f.Limit)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+requestColumns+` FROM requests`+where+`
+		ORDER BY ts `+order+`, id `+order+` LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.Request
+	for rows.Next() {
+		r, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+const usageColumns = `
+	COUNT(*), SUM(CASE WHEN COALESCE(success, 0) = 0 THEN 1 ELSE 0 END),
+	COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+	COALESCE(SUM(cache_read_tokens), 0), COALESCE(SUM(cache_creation_tokens), 0),
+	COALESCE(SUM(cost_usd), 0)`
+
+func usageDest(u *storage.UsageTotals) []any {
+	return []any{&u.Requests, &u.Errors, &u.InputTokens, &u.OutputTokens,
+		&u.CacheReadTokens, &u.CacheCreationTokens, &u.CostUSD}
+}
+
+func (s *Store) UsageOverTime(ctx context.Context, f *storage.RequestFilter, bucket time.Duration) ([]storage.UsageBucket, error) {
+	where, args := requestWhere(f)
+	width := bucket.Microseconds()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT (ts / ?) * ? AS bucket, `+usageColumns+`
+		FROM requests`+where+`
+		GROUP BY bucket
+		ORDER BY bucket`, append([]any{width, width}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.UsageBucket
+	for rows.Next() {
+		var b storage.UsageBucket
+		var start int64
+		if err := rows.Scan(append([]any{&start}, usageDest(&b.UsageTotals)...)...); err != nil {
+			return nil, err
+		}
+		b.Start = fromMicros(start).UTC()
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+var dimensionColumns = map[string]string{
+	"model":        "COALESCE(model, '')",
+	"agent":        "COALESCE(agent_used, '')",
+	"status":       "CAST(COALESCE(status_code, 0) AS TEXT)",
+	"key":          "COALESCE(key_fingerprint, '')",
+	"conversation": "COALESCE(conversation_id, '')",
+	"stop_reason":  "COALESCE(stop_reason, '')",
+}
+
+func (s *Store) UsageBy(ctx context.Context, f *storage.RequestFilter, dimension string) ([]storage.UsageGroup, error) {
+	col, ok := dimensionColumns[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown dimension %q", dimension)
+	}
+	where, args := requestWhere(f)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+col+` AS grp, `+usageColumns+`
+		FROM requests`+where+`
+		GROUP BY grp
+		ORDER BY 8 DESC, 2 DESC
+		LIMIT ?`, append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.UsageGroup
+	for rows.Next() {
+		var g storage.UsageGroup
+		if err := rows.Scan(append([]any{&g.Key}, usageDest(&g.UsageTotals)...)...); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetRequest(ctx context.Context, requestID uuid.UUID) (*storage.Request, error) {
+	r, err := scanRequest(s.db.QueryRowContext(ctx, `
+		SELECT `+requestColumns+`
+		FROM requests
+		WHERE id = ?
+		ORDER BY ts DESC
+		LIMIT 1`, requestID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) LatestRecording(ctx context.Context, requestHash string) (*storage.Request, error) {
+	r, err := scanRequest(s.db.QueryRowContext(ctx, `
+		SELECT `+requestColumns+`
+		FROM requests
+		WHERE request_hash = ? AND success = 1 AND NOT incomplete
+		ORDER BY ts DESC
+		LIMIT 1`, requestHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) ExistingMessageIDs(ctx context.Context, messageIDs []string) (map[string]bool, error) {
+	out := make(map[string]bool)
+	if len(messageIDs) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT message_id FROM requests
+		WHERE message_id IN (?`+strings.Repeat(", ?", len(messageIDs)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = true
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) ListSSEEvents(ctx context.Context, requestID uuid.UUID) ([]stream.SSEEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT event_index, event_type, COALESCE(data_json, ''), COALESCE(raw_bytes, 0), COALESCE(offset_ms, 0)
+		FROM sse_events
+		WHERE request_id = ?
+		ORDER BY event_index`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []stream.SSEEvent
+	for rows.Next() {
+		var ev stream.SSEEvent
+		if err := rows.Scan(&ev.Index, &ev.EventType, &ev.RawData, &ev.RawBytes, &ev.OffsetMs); err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,187 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func (s *Store) UpsertRequest(ctx context.Context, r *storage.RequestRecord) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO requests (
+			id, ts, method, path, account_id, status_code, success, error_message,
+			response_time_ms, failover_attempts, model, input_tokens, output_tokens,
+			cache_read_tokens, cache_creation_tokens, total_tokens, cost_usd,
+			tokens_per_second, is_stream, agent_used, tool_count, thinking_budget_tokens,
+			key_fingerprint, conversation_id, imported, request_hash, cache_hit
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		ON CONFLICT (id, ts) DO UPDATE SET
+			method = excluded.method,
+			path = excluded.path,
+			account_id = excluded.account_id,
+			status_code = excluded.status_code,
+			success = (excluded.success OR COALESCE(requests.success, 0)) AND NOT requests.incomplete,
+			error_message = COALESCE(excluded.error_message, requests.error_message),
+			response_time_ms = excluded.response_time_ms,
+			failover_attempts = excluded.failover_attempts,
+			model = COALESCE(requests.model, excluded.model),
+			is_stream = excluded.is_stream,
+			agent_used = COALESCE(excluded.agent_used, requests.agent_used),
+			tool_count = excluded.tool_count,
+			thinking_budget_tokens = excluded.thinking_budget_tokens,
+			key_fingerprint = COALESCE(excluded.key_fingerprint, requests.key_fingerprint),
+			conversation_id = COALESCE(excluded.conversation_id, requests.conversation_id),
+			imported = excluded.imported,
+			request_hash = COALESCE(excluded.request_hash, requests.request_hash),
+			cache_hit = excluded.cache_hit`,
+		r.ID, micros(r.Timestamp), r.Method, r.Path, r.AccountID,
+		r.StatusCode, r.Success, nilIfEmpty(r.ErrorMessage),
+		r.ResponseTimeMs, r.FailoverAttempts, nilIfEmpty(r.Model),
+		r.InputTokens, r.OutputTokens, r.CacheReadTokens, r.CacheCreationTokens,
+		r.TotalTokens, r.CostUSD, r.TokensPerSecond, r.IsStream, nilIfEmpty(r.AgentUsed),
+		nilIfZero(r.ToolCount), nilIfZero(r.ThinkingBudgetTokens),
+		nilIfEmpty(r.KeyFingerprint), nilIfEmpty(r.ConversationID), r.Imported,
+		nilIfEmpty(r.RequestHash), r.CacheHit,
+	)
+	return err
+}
+
+func (s *Store) UpsertRequestUsage(ctx context.Context, u *storage.RequestUsage) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO requests (
+			id, ts, model, input_tokens, output_tokens, cache_read_tokens,
+			cache_creation_tokens, total_tokens, cost_usd, tokens_per_second,
+			stop_reason, message_id, success
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,1)
+		ON CONFLICT (id, ts) DO UPDATE SET
+			model = COALESCE(excluded.model, requests.model),
+			input_tokens = excluded.input_tokens,
+			output_tokens = excluded.output_tokens,
+			cache_read_tokens = excluded.cache_read_tokens,
+			cache_creation_tokens = excluded.cache_creation_tokens,
+			total_tokens = excluded.total_tokens,
+			cost_usd = excluded.cost_usd,
+			tokens_per_second = excluded.tokens_per_second,
+			stop_reason = COALESCE(excluded.stop_reason, requests.stop_reason),
+			message_id = COALESCE(excluded.message_id, requests.message_id),
+			success = NOT requests.incomplete`,
+		u.RequestID, micros(u.TS), nilIfEmpty(u.Model),
+		u.InputTokens, u.OutputTokens, u.CacheRead, u.CacheCreation,
+		u.TotalTokens, u.CostUSD, u.TokensPerSec,
+		nilIfEmpty(u.StopReason), nilIfEmpty(u.MessageID),
+	)
+	return err
+}
+
+func (s *Store) MarkRequestIncomplete(ctx context.Context, r *storage.RequestIncomplete) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO requests (id, ts, success, incomplete, error_message)
+		VALUES (?, ?, 0, 1, ?)
+		ON CONFLICT (id, ts) DO UPDATE SET
+			success = 0,
+			incomplete = 1,
+			error_message = COALESCE(requests.error_message, excluded.error_message)`,
+		r.RequestID, micros(r.TS), r.Reason,
+	)
+	return err
+}
+
+// mergedKeyID keeps a payload row's key_id only while every write to the row
+// used the same master key. Rows sealed under several keys get "*", so key
+// rotation revisits them and still knows them sealed; rows mixing sealed and
+// plaintext writes get NULL.
+const mergedKeyID = `CASE
+	WHEN request_payloads.key_id = excluded.key_id THEN excluded.key_id
+	WHEN request_payloads.key_id IS NOT NULL AND excluded.key_id IS NOT NULL THEN '*'
+END`
+
+func (s *Store) UpsertPayload(ctx context.Context, p *storage.PayloadRecord) error {
+	reqH, _ := json.Marshal(p.ReqHeaders)
+	respH, _ := json.Marshal(p.RespHeaders)
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO request_payloads (
+			request_id, ts, request_headers, request_body, response_headers, response_body,
+			system_prompt, max_tokens, temperature, top_p, message_count, stop_sequence, key_id,
+			user_text, response_text
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		ON CONFLICT (request_id, ts) DO UPDATE SET
+			request_headers = excluded.request_headers,
+			request_body = excluded.request_body,
+			response_headers = excluded.response_headers,
+			response_body = COALESCE(excluded.response_body, request_payloads.response_body),
+			system_prompt = excluded.system_prompt,
+			max_tokens = excluded.max_tokens,
+			temperature = excluded.temperature,
+			top_p = excluded.top_p,
+			message_count = excluded.message_count,
+			stop_sequence = COALESCE(excluded.stop_sequence, request_payloads.stop_sequence),
+			user_text = excluded.user_text,
+			response_text = COALESCE(excluded.response_text, request_payloads.response_text),
+			key_id = `+mergedKeyID,
+		p.RequestID, micros(p.TS), string(reqH), textOrNil(p.ReqBody), string(respH), textOrNil(p.RespBody),
+		nilIfEmpty(p.Extras.SystemPrompt), nilIfZero(p.Extras.MaxTokens),
+		p.Extras.Temperature, p.Extras.TopP,
+		nilIfZero(p.Extras.MessageCount), p.Extras.StopSequence, nilIfEmpty(p.KeyID),
+		nilIfEmpty(p.Extras.UserText), nilIfEmpty(p.Extras.ResponseText),
+	)
+	return err
+}
+
+func (s *Store) UpsertPayloadResponse(ctx context.Context, p *storage.PayloadResponse) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO request_payloads (request_id, ts, response_body, stop_sequence, response_text, key_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (request_id, ts) DO UPDATE SET
+			response_body = excluded.response_body,
+			stop_sequence = COALESCE(excluded.stop_sequence, request_payloads.stop_sequence),
+			response_text = excluded.response_text,
+			key_id = `+mergedKeyID,
+		p.RequestID, micros(p.TS), textOrNil(p.RespBody), p.StopSequence, nilIfEmpty(p.ResponseText), nilIfEmpty(p.KeyID),
+	)
+	return err
+}
+
+func (s *Store) GetPayload(ctx context.Context, requestID uuid.UUID) (*storage.PayloadRecord, error) {
+	p := &storage.PayloadRecord{RequestID: requestID}
+	var ts int64
+	var reqH, reqBody, respH, respBody, systemPrompt, keyID sql.NullString
+	var maxTokens, messageCount sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT ts, request_headers, request_body, response_headers, response_body,
+			system_prompt, max_tokens, temperature, top_p, message_count, stop_sequence, key_id
+		FROM request_payloads
+		WHERE request_id = ?
+		ORDER BY ts DESC
+		LIMIT 1`, requestID,
+	).Scan(&ts, &reqH, &reqBody, &respH, &respBody,
+		&systemPrompt, &maxTokens, &p.Extras.Temperature, &p.Extras.TopP, &messageCount,
+		&p.Extras.StopSequence, &keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.TS = fromMicros(ts)
+	if reqH.Valid {
+		_ = json.Unmarshal([]byte(reqH.String), &p.ReqHeaders)
+	}
+	if respH.Valid {
+		_ = json.Unmarshal([]byte(respH.String), &p.RespHeaders)
+	}
+	if reqBody.Valid {
+		p.ReqBody = []byte(reqBody.String)
+	}
+	if respBody.Valid {
+		p.RespBody = []byte(respBody.String)
+	}
+	p.Extras.SystemPrompt = systemPrompt.String
+	p.Extras.MaxTokens = int(maxTokens.Int64)
+	p.Extras.MessageCount = int(messageCount.Int64)
+	p.KeyID = keyID.String
+	return p, nil
+}
@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sealedTables lists every table holding values encrypted at rest, with the
+// primary key used to address rows, the encrypted columns and the plaintext
+// derived from them that is dropped once they are sealed.
+var sealedTables = []struct {
+	table   string
+	keys    []string
+	columns []string
+	cleared []string
+}{
+	{"request_payloads", []string{"request_id", "ts"}, []string{"request_body", "response_body", "system_prompt"}, []string{"user_text", "response_text"}},
+	{"sse_events", []string{"id"}, []string{"data_json"}, nil},
+	{"accounts", []string{"id"}, []string{"api_key", "refresh_token", "access_token"}, nil},
+	{"write_dead_letters", []string{"id"}, []string{"payload"}, nil},
+}
+
+const resealBatchSize = 500
+
+func (s *Store) ResealRows(ctx context.Context, keyID string, reseal func([]byte, bool) ([]byte, error)) (int, error) {
+	total := 0
+	for _, t := range sealedTables {
+		for {
+			n, err := s.resealBatch(ctx, t.table, t.keys, t.columns, t.cleared, keyID, reseal)
+			if err != nil {
+				return total, fmt.Errorf("reseal %s: %w", t.table, err)
+			}
+			total += n
+			if n < resealBatchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// resealBatch rewrites up to resealBatchSize rows of one table in a single
+// transaction. Every selected row gets key_id = keyID, so repeated calls
+// make progress until no stale rows remain.
+func (s *Store) resealBatch(ctx context.Context, table string, keys, columns, cleared []string, keyID string, reseal func([]byte, bool) ([]byte, error)) (int, error) {
+	setCols := make([]string, 0, len(columns)+1)
+	for _, c := range columns {
+		setCols = append(setCols, c+" = ?")
+	}
+	setCols = append(setCols, "key_id = ?")
+	for _, c := range cleared {
+		setCols = append(setCols, c+" = NULL")
+	}
+	where := make([]string, 0, len(keys))
+	for _, k := range keys {
+		where = append(where, k+" = ?")
+	}
+
+	selectSQL := fmt.Sprintf(`SELECT key_id, %s, %s FROM %s WHERE key_id IS NOT ? LIMIT %d`,
+		strings.Join(keys, ", "), strings.Join(columns, ", "), table, resealBatchSize)
+	updateSQL := fmt.Sprintf(`UPDATE %s SET %s WHERE %s`,
+		table, strings.Join(setCols, ", "), strings.Join(where, " AND "))
+
+	n := 0
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, selectSQL, keyID)
+		if err != nil {
+			return err
+		}
+		var pending [][]any
+		for rows.Next() {
+			var rowKeyID sql.NullString
+			keyVals := make([]any, len(keys))
+			colVals := make([]sql.NullString, len(columns))
+			dest := make([]any, 0, 1+len(keys)+len(columns))
+			dest = append(dest, &rowKeyID)
+			for i := range keyVals {
+				dest = append(dest, &keyVals[i])
+			}
+			for i := range colVals {
+				dest = append(dest, &colVals[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+
+			args := make([]any, 0, len(columns)+1+len(keys))
+			for _, v := range colVals {
+				if !v.Valid {
+					args = append(args, nil)
+					continue
+				}
+				// A key_id marks the row's values sealed.
+				out, err := reseal([]byte(v.String), rowKeyID.Valid)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+				args = append(args, string(out))
+			}
+			args = append(args, keyID)
+			args = append(args, keyVals...)
+			pending = append(pending, args)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, args := range pending {
+			if _, err := tx.ExecContext(ctx, updateSQL, args...); err != nil {
+				return err
+			}
+		}
+		n = len(pending)
+		return nil
+	})
+	return n, err
+}
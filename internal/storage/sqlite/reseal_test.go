@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/envelope"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func TestResealRows(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+	var keys []string
+	for _, id := range []string{"a", "b"} {
+		key, err := envelope.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, id+":"+key)
+	}
+	keyring := func(spec []string, active string) *envelope.Keyring {
+		k, err := envelope.ParseKeyring(strings.Join(spec, ","), active)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	underA := storage.NewEncryptedStore(s, keyring(keys, "a"))
+	underB := storage.NewEncryptedStore(s, keyring(keys, "b"))
+	ts := time.UnixMicro(time.Now().UnixMicro())
+
+	// Sealed under a, then b: a stream whose response arrived after rotation.
+	mixed := uuid.New()
+	if err := underA.UpsertPayload(ctx, &storage.PayloadRecord{
+		RequestID: mixed, TS: ts, ReqBody: []byte(`{"q":1}`),
+		Extras: storage.PayloadExtras{SystemPrompt: "be brief"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := underB.UpsertPayloadResponse(ctx, &storage.PayloadResponse{
+		RequestID: mixed, TS: ts, RespBody: []byte(`{"a":1}`),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var keyID string
+	s.db.QueryRow(`SELECT key_id FROM request_payloads WHERE request_id = ?`, mixed).Scan(&keyID)
+	if keyID != "*" {
+		t.Errorf("key_id of a row sealed under two keys = %q; want *", keyID)
+	}
+
+	// Written before encryption, with a body shaped like an envelope.
+	lookalike, _ := keyring(keys, "a").Seal([]byte("inner"))
+	plain := uuid.New()
+	if err := s.UpsertPayload(ctx, &storage.PayloadRecord{RequestID: plain, TS: ts, ReqBody: lookalike}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := underB.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	onlyB := storage.NewEncryptedStore(s, keyring(keys[1:], ""))
+	p, err := onlyB.GetPayload(ctx, mixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.ReqBody) != `{"q":1}` || string(p.RespBody) != `{"a":1}` || p.Extras.SystemPrompt != "be brief" {
+		t.Errorf("mixed row = %s, %s, %q", p.ReqBody, p.RespBody, p.Extras.SystemPrompt)
+	}
+	if p, err = onlyB.GetPayload(ctx, plain); err != nil {
+		t.Fatal(err)
+	}
+	if string(p.ReqBody) != string(lookalike) {
+		t.Errorf("plaintext row = %s; want %s", p.ReqBody, lookalike)
+	}
+}
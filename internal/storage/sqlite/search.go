@@ -0,0 +1,197 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// Columns of request_search.
+const (
+	searchSystemCol   = 1
+	searchUserCol     = 2
+	searchResponseCol = 3
+)
+
+func (s *Store) Highlights(ctx context.Context, text string, requestIDs []uuid.UUID) (map[uuid.UUID][]storage.Highlight, error) {
+	out := make(map[uuid.UUID][]storage.Highlight)
+	if len(requestIDs) == 0 {
+		return out, nil
+	}
+	snippet := func(col int) string {
+		return fmt.Sprintf("COALESCE(snippet(request_search, %d, ?, ?, '…', 24), '')", col)
+	}
+	args := []any{}
+	for range 3 {
+		args = append(args, storage.HighlightStart, storage.HighlightEnd)
+	}
+	args = append(args, ftsQuery(text))
+	for _, id := range requestIDs {
+		args = append(args, id)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT request_id, `+snippet(searchUserCol)+`, `+snippet(searchResponseCol)+`, `+snippet(searchSystemCol)+`
+		FROM request_search
+		WHERE request_search MATCH ? AND request_id IN (?`+strings.Repeat(", ?", len(requestIDs)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var user, response, system string
+		if err := rows.Scan(&id, &user, &response, &system); err != nil {
+			return nil, err
+		}
+		out[id] = storage.MatchingHighlights(
+			storage.Highlight{Field: storage.FieldUser, Snippet: user},
+			storage.Highlight{Field: storage.FieldResponse, Snippet: response},
+			storage.Highlight{Field: storage.FieldSystem, Snippet: system},
+		)
+	}
+	return out, rows.Err()
+}
+
+// ftsQuery translates a web search style query (as accepted by Postgres'
+// websearch_to_tsquery) into FTS5 syntax: words and "quoted phrases" must
+// all match, "or" between two terms makes either match, and a leading "-"
+// excludes a term. Terms are quoted, so FTS5 operators in the input are
+// matched literally.
+func ftsQuery(q string) string {
+	type term struct {
+		text string
+		neg  bool
+	}
+	var terms []term
+	var or []bool // or[i]: terms[i] is or-ed with the term before it
+	pendingOr := false
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		neg := false
+		if q[0] == '-' {
+			neg, q = true, q[1:]
+		}
+		var text string
+		if strings.HasPrefix(q, `"`) {
+			end := strings.IndexByte(q[1:], '"')
+			if end < 0 {
+				text, q = q[1:], ""
+			} else {
+				text, q = q[1:end+1], q[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(q, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' })
+			if end < 0 {
+				end = len(q)
+			}
+			text, q = q[:end], q[end:]
+		}
+		if !neg && strings.EqualFold(text, "or") && len(terms) > 0 {
+			pendingOr = true
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		terms = append(terms, term{text, neg})
+		or = append(or, pendingOr && !neg)
+		pendingOr = false
+	}
+
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` }
+	var groups, excluded []string
+	for i, t := range terms {
+		switch {
+		case t.neg:
+			excluded = append(excluded, quote(t.text))
+		case or[i] && len(groups) > 0:
+			groups[len(groups)-1] += " OR " + quote(t.text)
+		default:
+			groups = append(groups, quote(t.text))
+		}
+	}
+	if len(groups) == 0 {
+		// Nothing to match: FTS5 has no "everything", and a query of only
+		// exclusions would match nearly every request anyway.
+		return `""`
+	}
+	for i, g := range groups {
+		if strings.Contains(g, " OR ") {
+			groups[i] = "(" + g + ")"
+		}
+	}
+	out := strings.Join(groups, " AND ")
+	for _, e := range excluded {
+		out += " NOT " + e
+	}
+	return out
+}
+
+const backfillBatchSize = 500
+
+func (s *Store) BackfillSearchText(ctx context.Context, fill func(reqBody, respBody []byte) (string, string, error)) (int, error) {
+	total := 0
+	for {
+		n, err := s.backfillBatch(ctx, fill)
+		total += n
+		if err != nil || n < backfillBatchSize {
+			return total, err
+		}
+	}
+}
+
+// backfillBatch fills up to backfillBatchSize rows in one transaction.
+// Rows without any text get empty strings rather than NULL, so they are not
+// selected again.
+func (s *Store) backfillBatch(ctx context.Context, fill func(reqBody, respBody []byte) (string, string, error)) (int, error) {
+	n := 0
+	err := s.tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT request_id, ts, request_body, response_body
+			FROM request_payloads
+			WHERE user_text IS NULL AND response_text IS NULL AND key_id IS NULL
+			LIMIT ?`, backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		type filled struct {
+			requestID          any
+			ts                 int64
+			user, responseText string
+		}
+		var pending []filled
+		for rows.Next() {
+			var f filled
+			var reqBody, respBody sql.NullString
+			if err := rows.Scan(&f.requestID, &f.ts, &reqBody, &respBody); err != nil {
+				rows.Close()
+				return err
+			}
+			if f.user, f.responseText, err = fill([]byte(reqBody.String), []byte(respBody.String)); err != nil {
+				rows.Close()
+				return err
+			}
+			pending = append(pending, f)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, f := range pending {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE request_payloads SET user_text = ?, response_text = ?
+				WHERE request_id = ? AND ts = ?`, f.user, f.responseText, f.requestID, f.ts)
+			if err != nil {
+				return err
+			}
+		}
+		n = len(pending)
+		return nil
+	})
+	return n, err
+}
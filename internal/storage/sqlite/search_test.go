@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func TestFTSQuery(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"migrations", `"migrations"`},
+		{"delete migrations", `"delete" AND "migrations"`},
+		{`"delete the migrations" folder`, `"delete the migrations" AND "folder"`},
+		{"rm or delete", `("rm" OR "delete")`},
+		{"agent rm or delete folder", `"agent" AND ("rm" OR "delete") AND "folder"`},
+		{"a or b or c", `("a" OR "b" OR "c")`},
+		{"migrations -test", `"migrations" NOT "test"`},
+		{`migrations -"unit test"`, `"migrations" NOT "unit test"`},
+		{"a or -b", `"a" NOT "b"`},
+		{"or migrations", `"or" AND "migrations"`},
+		{"-only", `""`},
+		{"", `""`},
+		{`"unterminated phrase`, `"unterminated phrase"`},
+		{`NEAR(a b) col:x*`, `"NEAR(a" AND "b)" AND "col:x*"`},
+		{`it"s don't`, `"it""s" AND "don't"`},
+		{"  spaced\tout\n", `"spaced" AND "out"`},
+	} {
+		if got := ftsQuery(tc.in); got != tc.want {
+			t.Errorf("ftsQuery(%q) = %s; want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFTSQueryMatches(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+	ts := time.UnixMicro(time.Now().UnixMicro())
+	texts := map[string]string{
+		"delete": "please delete the migrations folder",
+		"keep":   "keep the migrations folder, delete the tests",
+		"other":  "unrelated request",
+	}
+	ids := map[uuid.UUID]string{}
+	for name, text := range texts {
+		id := uuid.New()
+		ids[id] = name
+		if err := s.UpsertRequest(ctx, &storage.RequestRecord{ID: id, Timestamp: ts, Method: "POST", Path: "/v1/messages"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpsertPayload(ctx, &storage.PayloadRecord{RequestID: id, TS: ts, Extras: storage.PayloadExtras{UserText: text}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		q    string
+		want []string
+	}{
+		{`"delete the migrations"`, []string{"delete"}},
+		{"migrations -tests", []string{"delete"}},
+		{"unrelated or tests", []string{"keep", "other"}},
+		{"folder", []string{"delete", "keep"}},
+	} {
+		reqs, err := s.ListRequests(ctx, &storage.RequestFilter{Text: tc.q, Limit: 10})
+		if err != nil {
+			t.Fatalf("%q: %v", tc.q, err)
+		}
+		var got []string
+		for _, r := range reqs {
+			got = append(got, ids[r.ID])
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%q matched %v; want %v", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestBackfillSearchText(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+	ts := time.UnixMicro(time.Now().UnixMicro())
+	old, empty := uuid.New(), uuid.New()
+	for id, body := range map[uuid.UUID]string{old: `{"q":"delete the migrations folder"}`, empty: `{}`} {
+		if err := s.UpsertRequest(ctx, &storage.RequestRecord{ID: id, Timestamp: ts, Method: "POST", Path: "/v1/messages"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpsertPayload(ctx, &storage.PayloadRecord{RequestID: id, TS: ts, ReqBody: []byte(body), RespBody: []byte(`{"a":"done"}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func() int {
+		reqs, err := s.ListRequests(ctx, &storage.RequestFilter{Text: "migrations", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(reqs)
+	}
+	if n := search(); n != 0 {
+		t.Fatalf("%d matches before backfill", n)
+	}
+
+	fill := func(reqBody, respBody []byte) (string, string, error) {
+		if string(reqBody) == "{}" {
+			return "", "", nil
+		}
+		return string(reqBody), string(respBody), nil
+	}
+	n, err := s.BackfillSearchText(ctx, fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("filled %d rows; want 2", n)
+	}
+	if n := search(); n != 1 {
+		t.Errorf("%d matches after backfill; want 1", n)
+	}
+	// Rows without text are not visited again.
+	if n, err := s.BackfillSearchText(ctx, fill); err != nil || n != 0 {
+		t.Errorf("second backfill filled %d rows, err %v", n, err)
+	}
+}
@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func (s *Store) InsertWebhookDelivery(ctx context.Context, d *storage.WebhookDelivery) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (created_at, endpoint, event_id, event_type, attempt, outcome, status_code, error, duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (endpoint, event_id, attempt) DO NOTHING`,
+		micros(d.CreatedAt), d.Endpoint, d.EventID, d.EventType, d.Attempt, d.Outcome,
+		nilIfZero(d.StatusCode), nilIfEmpty(d.Error), d.DurationMs,
+	)
+	return err
+}
+
+func (s *Store) ListWebhookDeliveries(ctx context.Context, endpoint string, failedOnly bool, limit int) ([]storage.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, created_at, endpoint, event_id, event_type, attempt, outcome, status_code, error, duration_ms
+		FROM webhook_deliveries
+		WHERE (? = '' OR endpoint = ?) AND (NOT ? OR outcome <> ?)
+		ORDER BY id DESC
+		LIMIT ?`, endpoint, endpoint, failedOnly, storage.DeliveryDelivered, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.WebhookDelivery
+	for rows.Next() {
+		var d storage.WebhookDelivery
+		var createdAt int64
+		var statusCode sql.NullInt64
+		var errMsg sql.NullString
+		if err := rows.Scan(&d.ID, &createdAt, &d.Endpoint, &d.EventID, &d.EventType, &d.Attempt, &d.Outcome, &statusCode, &errMsg, &d.DurationMs); err != nil {
+			return nil, err
+		}
+		d.CreatedAt = fromMicros(createdAt)
+		d.StatusCode = int(statusCode.Int64)
+		d.Error = errMsg.String
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,166 @@
+// Package storagetest holds tests shared by the storage backends.
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// Row is what the write jobs of one request leave behind.
+type Row struct {
+	StatusCode   sql.NullInt64
+	Success      bool
+	Incomplete   bool
+	ErrorMessage sql.NullString
+	Model        sql.NullString
+	AgentUsed    sql.NullString
+	InputTokens  int
+	OutputTokens int
+	CostUSD      float64
+	StopReason   sql.NullString
+	MessageID    sql.NullString
+	RespBody     sql.NullString
+	RespText     sql.NullString
+	UserText     sql.NullString
+	StopSequence sql.NullString
+	SystemPrompt sql.NullString
+}
+
+// permutations returns every ordering of 0..n-1.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var out [][]int
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			q := append(append(append([]int{}, p[:i]...), n-1), p[i:]...)
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// RequestJobsAnyOrder checks that the write jobs of a request leave the same
+// row behind in every order they can arrive in. read returns the row of a
+// request as stored by s.
+func RequestJobsAnyOrder(t *testing.T, s storage.Store, read func(t *testing.T, id uuid.UUID) Row) {
+	stop := "\n\nHuman:"
+	ts := time.UnixMicro(time.Now().UnixMicro())
+
+	tests := []struct {
+		name string
+		jobs func(id uuid.UUID) []storage.WriteJob
+		want func(t *testing.T, r Row)
+	}{
+		{
+			name: "streamed",
+			jobs: func(id uuid.UUID) []storage.WriteJob {
+				return []storage.WriteJob{
+					storage.InsertRequestJob(&storage.RequestRecord{
+						ID: id, Timestamp: ts, Method: "POST", Path: "/v1/messages",
+						StatusCode: 200, Success: true, Model: "claude-sonnet-4-5",
+						IsStream: true, AgentUsed: "main",
+					}),
+					storage.UpdateRequestUsageJob(id, ts, "claude-sonnet-4-5-20250929", 10, 20, 0, 0, 30, 0.25, 12.5, "end_turn", "msg_1"),
+					storage.InsertPayloadJob(id, ts, nil, nil, []byte(`{"stream":true}`), nil, storage.PayloadExtras{
+						SystemPrompt: "be brief", UserText: "hi",
+					}),
+					storage.UpdatePayloadResponseJob(id, ts, []byte(`{"id":"msg_1"}`), &stop, "hello"),
+				}
+			},
+			want: func(t *testing.T, r Row) {
+				if !r.Success || r.Incomplete {
+					t.Errorf("success, incomplete = %v, %v; want true, false", r.Success, r.Incomplete)
+				}
+				if r.InputTokens != 10 || r.OutputTokens != 20 || r.CostUSD != 0.25 {
+					t.Errorf("usage = %d/%d/%v; want 10/20/0.25", r.InputTokens, r.OutputTokens, r.CostUSD)
+				}
+				if r.RespText.String != "hello" || r.RespBody.String != `{"id":"msg_1"}` {
+					t.Errorf("response = %q, %q", r.RespBody.String, r.RespText.String)
+				}
+			},
+		},
+		{
+			name: "abandoned",
+			jobs: func(id uuid.UUID) []storage.WriteJob {
+				return []storage.WriteJob{
+					storage.InsertRequestJob(&storage.RequestRecord{
+						ID: id, Timestamp: ts, Method: "POST", Path: "/v1/messages",
+						StatusCode: 200, Success: true, Model: "claude-sonnet-4-5", IsStream: true,
+					}),
+					storage.UpdateRequestUsageJob(id, ts, "claude-sonnet-4-5-20250929", 10, 3, 0, 0, 13, 0.05, 0, "", "msg_2"),
+					storage.InsertPayloadJob(id, ts, nil, nil, []byte(`{"stream":true}`), nil, storage.PayloadExtras{UserText: "hi"}),
+					storage.UpdatePayloadResponseJob(id, ts, []byte(`{"id":"msg_2"}`), nil, "partial"),
+					storage.MarkRequestIncompleteJob(id, ts, "stream incomplete"),
+				}
+			},
+			want: func(t *testing.T, r Row) {
+				if r.Success || !r.Incomplete {
+					t.Errorf("success, incomplete = %v, %v; want false, true", r.Success, r.Incomplete)
+				}
+				if r.ErrorMessage.String != "stream incomplete" {
+					t.Errorf("error_message = %q", r.ErrorMessage.String)
+				}
+				if r.InputTokens != 10 || r.OutputTokens != 3 {
+					t.Errorf("usage = %d/%d; want 10/3", r.InputTokens, r.OutputTokens)
+				}
+				if r.RespText.String != "partial" {
+					t.Errorf("response_text = %q; want partial", r.RespText.String)
+				}
+			},
+		},
+		{
+			name: "non-streamed",
+			jobs: func(id uuid.UUID) []storage.WriteJob {
+				return []storage.WriteJob{
+					storage.InsertRequestJob(&storage.RequestRecord{
+						ID: id, Timestamp: ts, Method: "POST", Path: "/v1/messages",
+						StatusCode: 200, Success: true, Model: "claude-haiku-4-5",
+					}),
+					storage.UpdateRequestUsageJob(id, ts, "claude-haiku-4-5-20251001", 5, 6, 0, 0, 11, 0.01, 0, "max_tokens", "msg_3"),
+					storage.InsertPayloadJob(id, ts, nil, nil, []byte(`{}`), []byte(`{"id":"msg_3"}`), storage.PayloadExtras{
+						UserText: "hi", ResponseText: "answer",
+					}),
+				}
+			},
+			want: func(t *testing.T, r Row) {
+				if r.RespText.String != "answer" || r.StopReason.String != "max_tokens" {
+					t.Errorf("response_text, stop_reason = %q, %q", r.RespText.String, r.StopReason.String)
+				}
+			},
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := uuid.New()
+			for _, job := range tt.jobs(id) {
+				if err := job.Execute(ctx, s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := read(t, id)
+			tt.want(t, want)
+
+			for _, order := range permutations(len(tt.jobs(id))) {
+				id := uuid.New()
+				jobs := tt.jobs(id)
+				for _, i := range order {
+					if err := jobs[i].Execute(ctx, s); err != nil {
+						t.Fatalf("order %v: job %s: %v", order, jobs[i].Kind(), err)
+					}
+				}
+				if got := read(t, id); got != want {
+					t.Errorf("order %v:\n got %+v\nwant %+v", order, got, want)
+				}
+			}
+		})
+	}
+}
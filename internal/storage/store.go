@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/stream"
+)
+
+// Store is a storage backend. Write jobs and the dead-letter store only talk
+// to this interface, so the TimescaleDB and SQLite implementations are
+// interchangeable.
+//
+// Every write is an upsert keyed by request ID and timestamp: jobs for the
+// same request may arrive in any order and may be retried or replayed.
+type Store interface {
+	Migrate(ctx context.Context) error
+	Close()
+
+	// IsTransient reports whether an error returned by the store is worth
+	// retrying (lost connections, failover, lock contention) rather than a
+	// permanent rejection of the data itself.
+	IsTransient(err error) bool
+
+	UpsertRequest(ctx context.Context, r *RequestRecord) error
+	UpsertRequestUsage(ctx context.Context, u *RequestUsage) error
+	MarkRequestIncomplete(ctx context.Context, r *RequestIncomplete) error
+	UpsertPayload(ctx context.Context, p *PayloadRecord) error
+	UpsertPayloadResponse(ctx context.Context, p *PayloadResponse) error
+	ReplaceSSEEvents(ctx context.Context, b *SSEEventBatch) error
+
+	// GetPayload returns the stored bodies of a request, or ErrNotFound.
+	GetPayload(ctx context.Context, requestID uuid.UUID) (*PayloadRecord, error)
+
+	ListRequests(ctx context.Context, f *RequestFilter) ([]Request, error)
+	// GetRequest returns a request row, or ErrNotFound.
+	GetRequest(ctx context.Context, requestID uuid.UUID) (*Request, error)
+	// ExistingMessageIDs returns which of the given API message IDs belong to
+	// stored requests.
+	ExistingMessageIDs(ctx context.Context, messageIDs []string) (map[string]bool, error)
+	// LatestRecording returns the most recent successful, complete proxied
+	// request with the given request hash, or ErrNotFound.
+	LatestRecording(ctx context.Context, requestHash string) (*Request, error)
+	// ListSSEEvents returns a streamed request's SSE events in stream order.
+	ListSSEEvents(ctx context.Context, requestID uuid.UUID) ([]stream.SSEEvent, error)
+	// UsageOverTime aggregates the requests matching f (ignoring its cursor
+	// and limit) into time buckets, oldest first. Empty buckets are omitted.
+	UsageOverTime(ctx context.Context, f *RequestFilter, bucket time.Duration) ([]UsageBucket, error)
+	// UsageBy aggregates the requests matching f by one of UsageDimensions,
+	// most expensive first, returning at most f.Limit groups.
+	UsageBy(ctx context.Context, f *RequestFilter, dimension string) ([]UsageGroup, error)
+	// Highlights returns, for each of the given requests that matches the
+	// full-text query, excerpts of the fields containing a match.
+	Highlights(ctx context.Context, text string, requestIDs []uuid.UUID) (map[uuid.UUID][]Highlight, error)
+	// BackfillSearchText fills the search text of plaintext payload rows
+	// that have none, e.g. those recorded before full-text search existed:
+	// fill derives a row's user and response text from its bodies. Returns
+	// the number of rows filled.
+	BackfillSearchText(ctx context.Context, fill func(reqBody, respBody []byte) (userText, responseText string, err error)) (int, error)
+
+	InsertDeadLetters(ctx context.Context, dls []DeadLetter) error
+	ListDeadLetters(ctx context.Context, all bool, limit int) ([]DeadLetter, error)
+	// GetDeadLetter returns a dead letter that has not been replayed yet.
+	GetDeadLetter(ctx context.Context, id int64) (*DeadLetter, error)
+	MarkDeadLetterReplayed(ctx context.Context, id int64) error
+	RecordDeadLetterFailure(ctx context.Context, id int64, errMsg string) error
+
+	// UpsertAccount creates or updates the account with the given name and
+	// sets a.ID and a.CreatedAt to the stored ones.
+	UpsertAccount(ctx context.Context, a *Account) error
+	// GetAccount returns an account by name, or ErrNotFound.
+	GetAccount(ctx context.Context, name string) (*Account, error)
+	// ListAccounts returns every account, ordered by name.
+	ListAccounts(ctx context.Context) ([]Account, error)
+
+	// InsertWebhookDelivery records a delivery attempt; recording the same
+	// endpoint, event and attempt again is a no-op.
+	InsertWebhookDelivery(ctx context.Context, d *WebhookDelivery) error
+	// ListWebhookDeliveries returns the most recent attempts first, optionally
+	// only those of one endpoint and only failed ones.
+	ListWebhookDeliveries(ctx context.Context, endpoint string, failedOnly bool, limit int) ([]WebhookDelivery, error)
+
+	// ResealRows passes every encrypted-at-rest value in rows whose key_id
+	// differs from keyID through reseal and stores the result with keyID.
+	// reseal is told whether the row's key_id marks the value as sealed.
+	// Returns the number of rows updated.
+	ResealRows(ctx context.Context, keyID string, reseal func(value []byte, sealed bool) ([]byte, error)) (int, error)
+}
@@ -0,0 +1,72 @@
+package timescale
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func (s *Store) UpsertAccount(ctx context.Context, a *storage.Account) error {
+	id := a.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	return s.pool.QueryRow(ctx, `
+		INSERT INTO accounts (id, name, provider, api_key, refresh_token, access_token, expires_at, key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (name) DO UPDATE SET
+			provider      = EXCLUDED.provider,
+			api_key       = EXCLUDED.api_key,
+			refresh_token = EXCLUDED.refresh_token,
+			access_token  = EXCLUDED.access_token,
+			expires_at    = EXCLUDED.expires_at,
+			key_id        = EXCLUDED.key_id
+		RETURNING id, created_at`,
+		id, a.Name, a.Provider,
+		nilIfEmpty(a.APIKey), nilIfEmpty(a.RefreshToken), nilIfEmpty(a.AccessToken),
+		a.ExpiresAt, nilIfEmpty(a.KeyID),
+	).Scan(&a.ID, &a.CreatedAt)
+}
+
+const selectAccount = `
+	SELECT id, name, provider, COALESCE(api_key, ''), COALESCE(refresh_token, ''), COALESCE(access_token, ''),
+	       expires_at, created_at, COALESCE(key_id, '')
+	FROM accounts`
+
+func (s *Store) GetAccount(ctx context.Context, name string) (*storage.Account, error) {
+	a, err := scanAccount(s.pool.QueryRow(ctx, selectAccount+` WHERE name = $1`, name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	return a, err
+}
+
+func (s *Store) ListAccounts(ctx context.Context) ([]storage.Account, error) {
+	rows, err := s.pool.Query(ctx, selectAccount+` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storage.Account
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *a)
+	}
+	return out, rows.Err()
+}
+
+func scanAccount(row pgx.Row) (*storage.Account, error) {
+	var a storage.Account
+	err := row.Scan(&a.ID, &a.Name, &a.Provider, &a.APIKey, &a.RefreshToken, &a.AccessToken, &a.ExpiresAt, &a.CreatedAt, &a.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,69 @@
+// Package timescale is the TimescaleDB (PostgreSQL) storage backend.
+package timescale
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/storage/timescale/migrations"
+	"github.com/rs/zerolog/log"
+)
+
+// Store implements storage.Store on a pgx connection pool.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+var _ storage.Store = (*Store)(nil)
+
+func Open(ctx context.Context, databaseURL string) (*Store, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("create pool: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+
+	return &Store{pool: pool}, nil
+}
+
+func (s *Store) Close() {
+	s.pool.Close()
+}
+
+func (s *Store) Migrate(ctx context.Context) error {
+	for _, name := range []string{
+		"001_initial.up.sql",
+		"002_structured_payloads.up.sql",
+		"003_dead_letters.up.sql",
+		"004_order_independent_writes.up.sql",
+		"005_encryption.up.sql",
+		"006_incomplete_requests.up.sql",
+		"007_webhook_deliveries.up.sql",
+		"008_request_attribution.up.sql",
+		"009_search.up.sql",
+		"010_imported_requests.up.sql",
+		"011_vcr.up.sql",
+		"012_cache_hits.up.sql",
+	} {
+		sql, err := migrations.FS.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("read migration %s: %w", name, err)
+		}
+		if _, err = s.pool.Exec(ctx, string(sql)); err != nil {
+			return fmt.Errorf("run migration %s: %w", name, err)
+		}
+	}
+	log.Info().Msg("database migrations applied")
+	return nil
+}
@@ -0,0 +1,67 @@
+package timescale
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func (s *Store) InsertDeadLetters(ctx context.Context, dls []storage.DeadLetter) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		for i := range dls {
+			dl := &dls[i]
+			_, err := tx.Exec(ctx, `
+				INSERT INTO write_dead_letters (created_at, kind, payload, error, attempts, key_id)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				dl.CreatedAt, dl.Kind, dl.Payload, dl.Error, dl.Attempts, nilIfEmpty(dl.KeyID),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) ListDeadLetters(ctx context.Context, all bool, limit int) ([]storage.DeadLetter, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, created_at, kind, payload, error, attempts, replayed_at
+		FROM write_dead_letters
+		WHERE $1 OR replayed_at IS NULL
+		ORDER BY id
+		LIMIT $2`, all, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.DeadLetter, error) {
+		var dl storage.DeadLetter
+		err := row.Scan(&dl.ID, &dl.CreatedAt, &dl.Kind, &dl.Payload, &dl.Error, &dl.Attempts, &dl.ReplayedAt)
+		return dl, err
+	})
+}
+
+func (s *Store) GetDeadLetter(ctx context.Context, id int64) (*storage.DeadLetter, error) {
+	dl := &storage.DeadLetter{ID: id}
+	err := s.pool.QueryRow(ctx, `
+		SELECT created_at, kind, payload, error, attempts
+		FROM write_dead_letters
+		WHERE id = $1 AND replayed_at IS NULL`, id,
+	).Scan(&dl.CreatedAt, &dl.Kind, &dl.Payload, &dl.Error, &dl.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+func (s *Store) MarkDeadLetterReplayed(ctx context.Context, id int64) error {
+	_, err := s.pool.Exec(ctx, `UPDATE write_dead_letters SET replayed_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (s *Store) RecordDeadLetterFailure(ctx context.Context, id int64, errMsg string) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE write_dead_letters SET error = $1, attempts = attempts + 1
+		WHERE id = $2`, errMsg, id)
+	return err
+}
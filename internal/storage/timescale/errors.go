@@ -0,0 +1,56 @@
+package timescale
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsTransient reports whether a write error is worth retrying. Errors the
+// server returned for the statement itself (constraint violations, bad data,
+// syntax) are permanent; connection loss, failover, serialization conflicts
+// and resource exhaustion are transient.
+func (s *Store) IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return isTransientSQLState(pgErr.Code)
+	}
+
+	// Anything that never reached the server as a statement error (dial
+	// failures, broken connections, a pool that cannot acquire) is treated
+	// as transient.
+	return true
+}
+
+func isTransientSQLState(code string) bool {
+	switch code {
+	case "40001", // serialization_failure
+		"40P01", // deadlock_detected
+		"55P03", // lock_not_available
+		"25006": // read_only_sql_transaction (writing to a demoted primary)
+		return true
+	}
+	for _, class := range []string{
+		"08", // connection exception
+		"53", // insufficient resources
+		"57", // operator intervention (admin/crash shutdown, cannot connect now)
+		"58", // system error
+	} {
+		if strings.HasPrefix(code, class) {
+			return true
+		}
+	}
+	return false
+}
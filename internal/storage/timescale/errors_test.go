@@ -0,0 +1,61 @@
+package timescale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsTransientSQLState(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"40001", true},  // serialization_failure
+		{"40P01", true},  // deadlock_detected
+		{"55P03", true},  // lock_not_available
+		{"25006", true},  // read_only_sql_transaction
+		{"08006", true},  // connection_failure
+		{"08P01", true},  // protocol_violation
+		{"53300", true},  // too_many_connections
+		{"57P01", true},  // admin_shutdown
+		{"57P03", true},  // cannot_connect_now
+		{"58030", true},  // io_error
+		{"40002", false}, // transaction_integrity_constraint_violation
+		{"23505", false}, // unique_violation
+		{"22P02", false}, // invalid_text_representation
+		{"42601", false}, // syntax_error
+		{"42P01", false}, // undefined_table
+		{"55000", false}, // object_not_in_prerequisite_state
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isTransientSQLState(tt.code); got != tt.want {
+			t.Errorf("isTransientSQLState(%q) = %v; want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	s := &Store{}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("upsert: %w", context.DeadlineExceeded), true},
+		{"serialization", fmt.Errorf("upsert: %w", &pgconn.PgError{Code: "40001"}), true},
+		{"constraint", fmt.Errorf("upsert: %w", &pgconn.PgError{Code: "23505"}), false},
+		{"connection", errors.New("dial tcp: connection refused"), true},
+	}
+	for _, tt := range tests {
+		if got := s.IsTransient(tt.err); got != tt.want {
+			t.Errorf("%s: IsTransient = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
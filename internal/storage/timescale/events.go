@@ -0,0 +1,40 @@
+package timescale
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// ReplaceSSEEvents writes a request's SSE events using the COPY protocol.
+// Existing events for the request are deleted first so a retried or replayed
+// job cannot duplicate them.
+func (s *Store) ReplaceSSEEvents(ctx context.Context, b *storage.SSEEventBatch) error {
+	keyID := nilIfEmpty(b.KeyID)
+	rows := make([][]interface{}, len(b.Events))
+	for i, ev := range b.Events {
+		rows[i] = []interface{}{
+			b.TS,
+			b.RequestID,
+			ev.Index,
+			ev.EventType,
+			ev.RawData,
+			ev.RawBytes,
+			keyID,
+			nilIfZero(ev.OffsetMs),
+		}
+	}
+
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM sse_events WHERE request_id = $1 AND ts = $2`, b.RequestID, b.TS); err != nil {
+			return err
+		}
+		_, err := tx.CopyFrom(ctx,
+			pgx.Identifier{"sse_events"},
+			[]string{"ts", "request_id", "event_index", "event_type", "data_json", "raw_bytes", "key_id", "offset_ms"},
+			pgx.CopyFromRows(rows),
+		)
+		return err
+	})
+}
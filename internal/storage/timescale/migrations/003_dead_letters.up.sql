@@ -0,0 +1,12 @@
+-- Dead letters: write jobs that failed permanently or exhausted their retries
+CREATE TABLE IF NOT EXISTS write_dead_letters (
+    id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    kind        TEXT NOT NULL,
+    payload     JSONB NOT NULL,
+    error       TEXT NOT NULL,
+    attempts    INTEGER NOT NULL DEFAULT 0,
+    replayed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_write_dead_letters_pending ON write_dead_letters (id) WHERE replayed_at IS NULL;
@@ -0,0 +1,5 @@
+-- Usage and response updates may arrive before the proxy's insert, in which
+-- case they create the row and the insert fills in the request metadata.
+ALTER TABLE requests
+    ALTER COLUMN method DROP NOT NULL,
+    ALTER COLUMN path   DROP NOT NULL;
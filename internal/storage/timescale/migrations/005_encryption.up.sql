@@ -0,0 +1,7 @@
+-- Master key ID for application-level envelope encryption. NULL means the
+-- row holds plaintext (or values sealed under different keys) and is picked
+-- up by `sidekick keys rotate`.
+ALTER TABLE request_payloads   ADD COLUMN IF NOT EXISTS key_id TEXT;
+ALTER TABLE sse_events         ADD COLUMN IF NOT EXISTS key_id TEXT;
+ALTER TABLE accounts           ADD COLUMN IF NOT EXISTS key_id TEXT;
+ALTER TABLE write_dead_letters ADD COLUMN IF NOT EXISTS key_id TEXT;
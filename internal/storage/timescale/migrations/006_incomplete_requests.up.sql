@@ -0,0 +1,3 @@
+-- Streamed requests whose response never finished (the proxy never published
+-- the end-of-stream marker). Their usage, if any, is partial.
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS incomplete BOOLEAN NOT NULL DEFAULT FALSE;
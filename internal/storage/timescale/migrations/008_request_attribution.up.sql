@@ -0,0 +1,7 @@
+-- Who sent a request: a fingerprint of the client's credential and the
+-- conversation it belongs to, for filtering traffic by key or session.
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS key_fingerprint TEXT;
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS conversation_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_requests_key_ts ON requests (key_fingerprint, ts DESC) WHERE key_fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_requests_conversation_ts ON requests (conversation_id, ts DESC) WHERE conversation_id IS NOT NULL;
@@ -0,0 +1,27 @@
+-- Full-text search over prompts and responses. The text of the new user turn
+-- and of the response is stored alongside the payload (it is not written
+-- when encryption at rest is enabled) and search_tsv is kept up to date on
+-- every write. Sealed system prompts (key_id set) are not indexed. Requests
+-- recorded before this migration become searchable once `sidekick reindex`
+-- has filled in their text.
+ALTER TABLE request_payloads
+    ADD COLUMN IF NOT EXISTS user_text     TEXT,
+    ADD COLUMN IF NOT EXISTS response_text TEXT,
+    ADD COLUMN IF NOT EXISTS search_tsv    TSVECTOR;
+
+CREATE OR REPLACE FUNCTION request_payloads_search_tsv() RETURNS trigger AS $$
+BEGIN
+    NEW.search_tsv :=
+        setweight(to_tsvector('english', COALESCE(NEW.user_text, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(NEW.response_text, '')), 'B') ||
+        setweight(to_tsvector('english', CASE WHEN NEW.key_id IS NULL THEN COALESCE(NEW.system_prompt, '') ELSE '' END), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS request_payloads_search ON request_payloads;
+CREATE TRIGGER request_payloads_search
+    BEFORE INSERT OR UPDATE OF user_text, response_text, system_prompt, key_id ON request_payloads
+    FOR EACH ROW EXECUTE FUNCTION request_payloads_search_tsv();
+
+CREATE INDEX IF NOT EXISTS idx_request_payloads_search ON request_payloads USING GIN (search_tsv);
@@ -0,0 +1,5 @@
+-- Requests imported from clients' local history (sidekick import) rather
+-- than proxied. They are matched to proxied traffic by API message ID.
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS imported BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_requests_message_id ON requests (message_id) WHERE message_id IS NOT NULL;
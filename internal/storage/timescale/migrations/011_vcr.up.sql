@@ -0,0 +1,7 @@
+-- Record/playback (VCR_MODE): a hash of each request's normalized body to
+-- match new requests against recorded ones, and when each SSE event arrived
+-- so streams can be played back with their original timing.
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS request_hash TEXT;
+ALTER TABLE sse_events ADD COLUMN IF NOT EXISTS offset_ms INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_requests_hash_ts ON requests (request_hash, ts DESC) WHERE request_hash IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Requests answered from the response cache instead of upstream. They are
+-- recorded at zero cost.
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS cache_hit BOOLEAN NOT NULL DEFAULT FALSE;
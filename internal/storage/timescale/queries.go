@@ -0,0 +1,246 @@
+package timescale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/stream"
+)
+
+const requestColumns = `
+	id, ts, COALESCE(method, ''), COALESCE(path, ''), COALESCE(status_code, 0),
+	COALESCE(success, FALSE), incomplete, COALESCE(error_message, ''), COALESCE(response_time_ms, 0),
+	COALESCE(model, ''), COALESCE(is_stream, FALSE), COALESCE(input_tokens, 0), COALESCE(output_tokens, 0),
+	COALESCE(cache_read_tokens, 0), COALESCE(cache_creation_tokens, 0), COALESCE(total_tokens, 0),
+	COALESCE(cost_usd, 0)::float8, COALESCE(tokens_per_second, 0)::float4, COALESCE(stop_reason, ''),
+	COALESCE(message_id, ''), COALESCE(agent_used, ''), COALESCE(key_fingerprint, ''),
+	COALESCE(conversation_id, ''), COALESCE(tool_count, 0), COALESCE(thinking_budget_tokens, 0), imported, cache_hit`
+
+func scanRequest(row pgx.Row) (storage.Request, error) {
+	var r storage.Request
+	err := row.Scan(&r.ID, &r.Timestamp, &r.Method, &r.Path, &r.StatusCode,
+		&r.Success, &r.Incomplete, &r.ErrorMessage, &r.ResponseTimeMs,
+		&r.Model, &r.IsStream, &r.InputTokens, &r.OutputTokens,
+		&r.CacheReadTokens, &r.CacheCreationTokens, &r.TotalTokens,
+		&r.CostUSD, &r.TokensPerSecond, &r.StopReason,
+		&r.MessageID, &r.Agent, &r.KeyFingerprint,
+		&r.ConversationID, &r.ToolCount, &r.ThinkingBudgetTokens, &r.Imported, &r.CacheHit)
+	return r, err
+}
+
+// requestWhere renders f's conditions (except its cursor and limit) as a
+// WHERE clause with placeholders $1..$len(args).
+func requestWhere(f *storage.RequestFilter) (string, []any) {
+	var where []string
+	var args []any
+	// add appends a condition, numbering its ? placeholders.
+	add := func(cond string, arg ...any) {
+		for _, a := range arg {
+			args = append(args, a)
+			cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		where = append(where, cond)
+	}
+	if !f.From.IsZero() {
+		add("ts >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		add("ts < ?", f.To)
+	}
+	if f.Model != "" {
+		add("model = ?", f.Model)
+	}
+	if f.StatusCode != 0 {
+		add("status_code = ?", f.StatusCode)
+	}
+	switch f.Outcome {
+	case storage.OutcomeSuccess:
+		add("success")
+	case storage.OutcomeError:
+		add("NOT COALESCE(success, FALSE) AND NOT incomplete")
+	case storage.OutcomeIncomplete:
+		add("incomplete")
+	}
+	if f.Key != "" {
+		add("key_fingerprint = ?", f.Key)
+	}
+	if f.Conversation != "" {
+		add("conversation_id = ?", f.Conversation)
+	}
+	if f.Agent != "" {
+		add("agent_used = ?", f.Agent)
+	}
+	if f.StopReason != "" {
+		add("stop_reason = ?", f.StopReason)
+	}
+	if f.Text != "" {
+		add("id IN (SELECT request_id FROM request_payloads WHERE search_tsv @@ websearch_to_tsquery('english', ?))", f.Text)
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+func (s *Store) ListRequests(ctx context.Context, f *storage.RequestFilter) ([]storage.Request, error) {
+	where, args := requestWhere(f)
+	cmp, order := "<", "DESC"
+	if f.Ascending {
+		cmp, order = ">", "ASC"
+	}
+	if f.After != nil {
+		cond := fmt.Sprintf("(ts, id) %s ($%d, $%d)", cmp, len(args)+1, len(args)+2)
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, f.After.TS, f.After.ID)
+	}
+	args = append(args, f.Limit)
+
+	rows, err := s.pool.Query(ctx, `SELECT `+requestColumns+` FROM requests`+where+
+		fmt.Sprintf(` ORDER BY ts %s, id %s LIMIT $%d`, order, order, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.Request, error) {
+		return scanRequest(row)
+	})
+}
+
+const usageColumns = `
+	COUNT(*), COUNT(*) FILTER (WHERE NOT COALESCE(success, FALSE)),
+	COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+	COALESCE(SUM(cache_read_tokens), 0), COALESCE(SUM(cache_creation_tokens), 0),
+	COALESCE(SUM(cost_usd), 0)::float8`
+
+func usageDest(u *storage.UsageTotals) []any {
+	return []any{&u.Requests, &u.Errors, &u.InputTokens, &u.OutputTokens,
+		&u.CacheReadTokens, &u.CacheCreationTokens, &u.CostUSD}
+}
+
+func (s *Store) UsageOverTime(ctx context.Context, f *storage.RequestFilter, bucket time.Duration) ([]storage.UsageBucket, error) {
+	where, args := requestWhere(f)
+	args = append(args, bucket.Seconds())
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(`
+		SELECT time_bucket(make_interval(secs => $%d), ts) AS bucket, `, len(args))+usageColumns+`
+		FROM requests`+where+`
+		GROUP BY bucket
+		ORDER BY bucket`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.UsageBucket, error) {
+		var b storage.UsageBucket
+		err := row.Scan(append([]any{&b.Start}, usageDest(&b.UsageTotals)...)...)
+		return b, err
+	})
+}
+
+var dimensionColumns = map[string]string{
+	"model":        "COALESCE(model, '')",
+	"agent":        "COALESCE(agent_used, '')",
+	"status":       "COALESCE(status_code, 0)::text",
+	"key":          "COALESCE(key_fingerprint, '')",
+	"conversation": "COALESCE(conversation_id, '')",
+	"stop_reason":  "COALESCE(stop_reason, '')",
+}
+
+func (s *Store) UsageBy(ctx context.Context, f *storage.RequestFilter, dimension string) ([]storage.UsageGroup, error) {
+	col, ok := dimensionColumns[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown dimension %q", dimension)
+	}
+	where, args := requestWhere(f)
+	args = append(args, f.Limit)
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+col+` AS grp, `+usageColumns+`
+		FROM requests`+where+`
+		GROUP BY grp
+		ORDER BY 8 DESC, 2 DESC`+fmt.Sprintf(`
+		LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.UsageGroup, error) {
+		var g storage.UsageGroup
+		err := row.Scan(append([]any{&g.Key}, usageDest(&g.UsageTotals)...)...)
+		return g, err
+	})
+}
+
+func (s *Store) GetRequest(ctx context.Context, requestID uuid.UUID) (*storage.Request, error) {
+	r, err := scanRequest(s.pool.QueryRow(ctx, `
+		SELECT `+requestColumns+`
+		FROM requests
+		WHERE id = $1
+		ORDER BY ts DESC
+		LIMIT 1`, requestID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) LatestRecording(ctx context.Context, requestHash string) (*storage.Request, error) {
+	r, err := scanRequest(s.pool.QueryRow(ctx, `
+		SELECT `+requestColumns+`
+		FROM requests
+		WHERE request_hash = $1 AND success AND NOT incomplete
+		ORDER BY ts DESC
+		LIMIT 1`, requestHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) ExistingMessageIDs(ctx context.Context, messageIDs []string) (map[string]bool, error) {
+	out := make(map[string]bool)
+	if len(messageIDs) == 0 {
+		return out, nil
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT DISTINCT message_id FROM requests
+		WHERE message_id = ANY($1)`, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		out[id] = true
+	}
+	return out, nil
+}
+
+func (s *Store) ListSSEEvents(ctx context.Context, requestID uuid.UUID) ([]stream.SSEEvent, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT event_index, event_type, COALESCE(data_json::text, ''), COALESCE(raw_bytes, 0), COALESCE(offset_ms, 0)
+		FROM sse_events
+		WHERE request_id = $1
+		ORDER BY event_index`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (stream.SSEEvent, error) {
+		var ev stream.SSEEvent
+		err := row.Scan(&ev.Index, &ev.EventType, &ev.RawData, &ev.RawBytes, &ev.OffsetMs)
+		return ev, err
+	})
+}
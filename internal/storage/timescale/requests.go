@@ -0,0 +1,218 @@
+package timescale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func (s *Store) UpsertRequest(ctx context.Context, r *storage.RequestRecord) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO requests (
+			id, ts, method, path, account_id, status_code, success, error_message,
+			response_time_ms, failover_attempts, model, input_tokens, output_tokens,
+			cache_read_tokens, cache_creation_tokens, total_tokens, cost_usd,
+			tokens_per_second, is_stream, agent_used, tool_count, thinking_budget_tokens,
+			key_fingerprint, conversation_id, imported, request_hash, cache_hit
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,$27)
+		ON CONFLICT (id, ts) DO UPDATE SET
+			method = EXCLUDED.method,
+			path = EXCLUDED.path,
+			account_id = EXCLUDED.account_id,
+			status_code = EXCLUDED.status_code,
+			success = (EXCLUDED.success OR COALESCE(requests.success, FALSE)) AND NOT requests.incomplete,
+			error_message = COALESCE(EXCLUDED.error_message, requests.error_message),
+			response_time_ms = EXCLUDED.response_time_ms,
+			failover_attempts = EXCLUDED.failover_attempts,
+			model = COALESCE(requests.model, EXCLUDED.model),
+			is_stream = EXCLUDED.is_stream,
+			agent_used = COALESCE(EXCLUDED.agent_used, requests.agent_used),
+			tool_count = EXCLUDED.tool_count,
+			thinking_budget_tokens = EXCLUDED.thinking_budget_tokens,
+			key_fingerprint = COALESCE(EXCLUDED.key_fingerprint, requests.key_fingerprint),
+			conversation_id = COALESCE(EXCLUDED.conversation_id, requests.conversation_id),
+			imported = EXCLUDED.imported,
+			request_hash = COALESCE(EXCLUDED.request_hash, requests.request_hash),
+			cache_hit = EXCLUDED.cache_hit`,
+		r.ID, r.Timestamp, r.Method, r.Path, r.AccountID,
+		r.StatusCode, r.Success, nilIfEmpty(r.ErrorMessage),
+		r.ResponseTimeMs, r.FailoverAttempts, nilIfEmpty(r.Model),
+		r.InputTokens, r.OutputTokens, r.CacheReadTokens, r.CacheCreationTokens,
+		r.TotalTokens, r.CostUSD, r.TokensPerSecond, r.IsStream, nilIfEmpty(r.AgentUsed),
+		nilIfZero(r.ToolCount), nilIfZero(r.ThinkingBudgetTokens),
+		nilIfEmpty(r.KeyFingerprint), nilIfEmpty(r.ConversationID), r.Imported,
+		nilIfEmpty(r.RequestHash), r.CacheHit,
+	)
+	return err
+}
+
+func (s *Store) UpsertRequestUsage(ctx context.Context, u *storage.RequestUsage) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO requests (
+			id, ts, model, input_tokens, output_tokens, cache_read_tokens,
+			cache_creation_tokens, total_tokens, cost_usd, tokens_per_second,
+			stop_reason, message_id, success
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,TRUE)
+		ON CONFLICT (id, ts) DO UPDATE SET
+			model = COALESCE(EXCLUDED.model, requests.model),
+			input_tokens = EXCLUDED.input_tokens,
+			output_tokens = EXCLUDED.output_tokens,
+			cache_read_tokens = EXCLUDED.cache_read_tokens,
+			cache_creation_tokens = EXCLUDED.cache_creation_tokens,
+			total_tokens = EXCLUDED.total_tokens,
+			cost_usd = EXCLUDED.cost_usd,
+			tokens_per_second = EXCLUDED.tokens_per_second,
+			stop_reason = COALESCE(EXCLUDED.stop_reason, requests.stop_reason),
+			message_id = COALESCE(EXCLUDED.message_id, requests.message_id),
+			success = NOT requests.incomplete`,
+		u.RequestID, u.TS, nilIfEmpty(u.Model),
+		u.InputTokens, u.OutputTokens, u.CacheRead, u.CacheCreation,
+		u.TotalTokens, u.CostUSD, u.TokensPerSec,
+		nilIfEmpty(u.StopReason), nilIfEmpty(u.MessageID),
+	)
+	return err
+}
+
+func (s *Store) MarkRequestIncomplete(ctx context.Context, r *storage.RequestIncomplete) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO requests (id, ts, success, incomplete, error_message)
+		VALUES ($1, $2, FALSE, TRUE, $3)
+		ON CONFLICT (id, ts) DO UPDATE SET
+			success = FALSE,
+			incomplete = TRUE,
+			error_message = COALESCE(requests.error_message, EXCLUDED.error_message)`,
+		r.RequestID, r.TS, r.Reason,
+	)
+	return err
+}
+
+// mergedKeyID keeps a payload row's key_id only while every write to the row
+// used the same master key. Rows sealed under several keys get "*", so key
+// rotation revisits them and still knows them sealed; rows mixing sealed and
+// plaintext writes get NULL.
+const mergedKeyID = `CASE
+	WHEN request_payloads.key_id = EXCLUDED.key_id THEN EXCLUDED.key_id
+	WHEN request_payloads.key_id IS NOT NULL AND EXCLUDED.key_id IS NOT NULL THEN '*'
+END`
+
+func (s *Store) UpsertPayload(ctx context.Context, p *storage.PayloadRecord) error {
+	reqH, _ := json.Marshal(p.ReqHeaders)
+	respH, _ := json.Marshal(p.RespHeaders)
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO request_payloads (
+			request_id, ts, request_headers, request_body, response_headers, response_body,
+			system_prompt, max_tokens, temperature, top_p, message_count, stop_sequence, key_id,
+			user_text, response_text
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (request_id, ts) DO UPDATE SET
+			request_headers = EXCLUDED.request_headers,
+			request_body = EXCLUDED.request_body,
+			response_headers = EXCLUDED.response_headers,
+			response_body = COALESCE(EXCLUDED.response_body, request_payloads.response_body),
+			system_prompt = EXCLUDED.system_prompt,
+			max_tokens = EXCLUDED.max_tokens,
+			temperature = EXCLUDED.temperature,
+			top_p = EXCLUDED.top_p,
+			message_count = EXCLUDED.message_count,
+			stop_sequence = COALESCE(EXCLUDED.stop_sequence, request_payloads.stop_sequence),
+			user_text = EXCLUDED.user_text,
+			response_text = COALESCE(EXCLUDED.response_text, request_payloads.response_text),
+			key_id = `+mergedKeyID,
+		p.RequestID, p.TS, reqH, rawJSON(p.ReqBody), respH, rawJSON(p.RespBody),
+		nilIfEmpty(p.Extras.SystemPrompt), nilIfZero(p.Extras.MaxTokens),
+		p.Extras.Temperature, p.Extras.TopP,
+		nilIfZero(p.Extras.MessageCount), p.Extras.StopSequence, nilIfEmpty(p.KeyID),
+		nilIfEmpty(p.Extras.UserText), nilIfEmpty(p.Extras.ResponseText),
+	)
+	return err
+}
+
+func (s *Store) UpsertPayloadResponse(ctx context.Context, p *storage.PayloadResponse) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO request_payloads (request_id, ts, response_body, stop_sequence, response_text, key_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (request_id, ts) DO UPDATE SET
+			response_body = EXCLUDED.response_body,
+			stop_sequence = COALESCE(EXCLUDED.stop_sequence, request_payloads.stop_sequence),
+			response_text = EXCLUDED.response_text,
+			key_id = `+mergedKeyID,
+		p.RequestID, p.TS, rawJSON(p.RespBody), p.StopSequence, nilIfEmpty(p.ResponseText), nilIfEmpty(p.KeyID),
+	)
+	return err
+}
+
+func (s *Store) GetPayload(ctx context.Context, requestID uuid.UUID) (*storage.PayloadRecord, error) {
+	p := &storage.PayloadRecord{RequestID: requestID}
+	var reqH, respH []byte
+	var systemPrompt *string
+	var maxTokens, messageCount *int
+	var keyID *string
+	err := s.pool.QueryRow(ctx, `
+		SELECT ts, request_headers, request_body, response_headers, response_body,
+			system_prompt, max_tokens, temperature, top_p, message_count, stop_sequence, key_id
+		FROM request_payloads
+		WHERE request_id = $1
+		ORDER BY ts DESC
+		LIMIT 1`, requestID,
+	).Scan(&p.TS, &reqH, &p.ReqBody, &respH, &p.RespBody,
+		&systemPrompt, &maxTokens, &p.Extras.Temperature, &p.Extras.TopP, &messageCount,
+		&p.Extras.StopSequence, &keyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	unmarshalHeaders(reqH, &p.ReqHeaders)
+	unmarshalHeaders(respH, &p.RespHeaders)
+	p.Extras.SystemPrompt = deref(systemPrompt)
+	p.Extras.MaxTokens = derefInt(maxTokens)
+	p.Extras.MessageCount = derefInt(messageCount)
+	p.KeyID = deref(keyID)
+	return p, nil
+}
+
+func unmarshalHeaders(raw []byte, h *map[string][]string) {
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, h)
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefInt(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func nilIfZero(i int) *int {
+	if i == 0 {
+		return nil
+	}
+	return &i
+}
+
+func rawJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return json.RawMessage(b)
+}
@@ -0,0 +1,60 @@
+package timescale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage/storagetest"
+)
+
+// openTestStore connects to the scratch database at DATABASE_URL, or skips
+// the test when none is set.
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	s, err := Open(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRequestJobsAnyOrder(t *testing.T) {
+	s := openTestStore(t)
+	storagetest.RequestJobsAnyOrder(t, s, func(t *testing.T, id uuid.UUID) storagetest.Row {
+		t.Helper()
+		var r storagetest.Row
+		err := s.pool.QueryRow(context.Background(), `
+			SELECT r.status_code, r.success, r.incomplete, r.error_message, r.model, r.agent_used,
+				r.input_tokens, r.output_tokens, r.cost_usd, r.stop_reason, r.message_id,
+				p.response_body::text, p.response_text, p.user_text, p.stop_sequence, p.system_prompt
+			FROM requests r JOIN request_payloads p ON p.request_id = r.id AND p.ts = r.ts
+			WHERE r.id = $1`, id,
+		).Scan(&r.StatusCode, &r.Success, &r.Incomplete, &r.ErrorMessage, &r.Model, &r.AgentUsed,
+			&r.InputTokens, &r.OutputTokens, &r.CostUSD, &r.StopReason, &r.MessageID,
+			&r.RespBody, &r.RespText, &r.UserText, &r.StopSequence, &r.SystemPrompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// jsonb re-renders bodies; compare them as written.
+		if r.RespBody.Valid {
+			var b bytes.Buffer
+			if json.Compact(&b, []byte(r.RespBody.String)) == nil {
+				r.RespBody.String = b.String()
+			}
+		}
+		return r
+	})
+}
@@ -0,0 +1,146 @@
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type column struct {
+	name    string
+	sqlType string
+}
+
+// sealedTables lists every table holding values encrypted at rest, with the
+// primary key used to address rows, the encrypted columns and the plaintext
+// derived from them that is dropped once they are sealed.
+var sealedTables = []struct {
+	table   string
+	keys    []column
+	columns []column
+	cleared []string
+}{
+	{
+		table:   "request_payloads",
+		keys:    []column{{"request_id", "uuid"}, {"ts", "timestamptz"}},
+		columns: []column{{"request_body", "jsonb"}, {"response_body", "jsonb"}, {"system_prompt", "text"}},
+		cleared: []string{"user_text", "response_text"},
+	},
+	{
+		table:   "sse_events",
+		keys:    []column{{"id", "bigint"}, {"ts", "timestamptz"}},
+		columns: []column{{"data_json", "jsonb"}},
+	},
+	{
+		table:   "accounts",
+		keys:    []column{{"id", "uuid"}},
+		columns: []column{{"api_key", "text"}, {"refresh_token", "text"}, {"access_token", "text"}},
+	},
+	{
+		table:   "write_dead_letters",
+		keys:    []column{{"id", "bigint"}},
+		columns: []column{{"payload", "jsonb"}},
+	},
+}
+
+const resealBatchSize = 500
+
+func (s *Store) ResealRows(ctx context.Context, keyID string, reseal func([]byte, bool) ([]byte, error)) (int, error) {
+	total := 0
+	for _, t := range sealedTables {
+		for {
+			n, err := s.resealBatch(ctx, t.table, t.keys, t.columns, t.cleared, keyID, reseal)
+			if err != nil {
+				return total, fmt.Errorf("reseal %s: %w", t.table, err)
+			}
+			total += n
+			if n < resealBatchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// resealBatch rewrites up to resealBatchSize rows of one table in a single
+// transaction. Every selected row gets key_id = keyID, so repeated calls
+// make progress until no stale rows remain.
+func (s *Store) resealBatch(ctx context.Context, table string, keys, columns []column, cleared []string, keyID string, reseal func([]byte, bool) ([]byte, error)) (int, error) {
+	selectCols := make([]string, 0, 1+len(keys)+len(columns))
+	selectCols = append(selectCols, "key_id")
+	for _, c := range append(append([]column{}, keys...), columns...) {
+		selectCols = append(selectCols, c.name+"::text")
+	}
+	setCols := make([]string, 0, len(columns)+1)
+	for i, c := range columns {
+		setCols = append(setCols, fmt.Sprintf("%s = $%d::%s", c.name, i+1, c.sqlType))
+	}
+	setCols = append(setCols, fmt.Sprintf("key_id = $%d", len(columns)+1))
+	for _, c := range cleared {
+		setCols = append(setCols, c+" = NULL")
+	}
+	where := make([]string, 0, len(keys))
+	for i, c := range keys {
+		where = append(where, fmt.Sprintf("%s = $%d::%s", c.name, len(columns)+2+i, c.sqlType))
+	}
+
+	selectSQL := fmt.Sprintf(`SELECT %s FROM %s WHERE key_id IS DISTINCT FROM $1 LIMIT %d FOR UPDATE`,
+		strings.Join(selectCols, ", "), table, resealBatchSize)
+	updateSQL := fmt.Sprintf(`UPDATE %s SET %s WHERE %s`,
+		table, strings.Join(setCols, ", "), strings.Join(where, " AND "))
+
+	n := 0
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, selectSQL, keyID)
+		if err != nil {
+			return err
+		}
+		var pending [][]*string
+		for rows.Next() {
+			vals := make([]*string, 1+len(keys)+len(columns))
+			dest := make([]any, len(vals))
+			for i := range vals {
+				dest[i] = &vals[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+			pending = append(pending, vals)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, vals := range pending {
+			// A key_id marks the row's values sealed.
+			sealed := vals[0] != nil
+			vals = vals[1:]
+			args := make([]any, 0, len(vals)+1)
+			for _, v := range vals[len(keys):] {
+				if v == nil {
+					args = append(args, nil)
+					continue
+				}
+				out, err := reseal([]byte(*v), sealed)
+				if err != nil {
+					return err
+				}
+				args = append(args, string(out))
+			}
+			args = append(args, keyID)
+			for _, v := range vals[:len(keys)] {
+				args = append(args, *v)
+			}
+			if _, err := tx.Exec(ctx, updateSQL, args...); err != nil {
+				return err
+			}
+		}
+		n = len(pending)
+		return nil
+	})
+	return n, err
+}
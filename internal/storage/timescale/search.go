@@ -0,0 +1,111 @@
+package timescale
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+var headlineOptions = `StartSel="` + storage.HighlightStart + `", StopSel="` + storage.HighlightEnd + `", ` +
+	`MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`
+
+func (s *Store) Highlights(ctx context.Context, text string, requestIDs []uuid.UUID) (map[uuid.UUID][]storage.Highlight, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT request_id,
+			ts_headline('english', COALESCE(user_text, ''), q, $3),
+			ts_headline('english', COALESCE(response_text, ''), q, $3),
+			CASE WHEN key_id IS NULL THEN ts_headline('english', COALESCE(system_prompt, ''), q, $3) ELSE '' END
+		FROM request_payloads, websearch_to_tsquery('english', $1) AS q
+		WHERE request_id = ANY($2) AND search_tsv @@ q`, text, requestIDs, headlineOptions)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uuid.UUID][]storage.Highlight)
+	var id uuid.UUID
+	var user, response, system string
+	_, err = pgx.ForEachRow(rows, []any{&id, &user, &response, &system}, func() error {
+		out[id] = storage.MatchingHighlights(
+			storage.Highlight{Field: storage.FieldUser, Snippet: user},
+			storage.Highlight{Field: storage.FieldResponse, Snippet: response},
+			storage.Highlight{Field: storage.FieldSystem, Snippet: system},
+		)
+		return nil
+	})
+	return out, err
+}
+
+const backfillBatchSize = 500
+
+func (s *Store) BackfillSearchText(ctx context.Context, fill func(reqBody, respBody []byte) (string, string, error)) (int, error) {
+	total := 0
+	for {
+		n, err := s.backfillBatch(ctx, fill)
+		total += n
+		if err != nil || n < backfillBatchSize {
+			return total, err
+		}
+	}
+}
+
+// backfillBatch fills up to backfillBatchSize rows in one transaction.
+// Rows without any text get empty strings rather than NULL, so they are not
+// selected again.
+func (s *Store) backfillBatch(ctx context.Context, fill func(reqBody, respBody []byte) (string, string, error)) (int, error) {
+	n := 0
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT request_id, ts, request_body::text, response_body::text
+			FROM request_payloads
+			WHERE user_text IS NULL AND response_text IS NULL AND key_id IS NULL
+			LIMIT $1
+			FOR UPDATE`, backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		type filled struct {
+			requestID          uuid.UUID
+			ts                 time.Time
+			user, responseText string
+		}
+		var pending []filled
+		for rows.Next() {
+			var f filled
+			var reqBody, respBody *string
+			if err := rows.Scan(&f.requestID, &f.ts, &reqBody, &respBody); err != nil {
+				rows.Close()
+				return err
+			}
+			if f.user, f.responseText, err = fill(textBytes(reqBody), textBytes(respBody)); err != nil {
+				rows.Close()
+				return err
+			}
+			pending = append(pending, f)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, f := range pending {
+			_, err := tx.Exec(ctx, `
+				UPDATE request_payloads SET user_text = $1, response_text = $2
+				WHERE request_id = $3 AND ts = $4`, f.user, f.responseText, f.requestID, f.ts)
+			if err != nil {
+				return err
+			}
+		}
+		n = len(pending)
+		return nil
+	})
+	return n, err
+}
+
+func textBytes(s *string) []byte {
+	if s == nil {
+		return nil
+	}
+	return []byte(*s)
+}
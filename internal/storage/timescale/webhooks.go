@@ -0,0 +1,37 @@
+package timescale
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+func (s *Store) InsertWebhookDelivery(ctx context.Context, d *storage.WebhookDelivery) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO webhook_deliveries (created_at, endpoint, event_id, event_type, attempt, outcome, status_code, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (endpoint, event_id, attempt) DO NOTHING`,
+		d.CreatedAt, d.Endpoint, d.EventID, d.EventType, d.Attempt, d.Outcome,
+		nilIfZero(d.StatusCode), nilIfEmpty(d.Error), d.DurationMs,
+	)
+	return err
+}
+
+func (s *Store) ListWebhookDeliveries(ctx context.Context, endpoint string, failedOnly bool, limit int) ([]storage.WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, created_at, endpoint, event_id, event_type, attempt, outcome,
+		       COALESCE(status_code, 0), COALESCE(error, ''), duration_ms
+		FROM webhook_deliveries
+		WHERE ($1 = '' OR endpoint = $1) AND (NOT $2 OR outcome <> $3)
+		ORDER BY id DESC
+		LIMIT $4`, endpoint, failedOnly, storage.DeliveryDelivered, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.WebhookDelivery, error) {
+		var d storage.WebhookDelivery
+		err := row.Scan(&d.ID, &d.CreatedAt, &d.Endpoint, &d.EventID, &d.EventType, &d.Attempt, &d.Outcome, &d.StatusCode, &d.Error, &d.DurationMs)
+		return d, err
+	})
+}
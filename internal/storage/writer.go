@@ -2,40 +2,109 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/namikmesic/claude-sidekick/internal/metrics"
 	"github.com/rs/zerolog/log"
 )
 
-// WriteJob represents a unit of work to execute against the database.
+// WriteJob represents a unit of work to execute against the store.
+// Every job has a kind and a JSON payload so that a failed job can be
+// dead-lettered and rebuilt later with DecodeJob.
 type WriteJob interface {
-	Execute(ctx context.Context, pool *pgxpool.Pool) error
+	Kind() string
+	Payload() ([]byte, error)
+	Execute(ctx context.Context, store Store) error
 }
 
-// WriteJobFunc adapts a function into a WriteJob.
-type WriteJobFunc func(ctx context.Context, pool *pgxpool.Pool) error
+type typedJob[T any] struct {
+	kind string
+	args T
+	exec func(ctx context.Context, store Store, args T) error
+}
+
+func (j *typedJob[T]) Kind() string { return j.kind }
+
+func (j *typedJob[T]) Payload() ([]byte, error) { return json.Marshal(j.args) }
+
+func (j *typedJob[T]) Execute(ctx context.Context, store Store) error {
+	return j.exec(ctx, store, j.args)
+}
+
+var errShutdown = errors.New("writer shut down before job completed")
+
+var jobDecoders = make(map[string]func(json.RawMessage) (WriteJob, error))
+
+// registerJob declares a job kind and returns its constructor. The kind is
+// persisted with dead letters, so it must never change once released.
+func registerJob[T any](kind string, exec func(ctx context.Context, store Store, args T) error) func(T) WriteJob {
+	jobDecoders[kind] = func(raw json.RawMessage) (WriteJob, error) {
+		var args T
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, err
+		}
+		return &typedJob[T]{kind: kind, args: args, exec: exec}, nil
+	}
+	return func(args T) WriteJob {
+		return &typedJob[T]{kind: kind, args: args, exec: exec}
+	}
+}
+
+// DecodeJob rebuilds a job from its kind and payload.
+func DecodeJob(kind string, payload []byte) (WriteJob, error) {
+	decode, ok := jobDecoders[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown job kind %q", kind)
+	}
+	job, err := decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s job: %w", kind, err)
+	}
+	return job, nil
+}
 
-func (f WriteJobFunc) Execute(ctx context.Context, pool *pgxpool.Pool) error {
-	return f(ctx, pool)
+// WriterOptions tunes batching and retry behaviour of a BatchWriter.
+type WriterOptions struct {
+	BufferSize     int
+	BatchSize      int
+	FlushMs        int
+	MaxAttempts    int
+	RetryBackoff   time.Duration
+	MaxBackoff     time.Duration
+	JobTimeout     time.Duration
+	DeadLetterFile string
+	Cipher         Cipher // seals spooled dead letters; nil leaves them in plaintext
 }
 
 // BatchWriter collects write jobs and flushes them in batches.
 type BatchWriter struct {
-	pool      *pgxpool.Pool
-	jobs      chan WriteJob
-	batchSize int
-	flushMs   int
-	wg        sync.WaitGroup
+	store      Store
+	jobs       chan WriteJob
+	opts       WriterOptions
+	deadLetter *DeadLetterStore
+	stop       chan struct{}
+	wg         sync.WaitGroup
+	callbacks  sync.WaitGroup // EnqueueAll done callbacks not yet returned
 }
 
-func NewBatchWriter(pool *pgxpool.Pool, bufferSize, batchSize, flushMs int) *BatchWriter {
+func NewBatchWriter(store Store, opts WriterOptions) *BatchWriter {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.JobTimeout <= 0 {
+		opts.JobTimeout = 10 * time.Second
+	}
 	w := &BatchWriter{
-		pool:      pool,
-		jobs:      make(chan WriteJob, bufferSize),
-		batchSize: batchSize,
-		flushMs:   flushMs,
+		store:      store,
+		jobs:       make(chan WriteJob, opts.BufferSize),
+		opts:       opts,
+		deadLetter: NewDeadLetterStore(store, opts.DeadLetterFile, opts.Cipher),
+		stop:       make(chan struct{}),
 	}
 	w.wg.Add(1)
 	go w.loop()
@@ -46,17 +115,68 @@ func (w *BatchWriter) Enqueue(job WriteJob) {
 	select {
 	case w.jobs <- job:
 	default:
-		log.Warn().Msg("write queue full, dropping job")
+		log.Warn().Str("kind", job.Kind()).Msg("write queue full, spooling job")
+		metrics.WriterDropped()
+		err := w.deadLetter.Spool(job, fmt.Errorf("write queue full"), 0)
+		settled(job, err == nil)
+	}
+}
+
+// EnqueueAll queues jobs and calls done once every one of them has been
+// handled. done gets true if all were written, dead-lettered or spooled,
+// i.e. none of them can be lost anymore, and false if any was lost. It runs
+// on a goroutine of its own, so it may block without holding up writes.
+func (w *BatchWriter) EnqueueAll(jobs []WriteJob, done func(durable bool)) {
+	if len(jobs) == 0 {
+		done(true)
+		return
+	}
+	w.callbacks.Add(1)
+	t := &jobTracker{done: done, pending: &w.callbacks}
+	t.remaining.Store(int32(len(jobs)))
+	for _, job := range jobs {
+		w.Enqueue(&trackedJob{WriteJob: job, tracker: t})
+	}
+}
+
+type jobTracker struct {
+	remaining atomic.Int32
+	lost      atomic.Bool
+	done      func(durable bool)
+	pending   *sync.WaitGroup
+}
+
+// trackedJob reports its completion to a jobTracker. Kind and Payload are
+// those of the wrapped job, so it dead-letters and replays like the original.
+type trackedJob struct {
+	WriteJob
+	tracker *jobTracker
+}
+
+// settled marks a job as handled; durable is false if it was lost.
+func settled(job WriteJob, durable bool) {
+	t, ok := job.(*trackedJob)
+	if !ok {
+		return
+	}
+	if !durable {
+		t.tracker.lost.Store(true)
+	}
+	if t.tracker.remaining.Add(-1) == 0 {
+		go func() {
+			defer t.tracker.pending.Done()
+			t.tracker.done(!t.tracker.lost.Load())
+		}()
 	}
 }
 
 func (w *BatchWriter) loop() {
 	defer w.wg.Done()
 
-	ticker := time.NewTicker(time.Duration(w.flushMs) * time.Millisecond)
+	ticker := time.NewTicker(time.Duration(w.opts.FlushMs) * time.Millisecond)
 	defer ticker.Stop()
 
-	batch := make([]WriteJob, 0, w.batchSize)
+	batch := make([]WriteJob, 0, w.opts.BatchSize)
 
 	for {
 		select {
@@ -66,7 +186,7 @@ func (w *BatchWriter) loop() {
 				return
 			}
 			batch = append(batch, job)
-			if len(batch) >= w.batchSize {
+			if len(batch) >= w.opts.BatchSize {
 				w.flush(batch)
 				batch = batch[:0]
 			}
@@ -80,21 +200,78 @@ func (w *BatchWriter) loop() {
 }
 
 func (w *BatchWriter) flush(batch []WriteJob) {
-	if len(batch) == 0 {
-		return
+	start := time.Now()
+	for _, job := range batch {
+		settled(job, w.execute(job))
+	}
+	if len(batch) > 0 {
+		metrics.WriterFlush(time.Since(start).Seconds())
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// QueueDepth returns the number of jobs waiting to be written.
+func (w *BatchWriter) QueueDepth() int {
+	return len(w.jobs)
+}
 
-	for _, job := range batch {
-		if err := job.Execute(ctx, w.pool); err != nil {
-			log.Error().Err(err).Msg("write job failed")
+// execute runs a job, retrying transient failures with exponential backoff.
+// Permanent failures and jobs that exhaust their attempts are dead-lettered.
+// It reports whether the job was written or dead-lettered, i.e. not lost.
+func (w *BatchWriter) execute(job WriteJob) bool {
+	select {
+	case <-w.stop:
+		// Shutdown deadline passed: keep the job for replay instead of
+		// blocking on a database that is likely unreachable.
+		return w.deadLetter.Spool(job, errShutdown, 0) == nil
+	default:
+	}
+
+	backoff := w.opts.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), w.opts.JobTimeout)
+		err := job.Execute(ctx, w.store)
+		cancel()
+		if err == nil {
+			return true
+		}
+
+		if !w.store.IsTransient(err) || attempt >= w.opts.MaxAttempts {
+			log.Error().Err(err).
+				Str("kind", job.Kind()).
+				Int("attempts", attempt).
+				Bool("transient", w.store.IsTransient(err)).
+				Msg("write job failed, dead-lettering")
+			return w.deadLetter.Put(job, err, attempt) == nil
 		}
+
+		log.Warn().Err(err).
+			Str("kind", job.Kind()).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msg("write job failed, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-w.stop:
+			return w.deadLetter.Spool(job, err, attempt) == nil
+		}
+		backoff = min(backoff*2, w.opts.MaxBackoff)
 	}
 }
 
 func (w *BatchWriter) Shutdown() {
 	close(w.jobs)
-	w.wg.Wait()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		close(w.stop)
+		<-done
+	}
+	// Every job is settled now; let their callbacks finish acking.
+	w.callbacks.Wait()
 }
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// failingStore rejects every request write and, unless deadLetters is set,
+// every dead letter.
+type failingStore struct {
+	Store
+	deadLetters bool
+}
+
+var errRejected = errors.New("rejected")
+
+func (s *failingStore) IsTransient(error) bool { return false }
+
+func (s *failingStore) UpsertRequest(context.Context, *RequestRecord) error { return errRejected }
+
+func (s *failingStore) InsertDeadLetters(context.Context, []DeadLetter) error {
+	if s.deadLetters {
+		return nil
+	}
+	return errRejected
+}
+
+func TestEnqueueAllReportsDurability(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "spool.jsonl")
+	tests := []struct {
+		name  string
+		store *failingStore
+		spool string
+		want  bool
+	}{
+		{"dead-lettered", &failingStore{deadLetters: true}, "", true},
+		{"spooled", &failingStore{}, spool, true},
+		{"lost", &failingStore{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewBatchWriter(tt.store, WriterOptions{
+				BufferSize:     10,
+				BatchSize:      10,
+				FlushMs:        10,
+				MaxAttempts:    1,
+				DeadLetterFile: tt.spool,
+			})
+			defer w.Shutdown()
+
+			got := make(chan bool, 1)
+			w.EnqueueAll([]WriteJob{
+				InsertRequestJob(&RequestRecord{ID: uuid.New(), Timestamp: time.Now()}),
+				InsertRequestJob(&RequestRecord{ID: uuid.New(), Timestamp: time.Now()}),
+			}, func(durable bool) { got <- durable })
+
+			select {
+			case durable := <-got:
+				if durable != tt.want {
+					t.Errorf("durable = %v; want %v", durable, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("done not called")
+			}
+			if tt.spool != "" {
+				if fi, err := os.Stat(tt.spool); err != nil || fi.Size() == 0 {
+					t.Errorf("spool not written: %v", err)
+				}
+			}
+		})
+	}
+}
+
+type acceptingStore struct{ Store }
+
+func (acceptingStore) UpsertRequest(context.Context, *RequestRecord) error { return nil }
+
+func TestEnqueueAllCallbackDoesNotBlockWrites(t *testing.T) {
+	w := NewBatchWriter(acceptingStore{}, WriterOptions{BufferSize: 10, BatchSize: 1, FlushMs: 10})
+	release := make(chan struct{})
+	job := func() WriteJob {
+		return InsertRequestJob(&RequestRecord{ID: uuid.New(), Timestamp: time.Now()})
+	}
+
+	w.EnqueueAll([]WriteJob{job()}, func(bool) { <-release })
+	second := make(chan struct{})
+	w.EnqueueAll([]WriteJob{job()}, func(bool) { close(second) })
+
+	select {
+	case <-second:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a blocked callback held up the writer")
+	}
+	close(release)
+	w.Shutdown()
+}
+
+// scriptedStore fails request writes with errs in turn, then accepts them.
+// Dead letters are recorded unless deadLetterErr is set.
+type scriptedStore struct {
+	Store
+	mu            sync.Mutex
+	errs          []error
+	attempts      int
+	deadLetters   []DeadLetter
+	deadLetterErr error
+}
+
+var errBusy = errors.New("busy")
+
+func (s *scriptedStore) IsTransient(err error) bool { return errors.Is(err, errBusy) }
+
+func (s *scriptedStore) UpsertRequest(context.Context, *RequestRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *scriptedStore) InsertDeadLetters(_ context.Context, dls []DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deadLetterErr != nil {
+		return s.deadLetterErr
+	}
+	s.deadLetters = append(s.deadLetters, dls...)
+	return nil
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name          string
+		errs          []error
+		deadLetterErr error
+		wantAttempts  int
+		wantDead      int  // dead letters stored in the database
+		wantSpooled   bool // dead letter appended to the spool file
+	}{
+		{"transient then written", []error{errBusy, errBusy}, nil, 3, 0, false},
+		{"permanent dead-lettered", []error{errRejected}, nil, 1, 1, false},
+		{"attempts exhausted", []error{errBusy, errBusy, errBusy, errBusy}, nil, 3, 1, false},
+		{"dead letter spooled", []error{errRejected}, errRejected, 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &scriptedStore{errs: tt.errs, deadLetterErr: tt.deadLetterErr}
+			spool := filepath.Join(t.TempDir(), "spool.jsonl")
+			w := NewBatchWriter(store, WriterOptions{
+				BufferSize:     1,
+				BatchSize:      1,
+				FlushMs:        10,
+				MaxAttempts:    3,
+				RetryBackoff:   time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+				DeadLetterFile: spool,
+			})
+			defer w.Shutdown()
+
+			if !w.execute(InsertRequestJob(&RequestRecord{ID: uuid.New(), Timestamp: time.Now()})) {
+				t.Fatal("job lost")
+			}
+			if store.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d; want %d", store.attempts, tt.wantAttempts)
+			}
+			if len(store.deadLetters) != tt.wantDead {
+				t.Fatalf("dead letters = %d; want %d", len(store.deadLetters), tt.wantDead)
+			}
+			if tt.wantDead > 0 {
+				dl := store.deadLetters[0]
+				if dl.Kind != "insert_request" || dl.Attempts != store.attempts {
+					t.Errorf("dead letter = %s after %d attempts; want insert_request after %d", dl.Kind, dl.Attempts, store.attempts)
+				}
+			}
+			_, err := os.Stat(spool)
+			if spooled := err == nil; spooled != tt.wantSpooled {
+				t.Errorf("spooled = %v; want %v", spooled, tt.wantSpooled)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ type SSEEvent struct {
 	EventType string // message_start, content_block_delta, message_delta, etc.
 	RawData   string // raw JSON string from the data: line
 	RawBytes  int    // byte length of this SSE frame
+	OffsetMs  int    // when the event arrived, relative to the request; 0 if unknown
 }
 
 // Anthropic SSE message_start payload (for usage extraction).
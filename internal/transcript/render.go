@@ -0,0 +1,148 @@
+package transcript
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	switch format {
+	case "markdown":
+		return "text/markdown; charset=utf-8"
+	case "html":
+		return "text/html; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Render writes t in one of Formats.
+func Render(w io.Writer, t *Transcript, format string) error {
+	switch format {
+	case "markdown":
+		_, err := io.WriteString(w, Markdown(t))
+		return err
+	case "html":
+		return page.Execute(w, t)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	default:
+		return fmt.Errorf("unknown format %q: want markdown, html or json", format)
+	}
+}
+
+// Title describes what the transcript covers.
+func (t *Transcript) Title() string {
+	if t.RequestID != "" {
+		return "Request " + t.RequestID
+	}
+	return "Conversation " + t.ConversationID
+}
+
+// Summary is a one-line overview: requests, models, time span and cost.
+func (t *Transcript) Summary() string {
+	s := fmt.Sprintf("%d request", t.Requests)
+	if t.Requests != 1 {
+		s += "s"
+	}
+	if len(t.Models) > 0 {
+		s += " · " + strings.Join(t.Models, ", ")
+	}
+	s += " · " + t.Start.UTC().Format("2006-01-02 15:04:05")
+	if t.End.After(t.Start) {
+		s += " – " + t.End.UTC().Format("15:04:05") + " UTC (" + t.End.Sub(t.Start).Round(time.Second).String() + ")"
+	} else {
+		s += " UTC"
+	}
+	return s + fmt.Sprintf(" · $%.4f", t.CostUSD)
+}
+
+// Markdown renders t for pasting into a code review or issue. Long or
+// secondary content (system prompts, thinking, tool results) is folded into
+// <details> blocks.
+func Markdown(t *Transcript) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n_%s_\n\n", t.Title(), t.Summary())
+	for _, m := range t.Messages {
+		switch m.Role {
+		case RoleSystem:
+			folded(&b, "System prompt", m.Blocks[0].Text, "text")
+			continue
+		case RoleAssistant:
+			fmt.Fprintf(&b, "## Assistant\n\n<sub>%s · %s</sub>\n\n", m.Model, m.TS.UTC().Format("15:04:05"))
+		case RoleError:
+			fmt.Fprintf(&b, "> **Error:** %s\n\n", strings.ReplaceAll(m.Blocks[0].Text, "\n", "\n> "))
+			continue
+		default:
+			fmt.Fprintf(&b, "## %s\n\n", strings.ToUpper(m.Role[:1])+m.Role[1:])
+		}
+		for _, blk := range m.Blocks {
+			switch blk.Type {
+			case "text":
+				b.WriteString(strings.TrimSpace(blk.Text) + "\n\n")
+			case "thinking":
+				folded(&b, "Thinking", blk.Text, "")
+			case "tool_use":
+				fmt.Fprintf(&b, "**Tool call:** `%s`\n\n", blk.ToolName)
+				fenced(&b, prettyJSON(blk.Input), "json")
+			case "tool_result":
+				summary := "Tool result"
+				if blk.ToolName != "" {
+					summary += ": " + blk.ToolName
+				}
+				if blk.IsError {
+					summary += " (error)"
+				}
+				folded(&b, summary, blk.Text, "text")
+			default:
+				fmt.Fprintf(&b, "_[%s]_\n\n", blk.Type)
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+func folded(b *strings.Builder, summary, text, lang string) {
+	fmt.Fprintf(b, "<details><summary>%s</summary>\n\n", template.HTMLEscapeString(summary))
+	if lang == "" {
+		b.WriteString(strings.TrimSpace(text) + "\n\n")
+	} else {
+		fenced(b, text, lang)
+	}
+	b.WriteString("</details>\n\n")
+}
+
+// fenced writes a code block whose fence is longer than any backtick run
+// in text.
+func fenced(b *strings.Builder, text, lang string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n\n", fence, lang, strings.TrimRight(text, "\n"), fence)
+}
+
+func prettyJSON(raw json.RawMessage) string {
+	var out bytes.Buffer
+	if json.Indent(&out, raw, "", "  ") != nil {
+		return string(raw)
+	}
+	return out.String()
+}
+
+//go:embed transcript.html
+var pageHTML string
+
+var page = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"json":  prettyJSON,
+	"clock": func(t time.Time) string { return t.UTC().Format("15:04:05") },
+}).Parse(pageHTML))
@@ -0,0 +1,266 @@
+// Package transcript reconstructs readable transcripts of conversations and
+// single requests from stored payloads, and renders them as Markdown, HTML
+// or JSON.
+//
+// A request body carries the whole conversation so far, so a conversation's
+// transcript takes from each request, oldest first, only the messages after
+// the last assistant turn (the previous response, already shown) followed by
+// its own response. The system prompt is shown whenever it changes.
+package transcript
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/processor"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// Formats Render accepts.
+var Formats = []string{"markdown", "html", "json"}
+
+// Message roles. Error messages stand for failed or incomplete responses.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleError     = "error"
+)
+
+type Transcript struct {
+	ConversationID string    `json:"conversation_id,omitempty"`
+	RequestID      string    `json:"request_id,omitempty"`
+	Requests       int       `json:"requests"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Models         []string  `json:"models"`
+	CostUSD        float64   `json:"cost_usd"`
+	Messages       []Message `json:"messages"`
+}
+
+type Message struct {
+	Role      string    `json:"role"`
+	RequestID uuid.UUID `json:"request_id"`
+	TS        time.Time `json:"ts"`
+	Model     string    `json:"model,omitempty"`
+	Blocks    []Block   `json:"blocks"`
+}
+
+// Block is one piece of message content. Type is text, thinking, tool_use,
+// tool_result or the API's type for content shown only by name (image,
+// document, ...).
+type Block struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ToolName  string          `json:"tool_name,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// Conversation builds the transcript of every stored request of a
+// conversation. Returns storage.ErrNotFound when it has none.
+func Conversation(ctx context.Context, store storage.Store, conversationID string) (*Transcript, error) {
+	f := &storage.RequestFilter{Conversation: conversationID, Limit: 500}
+	var reqs []storage.Request
+	for {
+		page, err := store.ListRequests(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, page...)
+		if len(page) < f.Limit {
+			break
+		}
+		last := page[len(page)-1]
+		f.After = &storage.RequestCursor{TS: last.Timestamp, ID: last.ID}
+	}
+	if len(reqs) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	slices.Reverse(reqs)
+
+	b := builder{t: &Transcript{ConversationID: conversationID}, tools: map[string]string{}}
+	for i := range reqs {
+		if err := b.add(ctx, store, &reqs[i], false); err != nil {
+			return nil, err
+		}
+	}
+	return b.t, nil
+}
+
+// Request builds the transcript of a single request: its whole prompt and
+// its response.
+func Request(ctx context.Context, store storage.Store, requestID uuid.UUID) (*Transcript, error) {
+	req, err := store.GetRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	b := builder{t: &Transcript{RequestID: requestID.String(), ConversationID: req.ConversationID}, tools: map[string]string{}}
+	if err := b.add(ctx, store, req, true); err != nil {
+		return nil, err
+	}
+	return b.t, nil
+}
+
+type builder struct {
+	t      *Transcript
+	system string
+	tools  map[string]string // tool_use ID -> tool name
+}
+
+func (b *builder) add(ctx context.Context, store storage.Store, req *storage.Request, full bool) error {
+	t := b.t
+	if t.Requests == 0 {
+		t.Start = req.Timestamp
+		// The first request shows the conversation so far.
+		full = true
+	}
+	t.Requests++
+	t.End = req.Timestamp
+	t.CostUSD += req.CostUSD
+	if req.Model != "" && !slices.Contains(t.Models, req.Model) {
+		t.Models = append(t.Models, req.Model)
+	}
+
+	p, err := store.GetPayload(ctx, req.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	msg := func(role string, blocks []Block) {
+		if len(blocks) > 0 {
+			t.Messages = append(t.Messages, Message{Role: role, RequestID: req.ID, TS: req.Timestamp, Model: req.Model, Blocks: blocks})
+		}
+	}
+
+	if p.Extras.SystemPrompt != b.system {
+		b.system = p.Extras.SystemPrompt
+		if b.system != "" {
+			msg(RoleSystem, []Block{{Type: "text", Text: b.system}})
+		}
+	}
+
+	var body processor.AnthropicRequest
+	if json.Unmarshal(p.ReqBody, &body) == nil {
+		start := 0
+		if !full {
+			for i, m := range body.Messages {
+				if m.Role == RoleAssistant {
+					start = i + 1
+				}
+			}
+		}
+		for _, m := range body.Messages[start:] {
+			msg(m.Role, b.blocks(m.Content))
+		}
+	}
+
+	var resp struct {
+		processor.AnthropicResponse
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(p.RespBody, &resp)
+	if resp.Type == "message" {
+		blocks := make([]Block, 0, len(resp.Content))
+		for _, c := range resp.Content {
+			switch c.Type {
+			case "text":
+				blocks = append(blocks, Block{Type: "text", Text: c.Text})
+			case "thinking":
+				blocks = append(blocks, Block{Type: "thinking", Text: c.Thinking})
+			case "tool_use":
+				b.tools[c.ID] = c.Name
+				blocks = append(blocks, Block{Type: "tool_use", ToolName: c.Name, ToolUseID: c.ID, Input: c.Input})
+			default:
+				blocks = append(blocks, Block{Type: c.Type})
+			}
+		}
+		msg(RoleAssistant, blocks)
+	}
+	switch {
+	case req.Incomplete:
+		msg(RoleError, []Block{{Type: "text", Text: "The response did not finish: " + req.ErrorMessage}})
+	case resp.Type == "error":
+		msg(RoleError, []Block{{Type: "text", Text: fmt.Sprintf("%d %s: %s", req.StatusCode, resp.Error.Type, resp.Error.Message)}})
+	case !req.Success && req.ErrorMessage != "":
+		msg(RoleError, []Block{{Type: "text", Text: req.ErrorMessage}})
+	}
+	return nil
+}
+
+// contentBlock is a request message content block.
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	Thinking  string          `json:"thinking"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"` // tool_result: string or blocks
+	IsError   bool            `json:"is_error"`
+}
+
+func (b *builder) blocks(content json.RawMessage) []Block {
+	var s string
+	if json.Unmarshal(content, &s) == nil {
+		if s == "" {
+			return nil
+		}
+		return []Block{{Type: "text", Text: s}}
+	}
+	var in []contentBlock
+	if json.Unmarshal(content, &in) != nil {
+		return nil
+	}
+	out := make([]Block, 0, len(in))
+	for _, c := range in {
+		switch c.Type {
+		case "text":
+			out = append(out, Block{Type: "text", Text: c.Text})
+		case "thinking":
+			out = append(out, Block{Type: "thinking", Text: c.Thinking})
+		case "tool_use":
+			b.tools[c.ID] = c.Name
+			out = append(out, Block{Type: "tool_use", ToolName: c.Name, ToolUseID: c.ID, Input: c.Input})
+		case "tool_result":
+			out = append(out, Block{Type: "tool_result", ToolName: b.tools[c.ToolUseID], ToolUseID: c.ToolUseID,
+				Text: resultText(c.Content), IsError: c.IsError})
+		default:
+			out = append(out, Block{Type: c.Type})
+		}
+	}
+	return out
+}
+
+// resultText flattens tool_result content to text; other content is shown
+// by its type.
+func resultText(content json.RawMessage) string {
+	var s string
+	if json.Unmarshal(content, &s) == nil {
+		return s
+	}
+	var parts []contentBlock
+	json.Unmarshal(content, &parts)
+	texts := make([]string, len(parts))
+	for i, p := range parts {
+		if p.Type == "text" {
+			texts[i] = p.Text
+		} else {
+			texts[i] = "[" + p.Type + "]"
+		}
+	}
+	return strings.Join(texts, "\n")
+}
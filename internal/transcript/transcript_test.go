@@ -0,0 +1,159 @@
+package transcript
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+)
+
+// conversationStore holds the requests of one conversation, oldest first.
+type conversationStore struct {
+	storage.Store
+	reqs     []storage.Request
+	payloads map[uuid.UUID]*storage.PayloadRecord
+}
+
+func (s *conversationStore) ListRequests(_ context.Context, f *storage.RequestFilter) ([]storage.Request, error) {
+	out := slices.Clone(s.reqs)
+	slices.Reverse(out) // newest first
+	return out, nil
+}
+
+func (s *conversationStore) GetRequest(_ context.Context, id uuid.UUID) (*storage.Request, error) {
+	for i := range s.reqs {
+		if s.reqs[i].ID == id {
+			return &s.reqs[i], nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *conversationStore) GetPayload(_ context.Context, id uuid.UUID) (*storage.PayloadRecord, error) {
+	if p, ok := s.payloads[id]; ok {
+		return p, nil
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *conversationStore) add(req storage.Request, system, reqBody, respBody string) {
+	req.ID = uuid.New()
+	req.Timestamp = time.Date(2026, 1, 2, 10, len(s.reqs), 0, 0, time.UTC)
+	s.reqs = append(s.reqs, req)
+	if reqBody != "" {
+		p := &storage.PayloadRecord{RequestID: req.ID, ReqBody: []byte(reqBody), RespBody: []byte(respBody)}
+		p.Extras.SystemPrompt = system
+		s.payloads[req.ID] = p
+	}
+}
+
+const (
+	hi      = `{"role":"user","content":"hi"}`
+	hello   = `{"role":"assistant","content":[{"type":"text","text":"hello"}]}`
+	runLs   = `{"role":"user","content":[{"type":"text","text":"run ls"}]}`
+	callLs  = `{"role":"assistant","content":[{"type":"thinking","thinking":"easy"},{"type":"tool_use","id":"t1","name":"bash","input":{"command":"ls"}}]}`
+	lsShown = `{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":[{"type":"text","text":"a.go"},{"type":"image"}]}]}`
+)
+
+func testStore() *conversationStore {
+	s := &conversationStore{payloads: map[uuid.UUID]*storage.PayloadRecord{}}
+	s.add(storage.Request{Model: "model-a", CostUSD: 0.25, Success: true}, "S",
+		`{"messages":[`+hi+`]}`,
+		`{"type":"message","content":[{"type":"text","text":"hello"}]}`)
+	s.add(storage.Request{Model: "model-b", CostUSD: 0.5, Success: true}, "S",
+		`{"messages":[`+hi+`,`+hello+`,`+runLs+`]}`,
+		`{"type":"message","content":[{"type":"thinking","thinking":"easy"},{"type":"tool_use","id":"t1","name":"bash","input":{"command":"ls"}}]}`)
+	s.add(storage.Request{Model: "model-b", Incomplete: true, ErrorMessage: "no end of stream"}, "S2",
+		`{"messages":[`+hi+`,`+hello+`,`+runLs+`,`+callLs+`,`+lsShown+`]}`,
+		`{"type":"message","content":[{"type":"text","text":"Found"}]}`)
+	s.add(storage.Request{Model: "model-b", Success: true}, "", "", "") // no payload
+	s.add(storage.Request{Model: "model-a", StatusCode: 529}, "S2",
+		`{"messages":[{"role":"user","content":"again"}]}`,
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	return s
+}
+
+// summary writes a message as "role: block block ...".
+func summary(m Message) string {
+	parts := []string{m.Role + ":"}
+	for _, b := range m.Blocks {
+		switch {
+		case b.ToolName != "":
+			parts = append(parts, fmt.Sprintf("%s(%s=%s)", b.Type, b.ToolName, b.Text+string(b.Input)))
+		case b.Text != "":
+			parts = append(parts, fmt.Sprintf("%s(%s)", b.Type, b.Text))
+		default:
+			parts = append(parts, b.Type)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestConversation(t *testing.T) {
+	s := testStore()
+	tr, err := Conversation(context.Background(), s, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"system: text(S)",
+		"user: text(hi)",
+		"assistant: text(hello)",
+		"user: text(run ls)",
+		`assistant: thinking(easy) tool_use(bash={"command":"ls"})`,
+		"system: text(S2)",
+		"user: tool_result(bash=a.go\n[image])",
+		"assistant: text(Found)",
+		"error: text(The response did not finish: no end of stream)",
+		"user: text(again)",
+		"error: text(529 overloaded_error: Overloaded)",
+	}
+	var got []string
+	for _, m := range tr.Messages {
+		got = append(got, summary(m))
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("messages:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if tr.Requests != 5 || tr.CostUSD != 0.75 || !slices.Equal(tr.Models, []string{"model-a", "model-b"}) {
+		t.Errorf("requests, cost, models = %d, %v, %v", tr.Requests, tr.CostUSD, tr.Models)
+	}
+	if !tr.Start.Equal(s.reqs[0].Timestamp) || !tr.End.Equal(s.reqs[4].Timestamp) {
+		t.Errorf("span = %v to %v", tr.Start, tr.End)
+	}
+	if tr.Messages[2].RequestID != s.reqs[0].ID || tr.Messages[3].RequestID != s.reqs[1].ID {
+		t.Error("messages not attributed to the request that first carried them")
+	}
+}
+
+func TestConversationNotFound(t *testing.T) {
+	s := &conversationStore{payloads: map[uuid.UUID]*storage.PayloadRecord{}}
+	if _, err := Conversation(context.Background(), s, "c"); err != storage.ErrNotFound {
+		t.Errorf("err = %v; want ErrNotFound", err)
+	}
+}
+
+func TestRequestShowsWholePrompt(t *testing.T) {
+	s := testStore()
+	tr, err := Request(context.Background(), s, s.reqs[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	for _, m := range tr.Messages {
+		roles = append(roles, m.Role)
+	}
+	want := []string{"system", "user", "assistant", "user", "assistant", "user", "assistant", "error"}
+	if !slices.Equal(roles, want) {
+		t.Errorf("roles = %v; want %v", roles, want)
+	}
+	if tr.Requests != 1 || tr.RequestID != s.reqs[2].ID.String() {
+		t.Errorf("transcript of %s covers %d requests", tr.RequestID, tr.Requests)
+	}
+}
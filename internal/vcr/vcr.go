@@ -0,0 +1,192 @@
+// Package vcr plays back recorded traffic instead of calling the API, for
+// deterministic tests of agent tooling without live API keys.
+//
+// In record mode every proxied request is stored with a hash of its method,
+// path and normalized body: JSON keys sorted, numbers in one notation (1.0
+// and 1e0 are 1) and the configured ignored fields (metadata by default,
+// which carries per-session user IDs) removed.
+// In playback mode a request whose hash matches a recorded successful request
+// gets the recorded response, with SSE streams re-emitted from their stored
+// events at the original pace or faster. Misses either fail or are proxied
+// and recorded like any other request.
+package vcr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	"github.com/namikmesic/claude-sidekick/internal/stream"
+)
+
+// VCR_MODE values.
+const (
+	ModeRecord   = "record"
+	ModePlayback = "playback"
+)
+
+// What VCR_ON_MISS does with requests that match no recording.
+const (
+	MissFail   = "fail"
+	MissRecord = "record"
+)
+
+// Hasher computes request hashes.
+type Hasher struct {
+	ignore [][]string
+}
+
+// NewHasher returns a Hasher leaving out the given body fields, each a
+// dotted path of object keys such as "metadata" or "metadata.user_id".
+func NewHasher(ignore []string) *Hasher {
+	h := &Hasher{}
+	for _, f := range ignore {
+		if f = strings.TrimSpace(f); f != "" {
+			h.ignore = append(h.ignore, strings.Split(f, "."))
+		}
+	}
+	return h
+}
+
+// Hash returns the hex SHA-256 of a request. Bodies that are not JSON
+// objects are hashed as they are.
+func (h *Hasher) Hash(method, path string, body []byte) string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s %s\n", method, path)
+	sum.Write(h.normalize(body))
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func (h *Hasher) normalize(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v map[string]any
+	if dec.Decode(&v) != nil || v == nil {
+		return body
+	}
+	for _, path := range h.ignore {
+		remove(v, path)
+	}
+	// Marshal sorts map keys.
+	out, err := json.Marshal(canonical(v))
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// canonical rewrites the numbers in v so that equal values are written
+// alike. Integers stay exact; other numbers get their shortest float64 form.
+func canonical(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = canonical(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = canonical(e)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return json.Number(strconv.FormatInt(i, 10))
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return v
+		}
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return json.Number(strconv.FormatInt(int64(f), 10))
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return v
+}
+
+func remove(obj map[string]any, path []string) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := obj[k].(map[string]any)
+		if !ok {
+			return
+		}
+		obj = next
+	}
+	delete(obj, path[len(path)-1])
+}
+
+// Recording is a stored request to play back.
+type Recording struct {
+	Request *storage.Request
+	Payload *storage.PayloadRecord
+	Events  []stream.SSEEvent // of streamed responses
+}
+
+// Player looks up recordings and paces their playback.
+type Player struct {
+	store        storage.Store
+	speed        float64
+	recordMisses bool
+}
+
+// NewPlayer returns a Player replaying at speed times the recorded pace (0
+// for no delays). recordMisses proxies requests without a recording instead
+// of failing them.
+func NewPlayer(store storage.Store, speed float64, recordMisses bool) *Player {
+	return &Player{store: store, speed: speed, recordMisses: recordMisses}
+}
+
+func (p *Player) RecordMisses() bool {
+	return p.recordMisses
+}
+
+// Find returns the latest recording with the given hash, or
+// storage.ErrNotFound when there is none that can be played back.
+func (p *Player) Find(ctx context.Context, hash string) (*Recording, error) {
+	req, err := p.store.LatestRecording(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := p.store.GetPayload(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recording{Request: req, Payload: payload}
+	if req.IsStream {
+		if rec.Events, err = p.store.ListSSEEvents(ctx, req.ID); err != nil {
+			return nil, err
+		}
+		if len(rec.Events) == 0 {
+			// Not processed yet.
+			return nil, storage.ErrNotFound
+		}
+	} else if len(payload.RespBody) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return rec, nil
+}
+
+// Wait sleeps until offsetMs of recorded time after start have passed at
+// the playback speed. Returns early with the context's error when it is
+// cancelled.
+func (p *Player) Wait(ctx context.Context, start time.Time, offsetMs int) error {
+	if p.speed <= 0 || offsetMs <= 0 {
+		return ctx.Err()
+	}
+	at := start.Add(time.Duration(float64(offsetMs) / p.speed * float64(time.Millisecond)))
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+package vcr
+
+import "testing"
+
+func TestHashNormalizes(t *testing.T) {
+	h := NewHasher([]string{"metadata.user_id", " stream ", ""})
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"key order", `{"model":"m","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`,
+			`{"messages":[{"content":"hi","role":"user"}],"max_tokens":10,"model":"m"}`, true},
+		{"whitespace", `{"model": "m", "n": [1, 2]}`, "{\"model\":\"m\",\n\"n\":[1,2]}", true},
+		{"integer notation", `{"temperature":1}`, `{"temperature":1.0}`, true},
+		{"exponent", `{"max_tokens":1000}`, `{"max_tokens":1e3}`, true},
+		{"trailing zeros", `{"top_p":0.50}`, `{"top_p":0.5}`, true},
+		{"nested numbers", `{"tools":[{"input_schema":{"maximum":2.0}}]}`, `{"tools":[{"input_schema":{"maximum":2}}]}`, true},
+		{"different numbers", `{"temperature":0.7}`, `{"temperature":0.75}`, false},
+		{"large integers stay exact", `{"seed":9007199254740993}`, `{"seed":9007199254740992}`, false},
+		{"array order", `{"stop_sequences":["a","b"]}`, `{"stop_sequences":["b","a"]}`, false},
+		{"dotted path", `{"model":"m","metadata":{"user_id":"u1"}}`, `{"model":"m","metadata":{"user_id":"u2"}}`, true},
+		{"only the dotted leaf", `{"metadata":{"user_id":"u","tag":"a"}}`, `{"metadata":{"user_id":"u","tag":"b"}}`, false},
+		{"missing path", `{"model":"m"}`, `{"model":"m","metadata":{"user_id":"u"}}`, false},
+		{"path through a non-object", `{"metadata":"x"}`, `{"metadata":"x"}`, true},
+		{"top-level field, trimmed", `{"model":"m","stream":true}`, `{"model":"m","stream":false}`, true},
+		{"not JSON", `model=m`, `model=m`, true},
+		{"not JSON differs", `model=m`, `model=n`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := h.Hash("POST", "/v1/messages", []byte(tt.a))
+			b := h.Hash("POST", "/v1/messages", []byte(tt.b))
+			if (a == b) != tt.same {
+				t.Errorf("same hash = %v; want %v\n%s\n%s", a == b, tt.same, h.normalize([]byte(tt.a)), h.normalize([]byte(tt.b)))
+			}
+		})
+	}
+}
+
+func TestHashCoversMethodAndPath(t *testing.T) {
+	h := NewHasher(nil)
+	body := []byte(`{"model":"m"}`)
+	base := h.Hash("POST", "/v1/messages", body)
+	if h.Hash("POST", "/v1/messages/count_tokens", body) == base {
+		t.Error("path not hashed")
+	}
+	if h.Hash("PUT", "/v1/messages", body) == base {
+		t.Error("method not hashed")
+	}
+	if NewHasher([]string{"metadata"}).Hash("POST", "/v1/messages", body) != base {
+		t.Error("ignoring an absent field changed the hash")
+	}
+}
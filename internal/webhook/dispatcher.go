@@ -0,0 +1,249 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/events"
+	"github.com/namikmesic/claude-sidekick/internal/storage"
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+type Options struct {
+	MaxAttempts  int
+	Timeout      time.Duration
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+}
+
+// EnsureConsumers creates or updates the durable consumer of every endpoint
+// and deletes those of endpoints no longer configured. New consumers start
+// with events published from now on.
+func EnsureConsumers(js nats.JetStreamContext, endpoints []Endpoint, opts Options) error {
+	want := make(map[string]bool)
+	for i := range endpoints {
+		ep := &endpoints[i]
+		want[ep.ConsumerName()] = true
+		cfg := &nats.ConsumerConfig{
+			Durable:        ep.ConsumerName(),
+			Description:    "sidekick webhook " + ep.Name,
+			FilterSubjects: ep.subjects(),
+			DeliverPolicy:  nats.DeliverNewPolicy,
+			AckPolicy:      nats.AckExplicitPolicy,
+			// Covers one delivery; retries are scheduled with NakWithDelay.
+			AckWait:    2*opts.Timeout + 10*time.Second,
+			MaxDeliver: opts.MaxAttempts,
+		}
+		_, err := js.ConsumerInfo(events.StreamName, cfg.Durable)
+		if errors.Is(err, nats.ErrConsumerNotFound) {
+			_, err = js.AddConsumer(events.StreamName, cfg)
+		} else if err == nil {
+			_, err = js.UpdateConsumer(events.StreamName, cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("webhook %s: %w", ep.Name, err)
+		}
+	}
+
+	for name := range js.ConsumerNames(events.StreamName) {
+		if strings.HasPrefix(name, "webhook-") && !want[name] {
+			if err := js.DeleteConsumer(events.StreamName, name); err != nil {
+				return fmt.Errorf("delete consumer %s: %w", name, err)
+			}
+			log.Info().Str("consumer", name).Msg("removed consumer of unconfigured webhook")
+		}
+	}
+	return nil
+}
+
+// Dispatcher delivers events to the endpoints.
+type Dispatcher struct {
+	endpoints []Endpoint
+	writer    *storage.BatchWriter
+	client    *http.Client
+	opts      Options
+}
+
+func NewDispatcher(endpoints []Endpoint, writer *storage.BatchWriter, opts Options) *Dispatcher {
+	return &Dispatcher{
+		endpoints: endpoints,
+		writer:    writer,
+		client:    &http.Client{Timeout: opts.Timeout},
+		opts:      opts,
+	}
+}
+
+// Run delivers events until ctx is cancelled. Each endpoint is served by
+// its own loop, so a slow or failing endpoint does not hold up the others.
+// EnsureConsumers must have been called first.
+func (d *Dispatcher) Run(ctx context.Context, js nats.JetStreamContext) {
+	var wg sync.WaitGroup
+	for i := range d.endpoints {
+		ep := &d.endpoints[i]
+		sub, err := js.PullSubscribe("", ep.ConsumerName(), nats.Bind(events.StreamName, ep.ConsumerName()))
+		if err != nil {
+			log.Error().Err(err).Str("webhook", ep.Name).Msg("failed to bind webhook consumer")
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sub.Unsubscribe()
+			d.run(ctx, ep, sub)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) run(ctx context.Context, ep *Endpoint, sub *nats.Subscription) {
+	for ctx.Err() == nil {
+		// One at a time: AckWait covers a single delivery, so events
+		// fetched behind a slow one would be redelivered meanwhile.
+		fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		msgs, err := sub.Fetch(1, nats.Context(fetchCtx))
+		cancel()
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) && !errors.Is(err, nats.ErrTimeout) {
+			log.Warn().Err(err).Str("webhook", ep.Name).Msg("JetStream fetch failed")
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			d.handle(ctx, ep, msg)
+		}
+	}
+}
+
+func (d *Dispatcher) handle(ctx context.Context, ep *Endpoint, msg *nats.Msg) {
+	var env events.Envelope
+	var fields eventFields
+	if err := json.Unmarshal(msg.Data, &env); err != nil {
+		msg.Term()
+		return
+	}
+	json.Unmarshal(env.Data, &fields)
+	if !ep.matches(&env, &fields) {
+		msg.Ack()
+		return
+	}
+	if ctx.Err() != nil {
+		msg.Nak()
+		return
+	}
+
+	attempt := 1
+	if meta, err := msg.Metadata(); err == nil {
+		attempt = int(meta.NumDelivered)
+	}
+	start := time.Now()
+	status, err := d.Send(ctx, ep, &env, msg.Data, attempt)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down; leave the event to the next replica.
+		msg.Nak()
+		return
+	}
+
+	rec := &storage.WebhookDelivery{
+		CreatedAt:  start,
+		Endpoint:   ep.Name,
+		EventID:    env.ID,
+		EventType:  env.Type,
+		Attempt:    attempt,
+		StatusCode: status,
+		DurationMs: int(time.Since(start).Milliseconds()),
+	}
+	switch {
+	case err == nil:
+		rec.Outcome = storage.DeliveryDelivered
+		msg.Ack()
+	case !retryable(status) || attempt >= d.opts.MaxAttempts:
+		rec.Outcome, rec.Error = storage.DeliveryFailed, err.Error()
+		log.Warn().Err(err).Str("webhook", ep.Name).Str("event_id", env.ID).Int("attempt", attempt).Msg("webhook delivery failed, giving up")
+		msg.Term()
+	default:
+		rec.Outcome, rec.Error = storage.DeliveryRetrying, err.Error()
+		backoff := d.backoff(attempt)
+		log.Debug().Err(err).Str("webhook", ep.Name).Str("event_id", env.ID).Dur("backoff", backoff).Msg("webhook delivery failed, retrying")
+		msg.NakWithDelay(backoff)
+	}
+	d.writer.Enqueue(storage.InsertWebhookDeliveryJob(rec))
+}
+
+// Send posts one event to the endpoint, ignoring its filters. It returns the
+// response status (0 when none arrived) and an error unless the status is
+// 2xx.
+func (d *Dispatcher) Send(ctx context.Context, ep *Endpoint, env *events.Envelope, raw []byte, attempt int) (int, error) {
+	var fields eventFields
+	json.Unmarshal(env.Data, &fields)
+	body, err := ep.body(env, raw, &fields)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range ep.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sidekick-webhook/1")
+	req.Header.Set("X-Sidekick-Event", env.Type)
+	req.Header.Set("X-Sidekick-Event-Id", env.ID)
+	req.Header.Set("X-Sidekick-Delivery-Attempt", strconv.Itoa(attempt))
+	if ep.Secret != "" {
+		req.Header.Set("X-Sidekick-Signature", Sign(ep.Secret, time.Now(), body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the X-Sidekick-Signature value for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryable reports whether a failed delivery may succeed later: no
+// response, a server error, or a timeout or rate limit. Other 4xx responses
+// are the endpoint rejecting the event.
+func retryable(status int) bool {
+	return status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.opts.RetryBackoff
+	for i := 1; i < attempt && backoff < d.opts.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.opts.MaxBackoff)
+}
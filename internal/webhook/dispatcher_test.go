@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/namikmesic/claude-sidekick/internal/events"
+)
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	got := Sign("s3cret", at, body)
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if got != want {
+		t.Errorf("Sign = %q; want %q", got, want)
+	}
+	if Sign("other", at, body) == got {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign("s3cret", at.Add(time.Second), body) == got {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestSendHeaders(t *testing.T) {
+	var got http.Header
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	ep := &Endpoint{
+		Name:    "test",
+		URL:     srv.URL,
+		Secret:  "s3cret",
+		Format:  FormatJSON,
+		Headers: map[string]string{"Authorization": "Bearer t"},
+	}
+	env := &events.Envelope{ID: "evt_1", Type: events.RequestCompletedType, Data: json.RawMessage(`{}`)}
+	raw, _ := json.Marshal(env)
+	d := NewDispatcher(nil, nil, Options{Timeout: 5 * time.Second})
+	if _, err := d.Send(context.Background(), ep, env, raw, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Get("Authorization") != "Bearer t" {
+		t.Errorf("Authorization = %q", got.Get("Authorization"))
+	}
+	if got.Get("X-Sidekick-Delivery-Attempt") != "2" || got.Get("X-Sidekick-Event-Id") != "evt_1" {
+		t.Errorf("event headers = %v", got)
+	}
+	sig := got.Get("X-Sidekick-Signature")
+	ts, _, _ := strings.Cut(strings.TrimPrefix(sig, "t="), ",")
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(ts + "." + string(gotBody)))
+	if !strings.HasSuffix(sig, ",v1="+hex.EncodeToString(mac.Sum(nil))) {
+		t.Errorf("signature %q does not match the body", sig)
+	}
+}
+
+func TestLoadEndpointsRejectsReservedHeaders(t *testing.T) {
+	for _, name := range []string{"X-Sidekick-Signature", "x-sidekick-event", "content-type"} {
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		raw := `[{"name":"a","url":"https://example.com","headers":{"` + name + `":"x"}}]`
+		if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadEndpoints(path); err == nil {
+			t.Errorf("header %s accepted", name)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Package webhook delivers domain events to HTTP endpoints.
+//
+// Endpoints are listed in a JSON file (WEBHOOKS_FILE). Each one gets its own
+// durable consumer on the SIDEKICK_EVENTS stream, shared by all replicas, so
+// every event is delivered once per endpoint and survives restarts. Failed
+// deliveries are retried with exponential backoff; every attempt is written
+// to the webhook_deliveries table (see `sidekick webhooks log`).
+//
+// Requests are POSTed with:
+//
+//	Content-Type: application/json
+//	X-Sidekick-Event: <event type>
+//	X-Sidekick-Event-Id: <envelope id, stable across retries>
+//	X-Sidekick-Delivery-Attempt: <n>
+//	X-Sidekick-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256>
+//
+// The signature is only sent when the endpoint has a secret. It is computed
+// over "<t>.<body>" with the secret as key; receivers should recompute it and
+// reject stale timestamps.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/namikmesic/claude-sidekick/internal/events"
+)
+
+// Body formats.
+const (
+	FormatJSON  = "json"  // the event envelope as published
+	FormatSlack = "slack" // {"text": ...} for Slack-compatible incoming webhooks
+)
+
+// Endpoint is one webhook target. URL, Secret and header values may
+// reference environment variables as ${NAME}. Headers may not set
+// Content-Type, User-Agent or X-Sidekick-*.
+//
+// Events selects event types (default: all). The remaining filters only
+// apply to events that carry the field: Models to events with a model,
+// MinCostUSD to request.completed, StatusCodes and ErrorTypes to
+// request.failed. E.g. rate-limit hits are request.failed with status code
+// 429 or error type rate_limit_error.
+type Endpoint struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Secret  string            `json:"secret,omitempty"`
+	Format  string            `json:"format,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	Events      []string `json:"events,omitempty"`
+	Models      []string `json:"models,omitempty"`
+	MinCostUSD  float64  `json:"min_cost_usd,omitempty"`
+	StatusCodes []int    `json:"status_codes,omitempty"`
+	ErrorTypes  []string `json:"error_types,omitempty"`
+}
+
+var (
+	validName   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	knownEvents = []string{
+		events.RequestCompletedType,
+		events.ToolCalledType,
+		events.RequestFailedType,
+		events.BudgetThresholdType,
+	}
+)
+
+// LoadEndpoints reads and validates an endpoints file.
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var eps []Endpoint
+	if err := json.Unmarshal(raw, &eps); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for i := range eps {
+		ep := &eps[i]
+		if !validName.MatchString(ep.Name) {
+			return nil, fmt.Errorf("webhook %q: name must be letters, digits, - or _", ep.Name)
+		}
+		if seen[ep.Name] {
+			return nil, fmt.Errorf("webhook %q: duplicate name", ep.Name)
+		}
+		seen[ep.Name] = true
+
+		ep.URL = os.ExpandEnv(ep.URL)
+		ep.Secret = os.ExpandEnv(ep.Secret)
+		for k, v := range ep.Headers {
+			if reservedHeader(k) {
+				return nil, fmt.Errorf("webhook %q: header %q is set by sidekick", ep.Name, k)
+			}
+			ep.Headers[k] = os.ExpandEnv(v)
+		}
+		if u, err := url.Parse(ep.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %q: invalid url", ep.Name)
+		}
+		switch ep.Format {
+		case "":
+			ep.Format = FormatJSON
+		case FormatJSON, FormatSlack:
+		default:
+			return nil, fmt.Errorf("webhook %q: unknown format %q", ep.Name, ep.Format)
+		}
+		for _, t := range ep.Events {
+			if !slices.Contains(knownEvents, t) {
+				return nil, fmt.Errorf("webhook %q: unknown event type %q", ep.Name, t)
+			}
+		}
+	}
+	return eps, nil
+}
+
+// reservedHeader reports whether sidekick sets the header itself.
+func reservedHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	return name == "Content-Type" || name == "User-Agent" || strings.HasPrefix(name, "X-Sidekick-")
+}
+
+// ConsumerName is the durable consumer delivering to the endpoint.
+func (ep *Endpoint) ConsumerName() string {
+	return "webhook-" + ep.Name
+}
+
+func (ep *Endpoint) subjects() []string {
+	if len(ep.Events) == 0 {
+		return []string{events.SubjectPrefix + ">"}
+	}
+	subjects := make([]string, len(ep.Events))
+	for i, t := range ep.Events {
+		subjects[i] = events.Subject(t)
+	}
+	return subjects
+}
+
+// eventFields are the fields the filters and the Slack format look at,
+// whichever event type carries them.
+type eventFields struct {
+	RequestID    string  `json:"request_id"`
+	Model        string  `json:"model"`
+	StopReason   string  `json:"stop_reason"`
+	CostUSD      float64 `json:"cost_usd"`
+	StatusCode   int     `json:"status_code"`
+	ErrorType    string  `json:"error_type"`
+	Message      string  `json:"message"`
+	Name         string  `json:"name"`
+	Period       string  `json:"period"`
+	Window       string  `json:"window"`
+	ThresholdPct int     `json:"threshold_pct"`
+	LimitUSD     float64 `json:"limit_usd"`
+	SpentUSD     float64 `json:"spent_usd"`
+	Usage        struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (ep *Endpoint) matches(env *events.Envelope, f *eventFields) bool {
+	if len(ep.Events) > 0 && !slices.Contains(ep.Events, env.Type) {
+		return false
+	}
+	if len(ep.Models) > 0 && f.Model != "" && !slices.Contains(ep.Models, f.Model) {
+		return false
+	}
+	switch env.Type {
+	case events.RequestCompletedType:
+		return f.CostUSD >= ep.MinCostUSD
+	case events.RequestFailedType:
+		if len(ep.StatusCodes) > 0 && !slices.Contains(ep.StatusCodes, f.StatusCode) {
+			return false
+		}
+		if len(ep.ErrorTypes) > 0 && !slices.Contains(ep.ErrorTypes, f.ErrorType) {
+			return false
+		}
+	}
+	return true
+}
+
+// body renders the request body for the endpoint's format.
+func (ep *Endpoint) body(env *events.Envelope, raw []byte, f *eventFields) ([]byte, error) {
+	if ep.Format != FormatSlack {
+		return raw, nil
+	}
+	return json.Marshal(map[string]string{"text": slackText(env, f)})
+}
+
+func slackText(env *events.Envelope, f *eventFields) string {
+	switch env.Type {
+	case events.RequestCompletedType:
+		return fmt.Sprintf("%s request `%s` completed: %d in / %d out tokens, $%.4f (%s)",
+			f.Model, f.RequestID, f.Usage.InputTokens, f.Usage.OutputTokens, f.CostUSD, f.StopReason)
+	case events.ToolCalledType:
+		return fmt.Sprintf("%s request `%s` called tool `%s`", f.Model, f.RequestID, f.Name)
+	case events.RequestFailedType:
+		reason := f.ErrorType
+		if f.StatusCode != 0 {
+			reason = fmt.Sprintf("%d %s", f.StatusCode, reason)
+		}
+		return fmt.Sprintf(":warning: %s request `%s` failed: %s: %s", f.Model, f.RequestID, reason, f.Message)
+	case events.BudgetThresholdType:
+		return fmt.Sprintf(":money_with_wings: %s budget %s reached %d%%: $%.2f of $%.2f",
+			f.Period, f.Window, f.ThresholdPct, f.SpentUSD, f.LimitUSD)
+	}
+	return fmt.Sprintf("sidekick event %s (%s)", env.Type, env.ID)
+}